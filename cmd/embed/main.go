@@ -13,7 +13,7 @@ import (
 	"text/template"
 
 	"github.com/bmatcuk/doublestar"
-	"github.com/flga/nes/cmd/internal/asset"
+	"github.com/flga/nes/internal/asset"
 )
 
 type tplData struct {
@@ -28,7 +28,7 @@ var tpl = template.Must(template.New("").Parse(`// Code generated automatically
 
 package {{ .Pkg }}
 
-import "github.com/flga/nes/cmd/internal/asset"
+import "github.com/flga/nes/internal/asset"
 
 var assets = asset.List{
 	{{ range .Assets -}}
@@ -0,0 +1,159 @@
+// Command gamedb converts the NES 2.0 XML database to the format of
+// nes/gamedb.txt, writing one line per game to stdout.
+//
+// Usage:
+//
+//	go run ./cmd/gamedb nes20db.xml >> nes/gamedb.txt
+//
+// The title of each game is taken from the comment the database puts before
+// it, the name of the file it was made from. Games that share their PRG and
+// CHR with one already written are skipped.
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+type game struct {
+	Comment string `xml:",comment"`
+	ROM     struct {
+		CRC32 string `xml:"crc32,attr"`
+		SHA1  string `xml:"sha1,attr"`
+	} `xml:"rom"`
+	PCB struct {
+		Mapper    string `xml:"mapper,attr"`
+		Submapper string `xml:"submapper,attr"`
+		Mirroring string `xml:"mirroring,attr"`
+		Battery   string `xml:"battery,attr"`
+	} `xml:"pcb"`
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gamedb nes20db.xml")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	if err := convert(w, f); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func convert(w io.Writer, r io.Reader) error {
+	seen := make(map[string]bool)
+
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "game" {
+			continue
+		}
+
+		var g game
+		if err := d.DecodeElement(&g, &start); err != nil {
+			return err
+		}
+
+		crc := strings.ToLower(g.ROM.CRC32)
+		if crc == "" || seen[crc] {
+			continue
+		}
+		seen[crc] = true
+
+		if _, err := fmt.Fprintln(w, line(g, crc)); err != nil {
+			return err
+		}
+	}
+}
+
+// line formats g as a gamedb.txt entry.
+func line(g game, crc string) string {
+	sha := strings.ToLower(g.ROM.SHA1)
+	if sha == "" {
+		sha = "-"
+	}
+
+	mirroring := "-"
+	switch g.PCB.Mirroring {
+	case "H":
+		mirroring = "h"
+	case "V":
+		mirroring = "v"
+	case "4":
+		mirroring = "4"
+	}
+
+	battery := "-"
+	switch g.PCB.Battery {
+	case "0":
+		battery = "n"
+	case "1":
+		battery = "y"
+	}
+
+	return strings.Join([]string{
+		crc,
+		sha,
+		orDash(g.PCB.Mapper),
+		orDash(g.PCB.Submapper),
+		mirroring,
+		battery,
+		title(g.Comment),
+	}, " ")
+}
+
+// title turns the file name in the comment of a game into its title.
+func title(comment string) string {
+	name := strings.TrimSpace(comment)
+	name = path.Base(strings.Replace(name, `\`, "/", -1))
+	if ext := strings.ToLower(path.Ext(name)); ext == ".nes" || ext == ".unf" {
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+	if name == "" || name == "." {
+		return "unknown"
+	}
+
+	return name
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
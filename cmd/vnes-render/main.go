@@ -0,0 +1,192 @@
+// Command vnes-render runs roms without a window or an audio device and writes
+// what they play to wav files named after them. Unlike vnes it only needs the
+// nes package, so it builds without SDL and portaudio.
+//
+// Usage:
+//
+//	vnes-render [flags] rom...
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flga/nes/nes"
+)
+
+type renderOptions struct {
+	frames   int
+	duration time.Duration
+	channels bool
+	rate     float64
+	outDir   string
+	bios     string
+}
+
+// outputPrefix returns the path, without the extension, of the wav files for
+// the rom at path. NSF tracks get their number appended, 1 based.
+func outputPrefix(dir, path string, track int) string {
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	name = strings.TrimSuffix(name, ext)
+	if strings.EqualFold(ext, ".gz") {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if track >= 0 {
+		name = fmt.Sprintf("%s_%02d", name, track+1)
+	}
+
+	return filepath.Join(dir, name)
+}
+
+func loadHeadless(path string, o renderOptions) (*nes.Console, error) {
+	console := nes.NewConsole(float32(o.rate), 0, nil)
+	if o.bios != "" {
+		if err := console.LoadDiskBIOS(o.bios); err != nil {
+			return nil, err
+		}
+	}
+	if err := console.LoadPath(path); err != nil {
+		return nil, err
+	}
+
+	return console, nil
+}
+
+// renderTrack runs the rom at path and records what it plays to the wav files
+// at prefix. NSF files play track, or their start track if it's negative.
+// Without a number of frames or a duration NSF tracks play until they end, if
+// their length is known. The duration is measured in emulated time, so PAL
+// tunes last as long as NTSC ones, rounded up to a whole frame.
+func renderTrack(path string, track int, prefix string, o renderOptions) (err error) {
+	console, err := loadHeadless(path, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := console.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if track >= 0 {
+		if err := console.PlayTrack(track); err != nil {
+			return err
+		}
+	}
+
+	info, isNSF := console.NSF()
+	untilEnd := o.frames == 0 && o.duration == 0
+	if untilEnd && (!isNSF || info.TrackInfo[console.Track()].Length == 0) {
+		return errors.New("the length of the track is not known, set -frames or -seconds")
+	}
+
+	// nothing plays the audio, it only needs to be recorded
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-console.AudioChannel():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err := console.RecordTo(prefix, o.channels); err != nil {
+		return err
+	}
+	start := console.Elapsed()
+	for frame := 0; ; frame++ {
+		if o.frames > 0 && frame >= o.frames {
+			break
+		}
+		if o.duration > 0 && console.Elapsed()-start >= o.duration {
+			break
+		}
+		if untilEnd && console.TrackEnded() {
+			break
+		}
+		console.StepFrame()
+	}
+
+	return console.StopRecording()
+}
+
+// render records the rom at path, every track of the playlist of NSF files if
+// album is set.
+func render(path string, track int, album bool, o renderOptions) error {
+	tracks := []int{track}
+	if album {
+		console, err := loadHeadless(path, o)
+		if err != nil {
+			return err
+		}
+		info, ok := console.NSF()
+		if err := console.Close(); err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("only NSF files have albums")
+		}
+		tracks = info.Playlist
+	}
+
+	for _, track := range tracks {
+		prefix := outputPrefix(o.outDir, path, track)
+		if err := renderTrack(path, track, prefix, o); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s.wav\n", path, prefix)
+	}
+
+	return nil
+}
+
+func main() {
+	frames := flag.Int("frames", 0, "Number of frames to run.")
+	seconds := flag.Float64("seconds", 0, "Number of seconds to run, if -frames is not set. Without either NSF tracks play until they end, if their length is known.")
+	track := flag.Int("track", 0, "NSF track to play, 1 based. By default the start track of the file is played.")
+	album := flag.Bool("album", false, "Play every track of the NSF playlist, each one to its own files.")
+	channels := flag.Bool("channels", false, "Write every channel to its own file too, along with the mix.")
+	rate := flag.Float64("rate", 44100, "Sample rate of the wav files.")
+	outDir := flag.String("o", ".", "Directory to write the wav files to.")
+	bios := flag.String("bios", "", "Famicom Disk System BIOS used to run .fds disk images. By default disksys.rom in the same directory as the disk image is used.")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vnes-render [flags] rom...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || *frames < 0 || *seconds < 0 || *rate <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	o := renderOptions{
+		frames:   *frames,
+		channels: *channels,
+		rate:     *rate,
+		outDir:   *outDir,
+		bios:     *bios,
+	}
+	if o.frames == 0 {
+		o.duration = time.Duration(*seconds * float64(time.Second))
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		if err := render(path, *track-1, *album, o); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			status = 1
+		}
+	}
+
+	os.Exit(status)
+}
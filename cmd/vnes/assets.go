@@ -2,7 +2,7 @@
 
 package main
 
-import "github.com/flga/nes/cmd/internal/asset"
+import "github.com/flga/nes/internal/asset"
 
 var assets = asset.List{
 	asset.New("assets", "runescape_uf.bmfc", "H4sIAAAAAAAA/0RSQU/dPBC8+1dE4vrxKYGWioMPvIceD7VqEQ+o1Etl7Emywllb9poCv75yEsolO7OZkb3jPWoueIDfBodmQzKZ2OwCS3MFRjISUmMD9zSUZIQCNz15qPp5QMoUWHdKHTV9tWSIEA9ZVfbdTNC3hXGwJqK5383dHXnoVBi5dn+X/n+RXtnRpANEt7PmQG/Q3ZkyRncqW+Ox113bqpJxmEKQkXjQraK8Cd7N4FqMJ6tnyT2TDQ66U46yefTYhJftaFLWnQpFYpFrfjaeXG1e+dc46la5wHLN1heHr0hMPNwYmi0lY09cx9KdSmCHtEth+lHEE2M5cuth0t1rxJJFncZYQWqMp4EnsKhonCMeLsMf1u07u48f+JaGUT7oN/SV5Wgs8bAPid5qGAt9QJLlajt6gdtj9fYhWfxCCrqt91imXR4sFPlJTkZ9flbxalnIhuQSUUZ9ejLnf4lsdyFNph7Sh5K2I/sbY59Q0xa8SElYBZGH9842TDEhzzvRKuPjaKpRtyrBzeiTGhLAK370BSskfr6oD8nPt0u5Wsrm3yA1bLXWu5HsEyPn5W+GhxW4Ofc871LWpyfH55//O/9y3J2cVRFNMaQqIhu4ockMyOpvAAAA//+HxGqB+wIAAA=="),
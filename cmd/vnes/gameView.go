@@ -105,6 +105,32 @@ func (v *gameView) Init(engine *engine, console *nes.Console) error {
 			Foreground: white,
 			Background: black,
 		},
+		&gui.Message{
+			Tag:      "player",
+			Disabled: false,
+			UpdateFn: func(m *gui.Message) {
+				info, ok := console.NSF()
+				if !ok {
+					m.Text = ""
+					return
+				}
+				m.Text = fmt.Sprintf("Track %d/%d\n%s\n\n%s\n%s\n%s\n\n< previous   next >",
+					console.Track()+1,
+					info.Tracks,
+					info.TrackInfo[console.Track()].Label,
+					info.Title,
+					info.Artist,
+					info.Copyright,
+				)
+			},
+			Font:       font,
+			Size:       32,
+			Align:      gui.Center,
+			Padding:    gui.Padding{Top: 10, Right: 10, Bottom: 10, Left: 10},
+			Position:   gui.Middle | gui.Center,
+			Foreground: white,
+			Background: black,
+		},
 	)
 
 	v.layers = v.layers.New(
@@ -230,6 +256,35 @@ console: %.fms`,
 					},
 					Callback: func() error { return v.ToggleFullscreen() },
 				},
+				gui.MenuItem{
+					Label: gui.Cell{
+						UpdateFn: func() string {
+							if console.DiskSides() == 0 {
+								return ""
+							}
+							return "Disk Side"
+						},
+						Font:    font,
+						Size:    32,
+						Padding: gui.Padding{Top: 5, Right: 15, Bottom: 5, Left: 0},
+						Color:   white,
+						Hover:   lightBlue,
+					},
+					Value: gui.Cell{
+						UpdateFn: func() string {
+							if console.DiskSides() == 0 {
+								return ""
+							}
+							return diskSideName(console.DiskSide())
+						},
+						Font:    font,
+						Size:    32,
+						Padding: gui.Padding{Top: 5, Right: 0, Bottom: 5, Left: 15},
+						Color:   white,
+						Hover:   lightBlue,
+					},
+					Callback: func() error { return v.switchDiskSide(console) },
+				},
 				gui.MenuItem{
 					Label: gui.Cell{
 						Text:    "Volume",
@@ -560,6 +615,27 @@ func (v *gameView) handleConsoleEvts(evt sdl.Event, engine *engine, console *nes
 		return true, nil
 	}
 
+	if gui.IsKeyPress(evt, sdl.K_f) {
+		return true, v.switchDiskSide(console)
+	}
+
+	if gui.IsKeyPress(evt, sdl.K_c) {
+		return true, v.insertCoin(console, 0)
+	}
+
+	if _, ok := console.NSF(); ok {
+		if gui.IsButtonPress(evt, sdl.CONTROLLER_BUTTON_DPAD_LEFT) || gui.IsKeyPress(evt, sdl.K_LEFT) {
+			return true, v.switchTrack(console, -1)
+		}
+		if gui.IsButtonPress(evt, sdl.CONTROLLER_BUTTON_DPAD_RIGHT) || gui.IsKeyPress(evt, sdl.K_RIGHT) {
+			return true, v.switchTrack(console, 1)
+		}
+	}
+
+	if gui.IsKeyPress(evt, sdl.K_c, sdl.KMOD_SHIFT) {
+		return true, v.insertCoin(console, 1)
+	}
+
 	switch evt := evt.(type) {
 	case *sdl.ControllerButtonEvent:
 		if btn, ok := controllerMapping[evt.Button]; ok {
@@ -578,6 +654,10 @@ func (v *gameView) handleConsoleEvts(evt sdl.Event, engine *engine, console *nes
 }
 
 func (v *gameView) Update(console *nes.Console, engine *engine) {
+	if console.TrackEnded() {
+		// the track can't be invalid, it comes from the playlist
+		_ = v.switchTrack(console, 1)
+	}
 	v.layers.Update(v.View)
 }
 
@@ -597,6 +677,71 @@ func (v *gameView) Render() error {
 	return nil
 }
 
+// switchDiskSide inserts the next side of the disk image, going back to the
+// first one after the last.
+func (v *gameView) switchDiskSide(console *nes.Console) error {
+	sides := console.DiskSides()
+	if sides == 0 {
+		return nil
+	}
+
+	side := (console.DiskSide() + 1) % sides
+	if err := console.InsertDisk(side); err != nil {
+		return err
+	}
+
+	v.SetFlashMsg(diskSideName(side))
+	return nil
+}
+
+// insertCoin drops a coin in the given slot, for VS System games.
+func (v *gameView) insertCoin(console *nes.Console, slot int) error {
+	if info, ok := console.CartridgeInfo(); !ok || info.ConsoleType != nes.VSSystem {
+		return nil
+	}
+
+	if err := console.InsertCoin(slot); err != nil {
+		return err
+	}
+
+	v.SetFlashMsg(fmt.Sprintf("Coin %d", slot+1))
+	return nil
+}
+
+// switchTrack plays the NSF track delta tracks away from the current one in
+// the playlist, wrapping around at both ends.
+func (v *gameView) switchTrack(console *nes.Console, delta int) error {
+	info, ok := console.NSF()
+	if !ok {
+		return nil
+	}
+
+	pos := 0
+	for i, track := range info.Playlist {
+		if track == console.Track() {
+			pos = i
+			break
+		}
+	}
+	n := len(info.Playlist)
+	track := info.Playlist[(pos+delta%n+n)%n]
+	if err := console.PlayTrack(track); err != nil {
+		return err
+	}
+
+	v.SetFlashMsg(fmt.Sprintf("Track %d", track+1))
+	return nil
+}
+
+// diskSideName returns the name of a disk side as printed on the label, 1A,
+// 1B, 2A and so on.
+func diskSideName(side int) string {
+	if side < 0 {
+		return "ejected"
+	}
+	return fmt.Sprintf("%d%c", side/2+1, 'A'+side%2)
+}
+
 func boolToStr(v bool) string {
 	if v {
 		return "yes"
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/flga/nes/nes"
+)
+
+type checksumsJSON struct {
+	CRC32 string `json:"crc32"`
+	SHA1  string `json:"sha1"`
+}
+
+func newChecksumsJSON(c nes.Checksums) *checksumsJSON {
+	if c.SHA1 == "" {
+		return nil
+	}
+	return &checksumsJSON{CRC32: fmt.Sprintf("%08X", c.CRC32), SHA1: c.SHA1}
+}
+
+// infoJSON is what `vnes info -json` prints for every rom, one per line. Roms
+// that can't be read only get the path and an error.
+type infoJSON struct {
+	Path string `json:"path"`
+
+	Format     string `json:"format,omitempty"`
+	Title      string `json:"title,omitempty"`
+	InDatabase bool   `json:"inDatabase"`
+	Overridden bool   `json:"overridden"`
+
+	Mapper    uint16 `json:"mapper"`
+	Submapper byte   `json:"submapper"`
+	Supported bool   `json:"supported"`
+
+	PRGROMSize   int `json:"prgROMSize"`
+	CHRROMSize   int `json:"chrROMSize"`
+	PRGRAMSize   int `json:"prgRAMSize"`
+	PRGNVRAMSize int `json:"prgNVRAMSize"`
+	CHRRAMSize   int `json:"chrRAMSize"`
+	CHRNVRAMSize int `json:"chrNVRAMSize"`
+
+	Mirroring string `json:"mirroring,omitempty"`
+	Battery   bool   `json:"battery"`
+	Trainer   bool   `json:"trainer"`
+	Region    string `json:"region,omitempty"`
+	Console   string `json:"console,omitempty"`
+	DiskSides int    `json:"diskSides,omitempty"`
+
+	File *checksumsJSON `json:"file,omitempty"`
+	PRG  *checksumsJSON `json:"prg,omitempty"`
+	CHR  *checksumsJSON `json:"chr,omitempty"`
+}
+
+func mirroring(info nes.RomInfo) string {
+	switch {
+	case info.FourScreen:
+		return "four-screen"
+	case info.VerticalMirroring:
+		return "vertical"
+	default:
+		return "horizontal"
+	}
+}
+
+func printInfoJSON(w io.Writer, path string, info nes.RomInfo, err error) error {
+	enc := json.NewEncoder(w)
+	if err != nil {
+		return enc.Encode(struct {
+			Path  string `json:"path"`
+			Error string `json:"error"`
+		}{path, err.Error()})
+	}
+
+	return enc.Encode(infoJSON{
+		Path:         path,
+		Format:       info.Format.String(),
+		Title:        info.Title,
+		InDatabase:   info.InDatabase,
+		Overridden:   info.Overridden,
+		Mapper:       info.Mapper,
+		Submapper:    info.Submapper,
+		Supported:    info.Supported,
+		PRGROMSize:   info.PRGROMSize,
+		CHRROMSize:   info.CHRROMSize,
+		PRGRAMSize:   info.PRGRAMSize,
+		PRGNVRAMSize: info.PRGNVRAMSize,
+		CHRRAMSize:   info.CHRRAMSize,
+		CHRNVRAMSize: info.CHRNVRAMSize,
+		Mirroring:    mirroring(info),
+		Battery:      info.Battery,
+		Trainer:      info.Trainer,
+		Region:       info.Timing.String(),
+		Console:      info.ConsoleType.String(),
+		DiskSides:    info.DiskSides,
+		File:         newChecksumsJSON(info.File),
+		PRG:          newChecksumsJSON(info.PRG),
+		CHR:          newChecksumsJSON(info.CHR),
+	})
+}
+
+func printInfo(w io.Writer, path string, info nes.RomInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	field := func(name string, value interface{}) {
+		fmt.Fprintf(tw, "  %s\t%v\n", name, value)
+	}
+	size := func(n int) string {
+		switch {
+		case n == 0:
+			return "-"
+		case n%1024 != 0:
+			return fmt.Sprintf("%dB", n)
+		default:
+			return fmt.Sprintf("%dK", n/1024)
+		}
+	}
+	sums := func(name string, c nes.Checksums) {
+		if c.SHA1 != "" {
+			field(name, fmt.Sprintf("crc32 %08X  sha1 %s", c.CRC32, c.SHA1))
+		}
+	}
+
+	fmt.Fprintln(tw, path)
+	field("format", info.Format)
+	if info.InDatabase {
+		overridden := ""
+		if info.Overridden {
+			overridden = ", header corrected"
+		}
+		field("database", info.Title+overridden)
+	} else {
+		field("database", "not found")
+	}
+	supported := "supported"
+	if !info.Supported {
+		supported = "unsupported"
+	}
+	field("mapper", fmt.Sprintf("%d.%d (%s)", info.Mapper, info.Submapper, supported))
+	field("prg rom", size(info.PRGROMSize))
+	field("chr rom", size(info.CHRROMSize))
+	field("prg ram", size(info.PRGRAMSize))
+	field("prg nvram", size(info.PRGNVRAMSize))
+	field("chr ram", size(info.CHRRAMSize))
+	field("chr nvram", size(info.CHRNVRAMSize))
+	field("mirroring", mirroring(info))
+	field("battery", info.Battery)
+	field("trainer", info.Trainer)
+	field("region", info.Timing)
+	field("console", info.ConsoleType)
+	if info.DiskSides > 0 {
+		field("disk sides", info.DiskSides)
+	}
+	sums("file", info.File)
+	sums("prg", info.PRG)
+	sums("chr", info.CHR)
+
+	return tw.Flush()
+}
+
+// infoCmd implements `vnes info [-json] rom...`. Roms that can't be read are
+// reported and skipped, the exit status tells whether any failed.
+func infoCmd(args []string) int {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	jsonOut := flags.Bool("json", false, "Print a JSON object per rom, one per line.")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vnes info [-json] rom...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	for i, path := range flags.Args() {
+		info, err := nes.Inspect(path)
+		if err != nil {
+			status = 1
+		}
+
+		if *jsonOut {
+			err = printInfoJSON(os.Stdout, path, info, err)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			continue
+		} else {
+			if i > 0 {
+				fmt.Println()
+			}
+			err = printInfo(os.Stdout, path, info)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	return status
+}
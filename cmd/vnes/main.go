@@ -51,7 +51,7 @@ func initTTF() (gui.FontMap, error) {
 	return fontMap, nil
 }
 
-func run(romPath string, trace bool, cpuprof, memprof string) error {
+func run(romPath, patchPath, biosPath string, dipSwitches uint, trace bool, cpuprof, memprof string) error {
 	var out io.Writer
 	if trace {
 		out = os.Stderr
@@ -75,11 +75,33 @@ func run(romPath string, trace bool, cpuprof, memprof string) error {
 	defer audioEngine.quit()
 
 	console := nes.NewConsole(float32(audioEngine.sampleRate()), 0, out)
+	defer func() {
+		if err := console.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}()
 
 	audioEngine.setChannel(console.AudioChannel())
 
+	if dipSwitches > 0xFF {
+		return fmt.Errorf("invalid DIP switches %#x, there are 8", dipSwitches)
+	}
+	console.SetDIPSwitches(byte(dipSwitches))
+
+	if biosPath != "" {
+		if err := console.LoadDiskBIOS(biosPath); err != nil {
+			return err
+		}
+	}
+
 	if romPath != "" {
-		console.LoadPath(romPath)
+		load := console.LoadPath
+		if patchPath != "" {
+			load = func(path string) error { return console.LoadPathWithPatch(path, patchPath) }
+		}
+		if err := load(romPath); err != nil {
+			return err
+		}
 	}
 
 	zoom := 4
@@ -128,18 +150,23 @@ func run(romPath string, trace bool, cpuprof, memprof string) error {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "info":
+			os.Exit(infoCmd(os.Args[2:]))
+		}
+	}
 
 	trace := flag.Bool("trace", false, "Print a trace of the CPU execution into stdout. WARNING: this is not fully implemented and will bug out graphics")
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to file")
 	memprofile := flag.String("memprofile", "", "write memory profile to file")
+	patch := flag.String("patch", "", "IPS, UPS or BPS patch to apply to the rom. By default a patch with the same name as the rom is used, if there is one.")
+	dip := flag.Uint("dip", 0, "DIP switches of VS System games, switch 1 is the least significant bit. For example 0x05 turns on switches 1 and 3.")
+	bios := flag.String("bios", "", "Famicom Disk System BIOS used to run .fds disk images. By default disksys.rom in the same directory as the disk image is used.")
 
 	flag.Parse()
 
-	// if cartridge.Mapper != 0 {
-	// 	panic(fmt.Sprintf("Unexpected mapper %d\n", cartridge.Mapper))
-	// }
-
-	if err := run(flag.Arg(0), *trace, *cpuprofile, *memprofile); err != nil {
+	if err := run(flag.Arg(0), *patch, *bios, *dip, *trace, *cpuprofile, *memprofile); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(2)
 	}
@@ -64,7 +64,7 @@ func Encode(data []byte) (string, error) {
 }
 
 func (a *asset) decode() {
-	decoder := base64.NewDecoder(base64.RawStdEncoding, strings.NewReader(a.data))
+	decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(a.data))
 	reader, err := gzip.NewReader(decoder)
 	if err != nil {
 		a.err = err
@@ -74,13 +74,16 @@ func (a *asset) decode() {
 }
 
 func (a *asset) Close() error {
+	if a.buf == nil {
+		return nil
+	}
 	return a.buf.Close()
 }
 
 func (a *asset) Read(p []byte) (n int, err error) {
 	a.decodeOnce.Do(a.decode)
 	if a.err != nil {
-		return 0, err
+		return 0, a.err
 	}
 
 	return a.buf.Read(p)
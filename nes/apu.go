@@ -1,7 +1,6 @@
 package nes
 
 import (
-	"fmt"
 	"io"
 	"math"
 
@@ -642,6 +641,10 @@ func (a *apu) clock(c *cpu) {
 
 	a.clockFC(c)
 
+	if c.cartridge != nil && c.cartridge.audio != nil {
+		c.cartridge.audio.sample(a.mixer.eOut)
+	}
+
 	a.mixer.mix(
 		a.pulse0.sample(),
 		a.pulse1.sample(),
@@ -665,17 +668,26 @@ type mixer struct {
 	t  *channel
 	n  *channel
 	d  *channel
+	e  []*channel // expansion audio from the cartridge, see setExpansion
 	m  *channel
 
-	filters []filter
-	cycles  uint64
-	divider uint64
+	eOut []float32 // output of the expansion channels, set by the cartridge
+
+	filters  []filter
+	cycles   uint64
+	divider  uint64
+	volume   float32 // of the mix
+	channels bool    // every channel is being recorded on its own
+
+	freq     float32
+	makeFile func(channel string) (io.WriteSeeker, error)
 }
 
 func newMixer(bufferSize int, freq float32, makeFile func(channel string) (io.WriteSeeker, error)) *mixer {
 	return &mixer{
 		Output:  make(chan float32, bufferSize),
 		divider: uint64(cpuFreq / float64(freq)),
+		volume:  1,
 		filters: []filter{
 			highpass(freq, 90),
 			highpass(freq, 440),
@@ -687,11 +699,48 @@ func newMixer(bufferSize int, freq float32, makeFile func(channel string) (io.Wr
 		n:  newChannel("noise", freq, makeFile),
 		d:  newChannel("dmc", freq, makeFile),
 		m:  newChannel("mix", freq, makeFile),
+
+		freq:     freq,
+		makeFile: makeFile,
+	}
+}
+
+// setExpansion replaces the expansion channels with the ones named, those of
+// the cartridge that was loaded. If every channel is being recorded, the new
+// ones are recorded too.
+func (m *mixer) setExpansion(names []string) error {
+	for _, e := range m.e {
+		if err := e.stopRecording(); err != nil {
+			return err
+		}
+	}
+
+	m.e = make([]*channel, len(names))
+	m.eOut = make([]float32, len(names))
+	for i, name := range names {
+		m.e[i] = newChannel(name, m.freq, m.makeFile)
+	}
+
+	if !m.channels || !m.m.recording {
+		return nil
+	}
+	for _, e := range m.e {
+		if err := e.startRecording(); err != nil {
+			return err
+		}
+		e.paused = m.m.paused
 	}
+
+	return nil
 }
 
-func (m *mixer) startRecording() error {
-	fmt.Println("startRecording")
+// startRecording records the mix, and every channel on its own if channels is
+// set.
+func (m *mixer) startRecording(channels bool) error {
+	m.channels = channels
+	if !channels {
+		return m.m.startRecording()
+	}
 	if err := m.p0.startRecording(); err != nil {
 		return err
 	}
@@ -707,6 +756,11 @@ func (m *mixer) startRecording() error {
 	if err := m.d.startRecording(); err != nil {
 		return err
 	}
+	for _, e := range m.e {
+		if err := e.startRecording(); err != nil {
+			return err
+		}
+	}
 	if err := m.m.startRecording(); err != nil {
 		return err
 	}
@@ -715,27 +769,30 @@ func (m *mixer) startRecording() error {
 }
 
 func (m *mixer) pauseRecording() {
-	fmt.Println("pauseRecording")
 	m.p0.pauseRecording()
 	m.p1.pauseRecording()
 	m.t.pauseRecording()
 	m.n.pauseRecording()
 	m.d.pauseRecording()
+	for _, e := range m.e {
+		e.pauseRecording()
+	}
 	m.m.pauseRecording()
 }
 
 func (m *mixer) unpauseRecording() {
-	fmt.Println("unpauseRecording")
 	m.p0.unpauseRecording()
 	m.p1.unpauseRecording()
 	m.t.unpauseRecording()
 	m.n.unpauseRecording()
 	m.d.unpauseRecording()
+	for _, e := range m.e {
+		e.unpauseRecording()
+	}
 	m.m.unpauseRecording()
 }
 
 func (m *mixer) stopRecording() error {
-	fmt.Println("stopRecording")
 	if err := m.p0.stopRecording(); err != nil {
 		return err
 	}
@@ -751,6 +808,11 @@ func (m *mixer) stopRecording() error {
 	if err := m.d.stopRecording(); err != nil {
 		return err
 	}
+	for _, e := range m.e {
+		if err := e.stopRecording(); err != nil {
+			return err
+		}
+	}
 	if err := m.m.stopRecording(); err != nil {
 		return err
 	}
@@ -766,7 +828,12 @@ func (m *mixer) mix(p0, p1, t, n, d byte) {
 		m.t.process(pulseTable[0] + tndTable[3*t])
 		m.n.process(pulseTable[0] + tndTable[2*n])
 		m.d.process(pulseTable[0] + tndTable[d])
-		out := pulseTable[p0+p1] + tndTable[3*t+2*n+d]
+		var e float32
+		for i, out := range m.eOut {
+			m.e[i].process(out)
+			e += out
+		}
+		out := (pulseTable[p0+p1] + tndTable[3*t+2*n+d] + e) * m.volume
 		for _, f := range m.filters {
 			out = f(out)
 		}
@@ -795,7 +862,6 @@ func newChannel(name string, freq float32, makeFile func(channel string) (io.Wri
 }
 
 func (c *channel) createEncoder() error {
-	fmt.Println(c.name, "createEncoder")
 	f, err := c.makeFile(c.name)
 	if err != nil {
 		return err
@@ -0,0 +1,99 @@
+package nes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConsole_RecordTo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vnes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.LoadRom(bytes.NewReader(testNSF([8]byte{}, make([]byte, 0x100)))); err != nil {
+		t.Fatalf("LoadRom() unexpected error %v", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-console.AudioChannel():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	prefix := filepath.Join(dir, "song")
+	if err := console.RecordTo(prefix, false); err != nil {
+		t.Fatalf("RecordTo() unexpected error %v", err)
+	}
+	console.StepFrame()
+	if err := console.Close(); err != nil {
+		t.Fatalf("Close() unexpected error %v", err)
+	}
+
+	if _, err := os.Stat(prefix + ".wav"); err != nil {
+		t.Errorf("want the mix recorded: %v", err)
+	}
+	if _, err := os.Stat(prefix + "_pulse_0.wav"); !os.IsNotExist(err) {
+		t.Errorf("want only the mix recorded, got the channels too")
+	}
+}
+
+func TestConsole_RecordToExpansion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vnes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rom := testNSF([8]byte{}, make([]byte, 0x100))
+	rom[0x7B] = nsfVRC6 | nsf5B
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.LoadRom(bytes.NewReader(rom)); err != nil {
+		t.Fatalf("LoadRom() unexpected error %v", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-console.AudioChannel():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	prefix := filepath.Join(dir, "song")
+	if err := console.RecordTo(prefix, true); err != nil {
+		t.Fatalf("RecordTo() unexpected error %v", err)
+	}
+	console.StepFrame()
+	if err := console.Close(); err != nil {
+		t.Fatalf("Close() unexpected error %v", err)
+	}
+
+	// every voice of every chip gets its own file
+	for _, name := range append(vrc6Channels, sunsoft5BChannels...) {
+		if _, err := os.Stat(prefix + "_" + name + ".wav"); err != nil {
+			t.Errorf("want %s recorded: %v", name, err)
+		}
+	}
+	for _, name := range append(fdsChannels, n163Channels...) {
+		if _, err := os.Stat(prefix + "_" + name + ".wav"); !os.IsNotExist(err) {
+			t.Errorf("want %s not recorded, the tune doesn't use it", name)
+		}
+	}
+}
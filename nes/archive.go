@@ -0,0 +1,168 @@
+package nes
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	zipMagic  = []byte{'P', 'K', 0x03, 0x04}
+	gzipMagic = []byte{0x1F, 0x8B}
+)
+
+// romExts are the extensions considered to be roms when looking inside
+// archives.
+var romExts = []string{".nes", ".fds", ".unf", ".unif", ".nsf", ".nsfe"}
+
+// readCloser closes all of closers, in order, when closed.
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// openRom opens the rom at path, transparently decompressing it if it is a
+// gzip file or picking the rom inside if it is a zip archive.
+func openRom(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open rom: %s", err)
+	}
+
+	magic := make([]byte, 4)
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		f.Close()
+		return nil, fmt.Errorf("unable to read rom: %s", err)
+	}
+	magic = magic[:n]
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("unable to read rom: %s", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, zipMagic):
+		r, err := openZip(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		return &readCloser{Reader: r, closers: []io.Closer{r, f}}, nil
+
+	case bytes.HasPrefix(magic, gzipMagic):
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("unable to read gzip: %s", err)
+		}
+		return &readCloser{Reader: r, closers: []io.Closer{r, f}}, nil
+	}
+
+	return f, nil
+}
+
+// openZip opens the only rom in the archive. Entries with a rom extension are
+// preferred, if there are none the entries starting with the iNES magic are
+// considered instead.
+func openZip(f *os.File) (io.ReadCloser, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read zip: %s", err)
+	}
+
+	z, err := zip.NewReader(f, stat.Size())
+	if err != nil {
+		return nil, fmt.Errorf("unable to read zip: %s", err)
+	}
+
+	var candidates []*zip.File
+	for _, zf := range z.File {
+		if isRomName(zf.Name) {
+			candidates = append(candidates, zf)
+		}
+	}
+
+	if len(candidates) == 0 {
+		for _, zf := range z.File {
+			ok, err := hasINESMagic(zf)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read %s: %s", zf.Name, err)
+			}
+			if ok {
+				candidates = append(candidates, zf)
+			}
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("no rom found in archive")
+	case 1:
+		return candidates[0].Open()
+	default:
+		var names []string
+		for _, c := range candidates {
+			names = append(names, c.Name)
+		}
+		return nil, fmt.Errorf("archive has %d roms, expected only one: %s", len(names), strings.Join(names, ", "))
+	}
+}
+
+func isRomName(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range romExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+func hasINESMagic(zf *zip.File) (bool, error) {
+	if zf.FileInfo().IsDir() {
+		return false, nil
+	}
+
+	r, err := zf.Open()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	magic := make([]byte, len(inesMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return false, nil
+	}
+
+	return bytes.Equal(magic, inesMagic), nil
+}
+
+// trimRomExt strips the extension from path, along with the one of the
+// compressed file for gzipped roms, so both "game.nes.gz" and "game.zip"
+// become "game".
+func trimRomExt(path string) string {
+	ext := filepath.Ext(path)
+	path = strings.TrimSuffix(path, ext)
+	if strings.EqualFold(ext, ".gz") {
+		path = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+
+	return path
+}
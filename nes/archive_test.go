@@ -0,0 +1,119 @@
+package nes
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testRom() []byte {
+	rom := []byte{'N', 'E', 'S', 0x1a, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	return append(rom, make([]byte, prgMul+chrMul)...)
+}
+
+func writeZip(t *testing.T, path string, files map[string][]byte) {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsole_LoadPathArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vnes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gz := &bytes.Buffer{}
+	w := gzip.NewWriter(gz)
+	w.Write(testRom())
+	w.Close()
+	if err := ioutil.WriteFile(filepath.Join(dir, "game.nes.gz"), gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	writeZip(t, filepath.Join(dir, "single.zip"), map[string][]byte{
+		"readme.txt": []byte("hi"),
+		"Game.NES":   testRom(),
+	})
+	writeZip(t, filepath.Join(dir, "noext.zip"), map[string][]byte{
+		"readme.txt": []byte("hi"),
+		"game.bin":   testRom(),
+	})
+	writeZip(t, filepath.Join(dir, "empty.zip"), map[string][]byte{
+		"readme.txt": []byte("hi"),
+	})
+	writeZip(t, filepath.Join(dir, "multiple.zip"), map[string][]byte{
+		"game (U).nes": testRom(),
+		"game (E).nes": testRom(),
+	})
+
+	tests := []struct {
+		file    string
+		wantErr string
+	}{
+		{"game.nes.gz", ""},
+		{"single.zip", ""},
+		{"noext.zip", ""},
+		{"empty.zip", "no rom found"},
+		{"multiple.zip", "archive has 2 roms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			console := NewConsole(44100, 0, nil)
+			err := console.LoadPath(filepath.Join(dir, tt.file))
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadPath() unexpected error %v", err)
+				}
+				if console.Empty() {
+					t.Fatalf("LoadPath() did not load the rom")
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadPath() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrimRomExt(t *testing.T) {
+	tests := map[string]string{
+		"dir/game.nes":    "dir/game",
+		"dir/game.nes.gz": "dir/game",
+		"dir/game.zip":    "dir/game",
+		"dir/my.game.zip": "dir/my.game",
+	}
+
+	for path, want := range tests {
+		if got := trimRomExt(path); got != want {
+			t.Errorf("trimRomExt(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package nes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestRom(t *testing.T, dir string, flags6 byte) string {
+	t.Helper()
+
+	rom := []byte{'N', 'E', 'S', 0x1a, 1, 1, flags6, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	rom = append(rom, make([]byte, prgMul+chrMul)...)
+
+	path := filepath.Join(dir, "test.nes")
+	if err := ioutil.WriteFile(path, rom, 0644); err != nil {
+		t.Fatalf("unable to write rom: %v", err)
+	}
+
+	return path
+}
+
+func TestConsole_BatterySave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vnes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	romPath := writeTestRom(t, dir, rc1SaveRAM)
+	savePath := filepath.Join(dir, "test.sav")
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.LoadPath(romPath); err != nil {
+		t.Fatalf("LoadPath() unexpected error %v", err)
+	}
+	if _, err := os.Stat(savePath); !os.IsNotExist(err) {
+		t.Fatalf("save file was created before anything changed")
+	}
+
+	console.Write(0x6000, 0x42)
+	console.Write(0x7FFF, 0x24)
+	if err := console.Close(); err != nil {
+		t.Fatalf("Close() unexpected error %v", err)
+	}
+
+	data, err := ioutil.ReadFile(savePath)
+	if err != nil {
+		t.Fatalf("unable to read save file: %v", err)
+	}
+	if len(data) != sramSize || data[0] != 0x42 || data[sramSize-1] != 0x24 {
+		t.Fatalf("save file has the wrong contents")
+	}
+
+	console = NewConsole(44100, 0, nil)
+	if err := console.LoadPath(romPath); err != nil {
+		t.Fatalf("LoadPath() unexpected error %v", err)
+	}
+	if got := console.Read(0x6000); got != 0x42 {
+		t.Errorf("after reload: $6000 = %02X, want %02X", got, 0x42)
+	}
+	if got := console.Read(0x7FFF); got != 0x24 {
+		t.Errorf("after reload: $7FFF = %02X, want %02X", got, 0x24)
+	}
+}
+
+func TestConsole_BatteryReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vnes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	romPath := writeTestRom(t, dir, rc1SaveRAM)
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.LoadPath(romPath); err != nil {
+		t.Fatalf("LoadPath() unexpected error %v", err)
+	}
+	console.Write(0x6000, 0x42)
+
+	// the same console loads the rom again before anything was saved
+	if err := console.LoadPath(romPath); err != nil {
+		t.Fatalf("LoadPath() unexpected error %v", err)
+	}
+	if got := console.Read(0x6000); got != 0x42 {
+		t.Errorf("after reload: $6000 = %02X, want %02X", got, 0x42)
+	}
+
+	if err := console.Close(); err != nil {
+		t.Fatalf("Close() unexpected error %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "test.sav"))
+	if err != nil {
+		t.Fatalf("unable to read save file: %v", err)
+	}
+	if data[0] != 0x42 {
+		t.Errorf("save file: $6000 = %02X, want %02X", data[0], 0x42)
+	}
+}
+
+func TestConsole_NoBattery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vnes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	romPath := writeTestRom(t, dir, 0)
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.LoadPath(romPath); err != nil {
+		t.Fatalf("LoadPath() unexpected error %v", err)
+	}
+
+	console.Write(0x6000, 0x42)
+	if got := console.Read(0x6000); got != 0x42 {
+		t.Errorf("$6000 = %02X, want %02X", got, 0x42)
+	}
+	if err := console.Close(); err != nil {
+		t.Fatalf("Close() unexpected error %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "test.sav")); !os.IsNotExist(err) {
+		t.Errorf("save file was created for a cartridge without a battery")
+	}
+}
+
+func TestConsole_TrainerWithBattery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vnes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	trainer := make([]byte, trainerLen)
+	for i := range trainer {
+		trainer[i] = 0xEA
+	}
+	rom := []byte{'N', 'E', 'S', 0x1a, 1, 1, rc1SaveRAM | rc1Trainer, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	rom = append(rom, trainer...)
+	rom = append(rom, make([]byte, prgMul+chrMul)...)
+	romPath := filepath.Join(dir, "test.nes")
+	if err := ioutil.WriteFile(romPath, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	save := make([]byte, sramSize)
+	save[0x0000] = 0x42
+	save[0x1000] = 0x24 // overlaps the trainer
+	save[0x1200] = 0x66 // right after it
+	savePath := filepath.Join(dir, "test.sav")
+	if err := ioutil.WriteFile(savePath, save, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.LoadPath(romPath); err != nil {
+		t.Fatalf("LoadPath() unexpected error %v", err)
+	}
+
+	for _, tt := range []struct {
+		addr uint16
+		want byte
+	}{{0x6000, 0x42}, {0x7000, 0xEA}, {0x71FF, 0xEA}, {0x7200, 0x66}} {
+		if got := console.Read(tt.addr); got != tt.want {
+			t.Errorf("$%04X = %02X, want %02X", tt.addr, got, tt.want)
+		}
+	}
+
+	// mapping the trainer alone doesn't make the save dirty
+	if err := console.Close(); err != nil {
+		t.Fatalf("Close() unexpected error %v", err)
+	}
+	data, err := ioutil.ReadFile(savePath)
+	if err != nil {
+		t.Fatalf("unable to read save file: %v", err)
+	}
+	if data[0x1000] != 0x24 {
+		t.Errorf("save file was rewritten without changes")
+	}
+
+	console.Write(0x7000, 0x00)
+	console.Reset()
+	if got := console.Read(0x7000); got != 0xEA {
+		t.Errorf("after reset: $7000 = %02X, want %02X", got, 0xEA)
+	}
+
+	// once something changes the save has the trainer in it
+	console.Write(0x6000, 0x43)
+	if err := console.Close(); err != nil {
+		t.Fatalf("Close() unexpected error %v", err)
+	}
+	data, err = ioutil.ReadFile(savePath)
+	if err != nil {
+		t.Fatalf("unable to read save file: %v", err)
+	}
+	if data[0x0000] != 0x43 || data[0x1000] != 0xEA || data[0x1200] != 0x66 {
+		t.Errorf("save file = %02X %02X %02X, want 43 EA 66", data[0x0000], data[0x1000], data[0x1200])
+	}
+}
+
+func TestLoadRom_TrainerSmallPRGRAM(t *testing.T) {
+	trainer := make([]byte, trainerLen)
+	for i := range trainer {
+		trainer[i] = 0xEA
+	}
+	// NES 2.0 with 128 bytes of PRG-RAM
+	rom := []byte{'N', 'E', 'S', 0x1a, 1, 1, rc1Trainer, 0x08, 0, 0, 0x01, 0, 0, 0, 0, 0}
+	rom = append(rom, trainer...)
+	rom = append(rom, make([]byte, prgMul+chrMul)...)
+
+	c, err := loadRom(bytes.NewReader(rom))
+	if err != nil {
+		t.Fatalf("loadRom() unexpected error %v", err)
+	}
+	if len(c.prgRAM) != sramSize {
+		t.Errorf("len(prgRAM) = %d, want %d", len(c.prgRAM), sramSize)
+	}
+	if got := c.read(0x7000); got != 0xEA {
+		t.Errorf("$7000 = %02X, want %02X", got, 0xEA)
+	}
+}
@@ -0,0 +1,187 @@
+package nes
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// runBlargg runs one of blargg's test roms until it reports its result at
+// $6000, failing the test with the text the rom printed if it didn't pass.
+//
+// The protocol is: $6001-$6003 hold DE B0 61 once the result is valid, $6000
+// is $80 while the test is running, $81 when it wants to be reset and the
+// final status code otherwise. $6004 holds a zero terminated message.
+func runBlargg(t *testing.T, path string) {
+	t.Helper()
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		t.Skipf("rom not found: %s", path)
+	}
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.LoadPath(path); err != nil {
+		t.Fatalf("unable to load rom: %v", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-console.AudioChannel():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	valid := func() bool {
+		return console.Read(0x6001) == 0xDE && console.Read(0x6002) == 0xB0 && console.Read(0x6003) == 0x61
+	}
+
+	const maxFrames = 60 * 60
+	var status byte = 0x80
+	for frame := 0; frame < maxFrames; frame++ {
+		console.StepFrame()
+		if !valid() {
+			continue
+		}
+
+		status = console.Read(0x6000)
+		if status == 0x81 {
+			// the rom wants at least 100ms before the reset
+			for i := 0; i < 10; i++ {
+				console.StepFrame()
+			}
+			console.Reset()
+			continue
+		}
+		if status != 0x80 {
+			break
+		}
+	}
+
+	if status == 0x80 || status == 0x81 {
+		t.Fatalf("%s: timed out", path)
+	}
+
+	var msg []byte
+	for addr := uint16(0x6004); addr < 0x7000; addr++ {
+		b := console.Read(addr)
+		if b == 0 {
+			break
+		}
+		msg = append(msg, b)
+	}
+
+	if status != 0 {
+		t.Errorf("%s: status %d\n%s", path, status, msg)
+	}
+}
+
+// runBlarggScreen runs one of blargg's older test roms, the ones that only
+// print their result on screen, until they print whether they passed.
+func runBlarggScreen(t *testing.T, path string) {
+	t.Helper()
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		t.Skipf("rom not found: %s", path)
+	}
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.LoadPath(path); err != nil {
+		t.Fatalf("unable to load rom: %v", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-console.AudioChannel():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	const maxFrames = 60 * 60
+	for frame := 0; frame < maxFrames; frame++ {
+		console.StepFrame()
+		if frame%60 != 0 {
+			continue
+		}
+
+		text := screenText(console)
+		if strings.Contains(text, "Passed") {
+			return
+		}
+		if strings.Contains(text, "Failed") {
+			t.Fatalf("%s:\n%s", path, text)
+		}
+	}
+
+	t.Fatalf("%s: timed out\n%s", path, screenText(console))
+}
+
+// screenText returns the text on the first nametable, the test roms use the
+// ASCII code of a character as its tile number.
+func screenText(console *Console) string {
+	var lines []string
+	for row := uint16(0); row < 30; row++ {
+		line := make([]byte, 32)
+		for col := range line {
+			b := console.ppu.readNametable(0x2000 + row*32 + uint16(col))
+			if b < 0x20 || b > 0x7E {
+				b = ' '
+			}
+			line[col] = b
+		}
+		if l := strings.TrimRight(string(line), " "); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCPU_DummyReads(t *testing.T) {
+	runBlarggScreen(t, "../roms/cpu/cpu_dummy_reads/cpu_dummy_reads.nes")
+}
+
+func TestCPU_DummyWrites(t *testing.T) {
+	for _, rom := range []string{"cpu_dummy_writes_oam.nes", "cpu_dummy_writes_ppumem.nes"} {
+		t.Run(rom, func(t *testing.T) {
+			runBlargg(t, "../roms/cpu/cpu_dummy_writes/"+rom)
+		})
+	}
+}
+
+func TestCPU_Unofficial(t *testing.T) {
+	for _, rom := range []string{
+		"instr_test-v5/rom_singles/01-basics.nes",
+		"instr_test-v5/rom_singles/02-implied.nes",
+		"instr_test-v5/rom_singles/03-immediate.nes",
+		"instr_test-v5/rom_singles/04-zero_page.nes",
+		"instr_test-v5/rom_singles/05-zp_xy.nes",
+		"instr_test-v5/rom_singles/06-absolute.nes",
+		"instr_test-v5/rom_singles/07-abs_xy.nes",
+		"instr_test-v5/rom_singles/08-ind_x.nes",
+		"instr_test-v5/rom_singles/09-ind_y.nes",
+		"instr_test-v5/rom_singles/10-branches.nes",
+		"instr_test-v5/rom_singles/11-stack.nes",
+		"instr_test-v5/rom_singles/12-jmp_jsr.nes",
+		"instr_test-v5/rom_singles/13-rts.nes",
+		"instr_test-v5/rom_singles/14-rti.nes",
+		"instr_test-v5/rom_singles/15-brk.nes",
+		"instr_test-v5/rom_singles/16-special.nes",
+		"instr_misc/rom_singles/01-abs_x_wrap.nes",
+		"instr_misc/rom_singles/02-branch_wrap.nes",
+		"instr_misc/rom_singles/03-dummy_reads.nes",
+		"instr_misc/rom_singles/04-dummy_reads_apu.nes",
+	} {
+		t.Run(rom, func(t *testing.T) {
+			runBlargg(t, "../roms/cpu/"+rom)
+		})
+	}
+}
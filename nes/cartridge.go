@@ -2,17 +2,18 @@ package nes
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
-	"fmt"
 	"io"
-	"log"
 )
 
 const (
 	trainerLen = 512
 	prgMul     = 1024 * 16
 	chrMul     = 1024 * 8
+
+	// maxROMSize bounds the PRG and CHR sizes in headers, the largest NES 2.0
+	// sizes that don't use the exponent form are just under it.
+	maxROMSize = 64 * 1024 * 1024
 )
 
 const (
@@ -25,6 +26,8 @@ const (
 var (
 	inesMagic  = []byte{'N', 'E', 'S', 0x1A}
 	errNoMagic = errors.New("nes: invalid magic in header")
+	errNoPRG   = errors.New("nes: the rom has no PRG")
+	errROMSize = errors.New("nes: the PRG or CHR size is too big")
 )
 
 type mirrorMode int
@@ -33,143 +36,230 @@ const (
 	horizontal mirrorMode = iota
 	vertical
 	quad
+	singleScreenLow
+	singleScreenHigh
 )
 
 type cartridge struct {
+	info CartridgeInfo
+
 	mirrorMode mirrorMode
-	saveRAM    bool //TODO
+	saveRAM    bool
 	fourScreen bool
-	mapper     byte
+	mapperNum  uint16
+	mapper     Mapper
+	nametables nametableMapper // nil unless the mapper implements it
+	audio      audioMapper     // nil unless the mapper implements it
 
 	trainer []byte
 	prg     []byte
 	chr     []byte
+	chrRAM  bool // chr is writable
+	prgRAM  []byte
+}
+
+// romFile is the parsed contents of a rom file.
+type romFile struct {
+	info       CartridgeInfo
+	mirrorMode mirrorMode
+	trainer    []byte
+	prg        []byte
+	chr        []byte
+	chrRAM     bool // chr is RAM, it's not part of the file
 }
 
 func loadRom(r io.Reader) (*cartridge, error) {
-	type header struct {
-		// String "NES^Z" used to recognize .NES files.
-		Magic [4]byte
-
-		// Number of 16kB ROM banks.
-		ROMBanks byte
-
-		// Number of 8kB VROM banks.
-		CHROMBanks byte
-
-		// 76543210
-		// ||||||||
-		// |||||||+- Mirroring: 0: horizontal (vertical arrangement)
-		// |||||||                 (CIRAM A10 = PPU A11)
-		// |||||||              1: vertical (horizontal arrangement)
-		// |||||||                 (CIRAM A10 = PPU A10)
-		// ||||||+-- 1: Cartridge contains battery-backed
-		// ||||||       PRG RAM ($6000-7FFF) or other persistent memory
-		// |||||+--- 1: 512-byte trainer at $7000-$71FF (stored before PRG data)
-		// ||||+---- 1: Ignore mirroring control or above mirroring bit;
-		// ||||         instead provide four-screen VRAM
-		// ++++----- Lower nybble of mapper number
-		ROMControl1 byte
-
-		// 76543210
-		// ||||||||
-		// |||||||+- VS Unisystem
-		// ||||||+-- PlayChoice10, 8KB of Hint Screen data stored after CHR data
-		// ||||++--- If equal to 2, flags 8-15 are in NES 2.0 format
-		// ++++----- Upper nybble of mapper number
-		ROMControl2 byte
-
-		// Number of 8kB RAM banks. For compatibility with the previous
-		// versions of the .NES format, assume 1x8kB RAM page when this
-		// byte is zero.
-		PRGRAMSize byte
-
-		// Reserved, must be zeroes!
-		_ [7]byte
-	}
-	var h header
-	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
-		return nil, fmt.Errorf("nes: unable to read header: %s", err)
-	}
-
-	if !bytes.Equal(h.Magic[:], inesMagic) {
-		return nil, errNoMagic
+	f, err := parseRom(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCartridge(f)
+}
+
+// parseRom reads an iNES, NES 2.0 or UNIF rom, with the header corrected by
+// the game database.
+func parseRom(r io.Reader) (*romFile, error) {
+	magic := make([]byte, len(unifMagic))
+	n, _ := io.ReadFull(r, magic)
+	if n == len(unifMagic) && bytes.Equal(magic, unifMagic) {
+		return parseUNIF(r)
+	}
+	r = io.MultiReader(bytes.NewReader(magic[:n]), r)
+
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	info := h.info()
+	if info.PRGROMSize == 0 {
+		return nil, errNoPRG
+	}
+	if info.PRGROMSize > maxROMSize || info.CHRROMSize > maxROMSize {
+		return nil, errROMSize
 	}
 
 	var trainer []byte
-	if h.ROMControl1&rc1Trainer > 0 {
+	if info.Trainer {
 		trainer = make([]byte, trainerLen)
 		if _, err := io.ReadFull(r, trainer); err != nil {
 			return nil, err
 		}
 	}
 
-	prg := make([]byte, int(h.ROMBanks)*prgMul)
+	prg := make([]byte, info.PRGROMSize)
 	if _, err := io.ReadFull(r, prg); err != nil {
 		return nil, err
 	}
 
 	var chr []byte
-	if h.CHROMBanks == 0 {
-		chr = make([]byte, chrMul)
+	chrRAM := info.CHRROMSize == 0
+	if chrRAM {
+		size := info.CHRRAMSize + info.CHRNVRAMSize
+		if size < chrMul {
+			size = chrMul
+		}
+		chr = make([]byte, size)
 	} else {
-		chr = make([]byte, int(h.CHROMBanks)*chrMul)
+		chr = make([]byte, info.CHRROMSize)
 		if _, err := io.ReadFull(r, chr); err != nil {
 			return nil, err
 		}
 	}
 
+	chrROM := chr
+	if chrRAM {
+		chrROM = nil
+	}
+	if err := applyGameDB(&info, prg, chrROM); err != nil {
+		return nil, err
+	}
+
 	mirrorMode := horizontal
-	if h.ROMControl1&rc1MirrorModeVertical > 0 {
+	if info.VerticalMirroring {
 		mirrorMode = vertical
 	}
-
-	fourScreen := h.ROMControl1&rc1FourScreen > 0
-	if fourScreen {
+	if info.FourScreen {
 		mirrorMode = quad
 	}
 
-	saveRAM := h.ROMControl1&rc1SaveRAM > 0
-
-	mapper := h.ROMControl1>>4 | (h.ROMControl2 & 0xF0)
-
-	return &cartridge{
+	return &romFile{
+		info:       info,
 		mirrorMode: mirrorMode,
-		saveRAM:    saveRAM,
 		trainer:    trainer,
-		fourScreen: fourScreen,
-		mapper:     mapper,
 		prg:        prg,
 		chr:        chr,
+		chrRAM:     chrRAM,
 	}, nil
 }
 
+// newCartridge puts together a cartridge and its mapper from a rom file.
+func newCartridge(f *romFile) (*cartridge, error) {
+	info := f.info
+
+	c := &cartridge{
+		info:       info,
+		mirrorMode: f.mirrorMode,
+		saveRAM:    info.Battery,
+		trainer:    f.trainer,
+		fourScreen: info.FourScreen,
+		mapperNum:  info.Mapper,
+		prg:        f.prg,
+		chr:        f.chr,
+		chrRAM:     f.chrRAM,
+		prgRAM:     make([]byte, prgRAMSize(info)),
+	}
+
+	c.mapTrainer()
+
+	mapper, err := newMapper(c)
+	if err != nil {
+		return nil, err
+	}
+	c.mapper = mapper
+	c.nametables, _ = mapper.(nametableMapper)
+	c.audio, _ = mapper.(audioMapper)
+
+	return c, nil
+}
+
+// prgRAMSize returns how much PRG-RAM the board described by info has.
+func prgRAMSize(info CartridgeInfo) int {
+	// iNES 1.0 only knows about 8K, the MMC5 games that bank their RAM need
+	// up to 64K
+	if info.Mapper == 5 && (info.Format == INES || info.Format == ArchaicINES) {
+		return mmc5PRGRAMSize
+	}
+
+	// boards that declare no PRG-RAM still get the default, so that mappers
+	// don't have to special case it
+	size := info.PRGRAMSize + info.PRGNVRAMSize
+	if size == 0 {
+		return sramSize
+	}
+	// the trainer goes at $7000, so it needs the whole 8K
+	if info.Trainer && size < sramSize {
+		return sramSize
+	}
+	// the VS System always has its 2K, whatever the header says
+	if info.Mapper == 99 && size < vsPRGRAMSize {
+		return vsPRGRAMSize
+	}
+
+	return size
+}
+
+// mapTrainer copies the trainer to $7000-$71FF, where the copiers it was
+// dumped for used to put it, so that the code the game jumps to is there.
+// Boards with a trainer always get 8K of PRG-RAM for it.
+//
+// On battery backed boards the trainer is part of the RAM that is saved, as
+// it was on the copiers, and it is mapped again over the save on load.
+func (c *cartridge) mapTrainer() {
+	const offset = 0x7000 - 0x6000
+	if len(c.trainer) == 0 || len(c.prgRAM) < offset+trainerLen {
+		return
+	}
+
+	copy(c.prgRAM[offset:], c.trainer)
+}
+
 func (c *cartridge) read(address uint16) byte {
-	switch {
-	case address < 0x2000:
-		// fmt.Printf("%04X\n", address)
-		return c.chr[address]
-	case address >= 0x8000:
-		return c.prg[int(address-0x8000)%len(c.prg)]
-	case address >= 0x6000:
-		// TODO: SRAM
-	default:
-		log.Fatalf("unhandled cartridge read at address: 0x%04X", address)
-	}
-	return 0
+	if address < 0x2000 {
+		return c.mapper.ppuRead(address)
+	}
 
+	return c.mapper.cpuRead(address)
 }
 
 func (c *cartridge) write(address uint16, value byte) {
-	switch {
-	case address < 0x2000:
-		// c.CHR[address] = value
-	case address >= 0x8000:
-		// c.PRG[int(address-0x8000)%len(c.PRG)] = value
-	case address >= 0x6000:
-		// TODO: SRAM
-	default:
-		log.Fatalf("unhandled cartridge write at address: 0x%04X", address)
+	if address < 0x2000 {
+		c.mapper.ppuWrite(address, value)
+		return
 	}
 
+	c.mapper.cpuWrite(address, value)
+}
+
+// ppuRegisterWrite lets boards that watch the PPU registers see a CPU write to
+// $2000-$3FFF.
+func (c *cartridge) ppuRegisterWrite(address uint16, value byte) {
+	if w, ok := c.mapper.(ppuRegisterWatcher); ok {
+		w.ppuRegisterWrite(address, value)
+	}
+}
+
+// controllerPortWrite lets boards that use the controller port OUT lines see
+// a CPU write to $4016.
+func (c *cartridge) controllerPortWrite(value byte) {
+	if w, ok := c.mapper.(controllerPortWatcher); ok {
+		w.controllerPortWrite(value)
+	}
+}
+
+func (c *cartridge) clock(cpu *cpu) {
+	c.mapper.clock()
+	if c.mapper.irq() {
+		cpu.trigger(irq)
+	}
 }
@@ -1,12 +1,17 @@
 package nes
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 const (
@@ -16,6 +21,10 @@ const (
 	sramSize         = 8192
 	prgBankSize      = 16384
 	prgRomSize       = 16384 * 2 //TODO
+
+	// saveInterval is the number of frames between checks for changes in the
+	// battery backed RAM, so that a crash doesn't lose much progress.
+	saveInterval = 60 * 5
 )
 
 type Console struct {
@@ -30,11 +39,35 @@ type Console struct {
 	bus *sysBus
 
 	openFiles []*os.File
+
+	savePath   string
+	savedRAM   []byte // contents of the .sav file as of the last save
+	saveFrames int
+
+	diskBIOS []byte
+
+	recordPrefix string // of the wav files, see RecordTo
+
+	vs vsSystem
 }
 
 func NewConsole(sampleRate float32, pc uint16, debugOut io.Writer) *Console {
 	console := &Console{}
 	makeFile := func(channel string) (io.WriteSeeker, error) {
+		if prefix := console.recordPrefix; prefix != "" {
+			name := prefix + "_" + channel + ".wav"
+			if channel == "mix" {
+				name = prefix + ".wav"
+			}
+			f, err := os.Create(name)
+			if err != nil {
+				return nil, err
+			}
+
+			console.openFiles = append(console.openFiles, f)
+			return f, nil
+		}
+
 		name := "TODO"
 		dir, err := os.Getwd()
 		if err != nil {
@@ -86,11 +119,37 @@ func (c *Console) Empty() bool {
 	return c.cartridge == nil
 }
 
+// CartridgeInfo returns the header information of the loaded cartridge, ok is
+// false if there's none.
+func (c *Console) CartridgeInfo() (info CartridgeInfo, ok bool) {
+	if c.cartridge == nil {
+		return CartridgeInfo{}, false
+	}
+
+	return c.cartridge.info, true
+}
+
 func (c *Console) load(cartridge *cartridge) {
 	first := c.cartridge == nil
 	c.cartridge = cartridge
 	c.bus.cartridge = cartridge
 	c.ppu.cartridge = cartridge
+	c.cpu.cartridge = cartridge
+
+	c.ppu.setVariant(cartridge.info)
+
+	var expansion []string
+	if cartridge.audio != nil {
+		expansion = cartridge.audio.audioChannels()
+	}
+	if err := c.apu.mixer.setExpansion(expansion); err != nil {
+		log.Printf("%s", err)
+	}
+	c.bus.vs = nil
+	if cartridge.info.ConsoleType == VSSystem {
+		c.vs.coins = [2]int{}
+		c.bus.vs = &c.vs
+	}
 
 	if first {
 		c.cpu.init(c.bus)
@@ -100,34 +159,296 @@ func (c *Console) load(cartridge *cartridge) {
 	c.Reset()
 }
 
+// LoadPath loads the rom at path, applying the IPS, UPS or BPS patch with the
+// same name if there is one.
 func (c *Console) LoadPath(path string) error {
-	f, err := os.Open(path)
+	return c.LoadPathWithPatch(path, findPatch(path))
+}
+
+// LoadPathWithPatch loads the rom at path, applying the patch at patchPath to
+// it. If patchPath is empty the rom is loaded as is.
+func (c *Console) LoadPathWithPatch(path, patchPath string) error {
+	// flush the loaded cartridge first, the new one may read the same save
+	if err := c.save(); err != nil {
+		return err
+	}
+
+	f, err := openRom(path)
 	if err != nil {
-		return fmt.Errorf("unable to open rom: %s", err)
+		return err
 	}
 	defer f.Close()
 
-	cart, err := loadRom(f)
+	rom, err := ioutil.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("unable to read rom: %s", err)
+	}
+
+	if patchPath != "" {
+		if rom, err = readPatch(patchPath, rom); err != nil {
+			return err
+		}
+	}
+
+	var cart *cartridge
+	switch {
+	case isDisk(rom):
+		cart, err = c.loadDisk(path, rom)
+	case isNSF(rom):
+		cart, err = loadNSF(rom)
+	default:
+		cart, err = loadRom(bytes.NewReader(rom))
+	}
 	if err != nil {
 		return err
 	}
 
+	var savePath string
+	if cart.saveRAM {
+		savePath = trimRomExt(path) + ".sav"
+		if err := readSave(savePath, cart.prgRAM); err != nil {
+			return err
+		}
+		// the trainer takes precedence over whatever the save has there
+		cart.mapTrainer()
+	}
+
+	c.savePath = savePath
+	c.savedRAM = append(c.savedRAM[:0], cart.prgRAM...)
 	c.load(cart)
 	return nil
 }
 
+// LoadDiskBIOS loads the Famicom Disk System BIOS used to run disk images.
+// Without one, a disksys.rom next to the disk image is used.
+func (c *Console) LoadDiskBIOS(path string) error {
+	bios, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read disk bios: %s", err)
+	}
+	if len(bios) != fdsBIOSSize {
+		return errFDSBIOSSize
+	}
+
+	c.diskBIOS = bios
+	return nil
+}
+
+func (c *Console) loadDisk(path string, image []byte) (*cartridge, error) {
+	bios := c.diskBIOS
+	if bios == nil {
+		var err error
+		bios, err = ioutil.ReadFile(filepath.Join(filepath.Dir(path), "disksys.rom"))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("unable to load %s: no disk bios", path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read disk bios: %s", err)
+		}
+	}
+
+	return loadDisk(image, bios)
+}
+
+// DiskSides returns the number of disk sides of the loaded disk image, 0 for
+// cartridges.
+func (c *Console) DiskSides() int {
+	if m, ok := c.disk(); ok {
+		return len(m.sides)
+	}
+	return 0
+}
+
+// DiskSide returns the disk side in the drive, or -1 if it's empty. While a
+// disk is being switched it returns the side about to be inserted.
+func (c *Console) DiskSide() int {
+	m, ok := c.disk()
+	if !ok {
+		return -1
+	}
+	if m.insertDelay > 0 {
+		return m.pendingSide
+	}
+	return m.side
+}
+
+// InsertDisk ejects the disk in the drive and inserts side after a short
+// delay, so that the BIOS notices the change. A negative side ejects the
+// disk.
+func (c *Console) InsertDisk(side int) error {
+	m, ok := c.disk()
+	if !ok {
+		return errors.New("no disk loaded")
+	}
+	if side >= len(m.sides) {
+		return fmt.Errorf("invalid disk side %d, the disk has %d", side+1, len(m.sides))
+	}
+
+	if side < 0 {
+		side = -1
+	}
+	m.insertDisk(side)
+	return nil
+}
+
+func (c *Console) disk() (*fds, bool) {
+	if c.cartridge == nil {
+		return nil, false
+	}
+	m, ok := c.cartridge.mapper.(*fds)
+	return m, ok
+}
+
+// NSF returns the description of the loaded NSF file, ok is false if there's
+// none.
+func (c *Console) NSF() (info NSFInfo, ok bool) {
+	if m, ok := c.nsfPlayer(); ok {
+		return m.info, true
+	}
+	return NSFInfo{}, false
+}
+
+// Track returns the NSF track being played, 0 based, or -1 if there's no NSF
+// loaded.
+func (c *Console) Track() int {
+	if m, ok := c.nsfPlayer(); ok {
+		return m.track
+	}
+	return -1
+}
+
+// PlayTrack starts playing track of the loaded NSF file from the beginning.
+func (c *Console) PlayTrack(track int) error {
+	m, ok := c.nsfPlayer()
+	if !ok {
+		return errors.New("no NSF loaded")
+	}
+	if track < 0 || track >= m.info.Tracks {
+		return fmt.Errorf("invalid track %d, the file has %d", track+1, m.info.Tracks)
+	}
+
+	m.track = track
+	c.Reset()
+	return nil
+}
+
+// TrackEnded reports whether the NSF track being played reached the end of
+// its fade out. Tracks whose length is not known never end.
+func (c *Console) TrackEnded() bool {
+	if m, ok := c.nsfPlayer(); ok {
+		return m.ended()
+	}
+	return false
+}
+
+func (c *Console) nsfPlayer() (*nsf, bool) {
+	if c.cartridge == nil {
+		return nil, false
+	}
+	m, ok := c.cartridge.mapper.(*nsf)
+	return m, ok
+}
+
+// DIPSwitches returns the DIP switches of the VS System, switch 1 is bit 0.
+func (c *Console) DIPSwitches() byte {
+	return c.vs.dipSwitches
+}
+
+// SetDIPSwitches sets the DIP switches of the VS System, switch 1 is bit 0.
+// They are kept across games, most games only look at them on reset.
+func (c *Console) SetDIPSwitches(switches byte) {
+	c.vs.dipSwitches = switches
+}
+
+// InsertCoin drops a coin in one of the two coin slots of the VS System.
+func (c *Console) InsertCoin(slot int) error {
+	if c.bus.vs == nil {
+		return errors.New("no VS System game loaded")
+	}
+	if slot < 0 || slot > 1 {
+		return fmt.Errorf("invalid coin slot %d", slot+1)
+	}
+
+	c.vs.insertCoin(slot)
+	return nil
+}
+
+// SetServiceButton presses or releases the service button of the VS System,
+// which usually adds a credit.
+func (c *Console) SetServiceButton(pressed bool) {
+	c.vs.service = pressed
+}
+
 func (c *Console) LoadRom(rom io.Reader) error {
-	cart, err := loadRom(rom)
+	data, err := ioutil.ReadAll(rom)
+	if err != nil {
+		return fmt.Errorf("unable to read rom: %s", err)
+	}
+
+	var cart *cartridge
+	if isNSF(data) {
+		cart, err = loadNSF(data)
+	} else {
+		cart, err = loadRom(bytes.NewReader(data))
+	}
 	if err != nil {
 		return err
 	}
 
+	if err := c.save(); err != nil {
+		return err
+	}
+
+	c.savePath = ""
 	c.load(cart)
 	return nil
 }
 
+func readSave(path string, ram []byte) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read save file: %s", err)
+	}
+
+	copy(ram, data)
+	return nil
+}
+
+// save writes the battery backed RAM next to the rom, if the cartridge has
+// one and its contents changed since the last save.
+func (c *Console) save() error {
+	if c.savePath == "" || bytes.Equal(c.cartridge.prgRAM, c.savedRAM) {
+		return nil
+	}
+
+	// write to a temporary file first so a crash midway doesn't corrupt the
+	// previous save
+	tmp := c.savePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, c.cartridge.prgRAM, 0644); err != nil {
+		return fmt.Errorf("unable to write save file: %s", err)
+	}
+	if err := os.Rename(tmp, c.savePath); err != nil {
+		return fmt.Errorf("unable to write save file: %s", err)
+	}
+
+	c.savedRAM = append(c.savedRAM[:0], c.cartridge.prgRAM...)
+	return nil
+}
+
 func (c *Console) StartRecording() error {
-	return c.apu.mixer.startRecording()
+	c.recordPrefix = ""
+	return c.apu.mixer.startRecording(true)
+}
+
+// RecordTo starts recording the audio to prefix.wav, and if channels is set
+// every channel to its own file too, prefix_pulse_0.wav and so on. Files that
+// exist are overwritten.
+func (c *Console) RecordTo(prefix string, channels bool) error {
+	c.recordPrefix = prefix
+	return c.apu.mixer.startRecording(channels)
 }
 
 func (c *Console) PauseRecording() {
@@ -143,6 +464,10 @@ func (c *Console) StopRecording() error {
 }
 
 func (c *Console) Close() error {
+	if err := c.save(); err != nil {
+		return err
+	}
+
 	if err := c.StopRecording(); err != nil {
 		return err
 	}
@@ -156,6 +481,13 @@ func (c *Console) Close() error {
 }
 
 func (c *Console) Reset() {
+	if c.cartridge != nil {
+		c.cartridge.mapTrainer()
+	}
+	if m, ok := c.nsfPlayer(); ok {
+		m.startTrack(m.track)
+		c.apu.mixer.volume = 1
+	}
 	c.cpu.reset(c.bus)
 	c.apu.reset()
 }
@@ -169,6 +501,28 @@ func (c *Console) StepFrame() {
 	for frame == c.ppu.frame {
 		c.cpu.execute(c.bus)
 	}
+	if c.bus.vs != nil {
+		c.bus.vs.endFrame()
+	}
+	if m, ok := c.nsfPlayer(); ok {
+		c.apu.mixer.volume = m.volume()
+	} else {
+		c.apu.mixer.volume = 1
+	}
+
+	c.saveFrames++
+	if c.saveFrames >= saveInterval {
+		c.saveFrames = 0
+		if err := c.save(); err != nil {
+			log.Printf("%s", err)
+		}
+	}
+}
+
+// Elapsed returns how long the console has run for, in emulated time. It
+// counts CPU cycles, so it doesn't depend on the frame rate.
+func (c *Console) Elapsed() time.Duration {
+	return time.Duration(float64(c.cpu.cycles) / cpuFreq * float64(time.Second))
 }
 
 func (c *Console) Press(ctrl int, button Button) {
@@ -20,9 +20,21 @@ type controller struct {
 }
 
 func (c *controller) read() Button {
+	return c.shift(c.buttons)
+}
+
+// readVS reads the controller the way the VS System wires it, with the start
+// buttons of the other player in place of select and start.
+func (c *controller) readVS(other *controller) Button {
+	buttons := c.buttons
+	buttons[Select], buttons[Start] = other.buttons[Start], other.buttons[Select]
+	return c.shift(buttons)
+}
+
+func (c *controller) shift(buttons [8]Button) Button {
 	var value Button
 	if c.head < 8 {
-		value = c.buttons[c.head]
+		value = buttons[c.head]
 	} else {
 		value = 0
 	}
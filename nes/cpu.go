@@ -23,6 +23,13 @@ const (
 	stackHi = 0x0100
 )
 
+// The unstable immediate opcodes OR A with a constant that depends on the chip
+// before using it.
+const (
+	xaaMagic = 0xEE
+	laxMagic = 0xFF
+)
+
 // status are all the flags that represent the processor status.
 type status byte
 
@@ -138,8 +145,9 @@ type cpu struct {
 	debug     io.Writer
 	interrupt interrupt
 
-	pputemp *ppu
-	aputemp *apu
+	pputemp   *ppu
+	aputemp   *apu
+	cartridge *cartridge
 }
 
 func newCpu(debug io.Writer, ppu *ppu, apu *apu) *cpu {
@@ -173,6 +181,11 @@ func (c *cpu) trigger(interrupt interrupt) {
 		return
 	}
 
+	// an irq must never take the place of a pending nmi
+	if interrupt == irq && c.interrupt != none {
+		return
+	}
+
 	c.interrupt = interrupt
 }
 
@@ -181,7 +194,7 @@ func (c *cpu) execute(bus *sysBus) uint64 {
 
 	c.handleInterrupts(bus)
 
-	initialPc := c.pc
+	initialPc, initialS := c.pc, c.s
 
 	opCode := c.read(bus, c.pc)
 	c.pc++
@@ -191,7 +204,7 @@ func (c *cpu) execute(bus *sysBus) uint64 {
 
 	if c.debug != nil {
 		//TODO: rework disassembly/tracing
-		disassemble(c.debug, bus, initialPc, c.a, c.x, c.y, byte(c.p), c.s, inst, intermediateAddr, addr, oldCycles, c.pputemp)
+		disassemble(c.debug, bus, initialPc, c.a, c.x, c.y, byte(c.p), initialS, inst, intermediateAddr, addr, oldCycles, c.pputemp)
 	}
 
 	switch opCode {
@@ -358,6 +371,10 @@ func (c *cpu) clock() {
 	c.pputemp.tick(c)
 	c.pputemp.tick(c)
 	c.aputemp.clock(c)
+
+	if c.cartridge != nil {
+		c.cartridge.clock(c)
+	}
 }
 
 func (c *cpu) read(bus *sysBus, address uint16) byte {
@@ -423,6 +440,13 @@ func (c *cpu) resolveAddress(bus *sysBus, inst instruction) (intermediateAddr, a
 		lo := c.read(bus, c.pc)
 		c.pc++
 
+		if inst.opCode == 0x20 {
+			// JSR pushes the return address, the one of its last byte,
+			// before fetching the high byte of the target
+			_ = c.read(bus, stackHi|uint16(c.s))
+			c.pushAddress(bus, c.pc)
+		}
+
 		hi := c.read(bus, c.pc)
 		c.pc++
 
@@ -499,10 +523,9 @@ func (c *cpu) resolveAddress(bus *sysBus, inst instruction) (intermediateAddr, a
 			hi := c.read(bus, c.pc)
 			c.pc++
 
-			addr := uint16(hi)<<8 | uint16(lo) + uint16(c.y)
-			_ = c.read(bus, addr)
+			_ = c.read(bus, uint16(hi)<<8|uint16(lo+c.y))
 
-			return 0, addr
+			return 0, uint16(hi)<<8 | uint16(lo) + uint16(c.y)
 		}
 
 	case relative:
@@ -586,14 +609,14 @@ func (c *cpu) handleInterrupts(bus *sysBus) {
 
 // NMI - Non-Maskable Interrupt
 func (c *cpu) handleNmi(bus *sysBus) {
+	// the opcode fetch, and the operand one, happen but are discarded
+	_ = c.read(bus, c.pc)
+	_ = c.read(bus, c.pc)
+
 	c.pushAddress(bus, c.pc)
 	c.push(bus, byte(c.p|unused))
 
 	c.pc = c.readAddress(bus, nmiAddr)
-
-	// TODO: how do these 2 cycles get spent?
-	c.clock()
-	c.clock()
 }
 
 // IRQ - IRQ Interrupt
@@ -602,16 +625,15 @@ func (c *cpu) handleIrq(bus *sysBus) {
 		return
 	}
 
+	// the opcode fetch, and the operand one, happen but are discarded
+	_ = c.read(bus, c.pc)
+	_ = c.read(bus, c.pc)
+
 	c.pushAddress(bus, c.pc)
 	c.push(bus, byte(c.p|unused))
+	c.p |= interruptDisable
 
 	c.pc = c.readAddress(bus, irqBrkAddr)
-
-	// TODO: how do these 2 cycles get spent?
-	c.clock()
-	c.clock()
-
-	c.p |= interruptDisable
 }
 
 func (c *cpu) push(bus *sysBus, v byte) {
@@ -626,6 +648,12 @@ func (c *cpu) pull(bus *sysBus) byte {
 	return c.read(bus, stackHi|stackLo)
 }
 
+// peekStack reads the top of the stack without pulling it, pulls take a cycle
+// to increment the stack pointer first.
+func (c *cpu) peekStack(bus *sysBus) {
+	_ = c.read(bus, stackHi|uint16(c.s))
+}
+
 func (c *cpu) pushAddress(bus *sysBus, value uint16) {
 	hi := byte(value >> 8)
 	lo := byte(value & 0xFF)
@@ -775,12 +803,14 @@ func (c *cpu) doRor(v byte) byte {
 	return v
 }
 
-func (c *cpu) branch(addr uint16) {
+// branch jumps to addr. Taken branches read the next opcode, and the target
+// before its high byte is fixed when the page changes, but don't use them.
+func (c *cpu) branch(bus *sysBus, addr uint16) {
+	_ = c.read(bus, c.pc)
 	if c.pc&0xFF00 != addr&0xFF00 {
-		c.clock()
+		_ = c.read(bus, c.pc&0xFF00|addr&0x00FF)
 	}
 
-	c.clock()
 	c.pc = addr
 }
 
@@ -1226,8 +1256,7 @@ func (c *cpu) php(bus *sysBus, mode addressingMode, addr uint16) {
 // V	Overflow Flag		Not affected
 // N	Negative Flag		Set if bit 7 of A is set
 func (c *cpu) pla(bus *sysBus, mode addressingMode, addr uint16) {
-	// TODO: this cycle should be spent in pull. read the docs
-	c.clock()
+	c.peekStack(bus)
 	a := c.pull(bus)
 
 	c.a = a
@@ -1250,8 +1279,7 @@ func (c *cpu) pla(bus *sysBus, mode addressingMode, addr uint16) {
 // N	Negative Flag	Set from stack
 func (c *cpu) plp(bus *sysBus, mode addressingMode, addr uint16) {
 
-	// TODO: this cycle should be spent in pull. read the docs
-	c.clock()
+	c.peekStack(bus)
 	p := c.pull(bus)
 
 	c.p = status(p)
@@ -1673,7 +1701,7 @@ func (c *cpu) bcc(bus *sysBus, mode addressingMode, addr uint16) {
 		return
 	}
 
-	c.branch(addr)
+	c.branch(bus, addr)
 }
 
 // BCS - Branch if Carry Set
@@ -1694,7 +1722,7 @@ func (c *cpu) bcs(bus *sysBus, mode addressingMode, addr uint16) {
 		return
 	}
 
-	c.branch(addr)
+	c.branch(bus, addr)
 }
 
 // BVC - Branch if Overflow Clear
@@ -1715,7 +1743,7 @@ func (c *cpu) bvc(bus *sysBus, mode addressingMode, addr uint16) {
 		return
 	}
 
-	c.branch(addr)
+	c.branch(bus, addr)
 }
 
 // BVS - Branch if Overflow Set
@@ -1736,7 +1764,7 @@ func (c *cpu) bvs(bus *sysBus, mode addressingMode, addr uint16) {
 		return
 	}
 
-	c.branch(addr)
+	c.branch(bus, addr)
 }
 
 // BEQ - Branch if Equal
@@ -1757,7 +1785,7 @@ func (c *cpu) beq(bus *sysBus, mode addressingMode, addr uint16) {
 		return
 	}
 
-	c.branch(addr)
+	c.branch(bus, addr)
 }
 
 // BNE - Branch if Not Equal
@@ -1778,7 +1806,7 @@ func (c *cpu) bne(bus *sysBus, mode addressingMode, addr uint16) {
 		return
 	}
 
-	c.branch(addr)
+	c.branch(bus, addr)
 }
 
 // BMI - Branch if Minus
@@ -1799,7 +1827,7 @@ func (c *cpu) bmi(bus *sysBus, mode addressingMode, addr uint16) {
 		return
 	}
 
-	c.branch(addr)
+	c.branch(bus, addr)
 }
 
 // BPL - Branch if Positive
@@ -1820,7 +1848,7 @@ func (c *cpu) bpl(bus *sysBus, mode addressingMode, addr uint16) {
 		return
 	}
 
-	c.branch(addr)
+	c.branch(bus, addr)
 }
 
 // JMP - Jump
@@ -1853,9 +1881,6 @@ func (c *cpu) jmp(bus *sysBus, mode addressingMode, addr uint16) {
 // V	Overflow Flag		Not affected
 // N	Negative Flag		Not affected
 func (c *cpu) jsr(bus *sysBus, mode addressingMode, addr uint16) {
-	c.clock()
-
-	c.pushAddress(bus, c.pc-1)
 	c.pc = addr
 }
 
@@ -1873,9 +1898,7 @@ func (c *cpu) jsr(bus *sysBus, mode addressingMode, addr uint16) {
 // V	Overflow Flag		Set from stack
 // N	Negative Flag		Set from stack
 func (c *cpu) rti(bus *sysBus, mode addressingMode, addr uint16) {
-	// TODO: this cycle should be spent in pull. read the docs
-	c.clock()
-
+	c.peekStack(bus)
 	p := c.pull(bus)
 
 	c.p = status(p) & ^brk
@@ -1898,14 +1921,12 @@ func (c *cpu) rti(bus *sysBus, mode addressingMode, addr uint16) {
 // V	Overflow Flag		Not affected
 // N	Negative Flag		Not affected
 func (c *cpu) rts(bus *sysBus, mode addressingMode, addr uint16) {
-	// TODO: this cycle should be spent in pull. read the docs
-	c.clock()
-
-	pclo := uint16(c.pull(bus))
-	pchi := uint16(c.pull(bus))
+	c.peekStack(bus)
+	c.pc = c.pullAddress(bus)
 
-	c.clock()
-	c.pc = pchi<<8 | pclo + 1
+	// the return address is the last byte of the JSR, it's read and skipped
+	_ = c.read(bus, c.pc)
+	c.pc++
 }
 
 // ====================================================================================================================================
@@ -1990,16 +2011,31 @@ func (c *cpu) arr(bus *sysBus, mode addressingMode, addr uint16) {
 // entry or to the next APU channel, saving one byte and four cycles over four
 // INXs. Also called SBX.
 func (c *cpu) axs(bus *sysBus, mode addressingMode, addr uint16) {
-	panic("AXS wat") //SBC without carry void asx()
+	v := c.read(bus, addr)
+	ax := c.a & c.x
+	c.x = ax - v
+
+	if ax >= v {
+		c.p |= carry
+	} else {
+		c.p &^= carry
+	}
+	c.updateZero(c.x)
+	c.updateNegative(c.x)
 }
 
 // Shortcut for LDA value then TAX. Saves a byte and two cycles and allows use
-// of the X register with the (d),Y addressing mode. Notice that the immediate
-// is missing; the opcode that would have been LAX is affected by line noise on
-// the data bus. MOS 6502: even the bugs have bugs.
+// of the X register with the (d),Y addressing mode. The immediate is unstable,
+// like XAA it is affected by line noise on the data bus. MOS 6502: even the bugs
+// have bugs.
 func (c *cpu) lax(bus *sysBus, mode addressingMode, addr uint16) {
 	if mode == immediate {
-		panic("LAX Immediate")
+		// same as XAA, but the 2A03 behaves as if the constant was $FF
+		v := (c.a | laxMagic) & c.read(bus, addr)
+		c.a, c.x = v, v
+		c.updateZero(v)
+		c.updateNegative(v)
+		return
 	}
 
 	c.lda(bus, mode, addr)
@@ -2094,22 +2130,55 @@ func (c *cpu) sre(bus *sysBus, mode addressingMode, addr uint16) {
 func (c *cpu) kil(bus *sysBus, mode addressingMode, addr uint16) {
 	panic("KIL NOT IMPLEMENTED")
 }
+
+// Sets A to {(A OR magic) AND X AND #value}. The magic constant depends on the
+// chip and its temperature, $EE is the most commonly observed one. Also called
+// ANE. Highly unstable, nothing should rely on it.
 func (c *cpu) xaa(bus *sysBus, mode addressingMode, addr uint16) {
-	c.txa(bus, mode, addr)
-	c.and(bus, mode, addr)
+	c.a = (c.a | xaaMagic) & c.x & c.read(bus, addr)
+	c.updateZero(c.a)
+	c.updateNegative(c.a)
 }
+
+// Stores A AND X AND (the high byte of the address + 1). Also called SHA.
 func (c *cpu) ahx(bus *sysBus, mode addressingMode, addr uint16) {
-	panic("AHX NOT IMPLEMENTED")
+	c.storeHigh(bus, addr, c.y, c.a&c.x)
 }
+
+// Sets S to A AND X, then stores S AND (the high byte of the address + 1).
+// Also called SHS.
 func (c *cpu) tas(bus *sysBus, mode addressingMode, addr uint16) {
-	panic("TAS NOT IMPLEMENTED")
+	c.s = c.a & c.x
+	c.storeHigh(bus, addr, c.y, c.s)
 }
+
+// Stores Y AND (the high byte of the address + 1). Also called SYA.
 func (c *cpu) shy(bus *sysBus, mode addressingMode, addr uint16) {
-	panic("SHY NOT IMPLEMENTED")
+	c.storeHigh(bus, addr, c.x, c.y)
 }
+
+// Stores X AND (the high byte of the address + 1). Also called SXA.
 func (c *cpu) shx(bus *sysBus, mode addressingMode, addr uint16) {
-	panic("SHX NOT IMPLEMENTED")
+	c.storeHigh(bus, addr, c.y, c.x)
 }
+
+// Sets A, X and S to {value AND S}, and updates NZ. Also called LAR.
 func (c *cpu) las(bus *sysBus, mode addressingMode, addr uint16) {
-	panic("LAS NOT IMPLEMENTED")
+	v := c.read(bus, addr) & c.s
+	c.a, c.x, c.s = v, v, v
+	c.updateZero(v)
+	c.updateNegative(v)
+}
+
+// storeHigh implements the store of SHY, SHX, AHX and TAS, that AND the value
+// with the high byte of the base address plus one, before it was indexed by
+// index. When indexing crosses a page the high byte of the address the value
+// ends up at is corrupted too, it becomes the value itself.
+func (c *cpu) storeHigh(bus *sysBus, addr uint16, index byte, v byte) {
+	base := addr - uint16(index)
+	v &= byte(base>>8) + 1
+	if base&0xFF00 != addr&0xFF00 {
+		addr = uint16(v)<<8 | addr&0x00FF
+	}
+	c.write(bus, addr, v)
 }
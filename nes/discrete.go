@@ -0,0 +1,174 @@
+package nes
+
+// discrete covers the boards that are built out of off-the-shelf logic chips:
+// a latch at $8000-$FFFF and some glue to route its outputs to the upper
+// address lines of the PRG and CHR chips. They only differ in how the value
+// written to the latch is decoded, so each board is just a latch function on
+// top of this.
+//
+// On most of them the ROM is not disabled during writes, so the value on the
+// data bus is the written value ANDed with the ROM byte at that address. Games
+// for those boards write to a location holding the same value to avoid it,
+// busConflicts emulates it for the ones that don't. UxROM, CNROM and AxROM
+// were made both ways, NES 2.0 tells them apart with submapper 1 (none) and 2
+// (conflicts). Without one we assume none, like other emulators do, as hacks
+// rely on it and the licensed games are written to work either way.
+type discrete struct {
+	cart *cartridge
+
+	busConflicts bool
+	latch        func(d *discrete, address uint16, value byte)
+
+	prgOffsets [2]int
+	chrOffset  int
+	mirroring  mirrorMode
+}
+
+func newDiscrete(c *cartridge, busConflicts bool, latch func(d *discrete, address uint16, value byte)) *discrete {
+	d := &discrete{
+		cart:         c,
+		busConflicts: busConflicts,
+		latch:        latch,
+		mirroring:    c.mirrorMode,
+	}
+	d.prg32(0)
+	return d
+}
+
+// submapperBusConflicts tells whether a board that was made both with and
+// without bus conflicts has them.
+func submapperBusConflicts(c *cartridge) bool {
+	return c.info.Submapper == 2
+}
+
+// UxROM (mapper 2) switches 16K at $8000, the last bank is fixed at $C000.
+func newUxROM(c *cartridge) Mapper {
+	d := newDiscrete(c, submapperBusConflicts(c), func(d *discrete, address uint16, value byte) {
+		d.prg16(0, int(value))
+	})
+	d.prg16(0, 0)
+	d.prg16(1, -1)
+	return d
+}
+
+// CNROM (mapper 3) switches 8K of CHR.
+func newCNROM(c *cartridge) Mapper {
+	return newDiscrete(c, submapperBusConflicts(c), func(d *discrete, address uint16, value byte) {
+		d.chr8(int(value))
+	})
+}
+
+// AxROM (mapper 7) switches 32K of PRG, bit 4 selects which nametable is
+// used for single screen mirroring.
+func newAxROM(c *cartridge) Mapper {
+	d := newDiscrete(c, submapperBusConflicts(c), func(d *discrete, address uint16, value byte) {
+		d.prg32(int(value & 0x07))
+		if value&0x10 == 0 {
+			d.mirroring = singleScreenLow
+		} else {
+			d.mirroring = singleScreenHigh
+		}
+	})
+	d.mirroring = singleScreenLow
+	return d
+}
+
+// Color Dreams (mapper 11) switches 32K of PRG with bits 0-1 and 8K of CHR
+// with bits 4-7.
+func newColorDreams(c *cartridge) Mapper {
+	return newDiscrete(c, true, func(d *discrete, address uint16, value byte) {
+		d.prg32(int(value & 0x03))
+		d.chr8(int(value >> 4))
+	})
+}
+
+// BNROM (mapper 34) switches 32K of PRG.
+func newBNROM(c *cartridge) Mapper {
+	return newDiscrete(c, true, func(d *discrete, address uint16, value byte) {
+		d.prg32(int(value))
+	})
+}
+
+// GxROM (mapper 66) switches 32K of PRG with bits 4-5 and 8K of CHR with
+// bits 0-1.
+func newGxROM(c *cartridge) Mapper {
+	return newDiscrete(c, true, func(d *discrete, address uint16, value byte) {
+		d.prg32(int(value >> 4 & 0x03))
+		d.chr8(int(value & 0x03))
+	})
+}
+
+// Camerica (mapper 71) is UxROM with the latch at $C000-$FFFF. Fire Hawk
+// also selects single screen mirroring with bit 4 of writes to $9000-$9FFF.
+func newCamerica(c *cartridge) Mapper {
+	d := newDiscrete(c, false, func(d *discrete, address uint16, value byte) {
+		switch {
+		case address >= 0xC000:
+			d.prg16(0, int(value))
+		case address&0xF000 == 0x9000:
+			if value&0x10 == 0 {
+				d.mirroring = singleScreenLow
+			} else {
+				d.mirroring = singleScreenHigh
+			}
+		}
+	})
+	d.prg16(0, 0)
+	d.prg16(1, -1)
+	return d
+}
+
+func (d *discrete) prg16(slot, bank int) {
+	d.prgOffsets[slot] = bankOffset(d.cart.prg, bank, 0x4000)
+}
+
+func (d *discrete) prg32(bank int) {
+	d.prgOffsets[0] = bankOffset(d.cart.prg, bank*2, 0x4000)
+	d.prgOffsets[1] = bankOffset(d.cart.prg, bank*2+1, 0x4000)
+}
+
+func (d *discrete) chr8(bank int) {
+	d.chrOffset = bankOffset(d.cart.chr, bank, 0x2000)
+}
+
+func (d *discrete) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0x8000:
+		slot := (address - 0x8000) / 0x4000
+		return d.cart.prg[d.prgOffsets[slot]+int(address%0x4000)]
+	case address >= 0x6000:
+		return d.cart.prgRAM[int(address-0x6000)%len(d.cart.prgRAM)]
+	}
+
+	return 0
+}
+
+func (d *discrete) cpuWrite(address uint16, value byte) {
+	switch {
+	case address >= 0x8000:
+		if d.busConflicts {
+			value &= d.cpuRead(address)
+		}
+		d.latch(d, address, value)
+	case address >= 0x6000:
+		d.cart.prgRAM[int(address-0x6000)%len(d.cart.prgRAM)] = value
+	}
+}
+
+func (d *discrete) ppuRead(address uint16) byte {
+	return d.cart.chr[d.chrOffset+int(address)]
+}
+
+func (d *discrete) ppuWrite(address uint16, value byte) {
+	if d.cart.chrRAM {
+		d.cart.chr[d.chrOffset+int(address)] = value
+	}
+}
+
+func (d *discrete) mirrorMode() mirrorMode {
+	return d.mirroring
+}
+
+func (d *discrete) irq() bool                 { return false }
+func (d *discrete) ppuAddress(address uint16) {}
+func (d *discrete) clock()                    {}
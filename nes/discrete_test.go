@@ -0,0 +1,134 @@
+package nes
+
+import "testing"
+
+// newTestDiscrete returns the board for mapper without bus conflicts, so that
+// the value written is the one latched.
+func newTestDiscrete(mapper uint16) *discrete {
+	d := newTestBoard(mapper, 0).mapper.(*discrete)
+	d.busConflicts = false
+	return d
+}
+
+// The test boards tag 8K of PRG and 1K of CHR, so the 16K PRG bank n reads as
+// 2n and the 8K CHR bank n as 8n.
+func TestDiscrete(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapper  uint16
+		address uint16
+		value   byte
+		prg     [2]byte // tag at $8000 and $C000
+		chr     byte
+	}{
+		{"UxROM", 2, 0xC000, 3, [2]byte{6, 30}, 0},
+		{"CNROM", 3, 0x8000, 0, [2]byte{0, 2}, 0},
+		{"AxROM", 7, 0x8000, 0x02, [2]byte{8, 10}, 0},
+		{"ColorDreams", 11, 0xC000, 0x00, [2]byte{0, 2}, 0},
+		{"BNROM", 34, 0xC000, 1, [2]byte{4, 6}, 0},
+		{"GxROM", 66, 0x8000, 0x00, [2]byte{0, 2}, 0},
+		{"Camerica", 71, 0xC000, 5, [2]byte{10, 30}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestDiscrete(tt.mapper)
+			m.cpuWrite(tt.address, tt.value)
+
+			if got := m.cpuRead(0x8000); got != tt.prg[0] {
+				t.Errorf("$8000 = %d, want %d", got, tt.prg[0])
+			}
+			if got := m.cpuRead(0xC000); got != tt.prg[1] {
+				t.Errorf("$C000 = %d, want %d", got, tt.prg[1])
+			}
+			if got := m.ppuRead(0x0000); got != tt.chr {
+				t.Errorf("chr = %d, want %d", got, tt.chr)
+			}
+		})
+	}
+}
+
+func TestDiscrete_CHR(t *testing.T) {
+	tests := []struct {
+		name   string
+		mapper uint16
+		value  byte
+		want   byte
+	}{
+		{"CNROM", 3, 0x02, 20},
+		{"ColorDreams", 11, 0x30, 28},
+		{"GxROM", 66, 0x01, 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestDiscrete(tt.mapper)
+			m.cpuWrite(0x8000, tt.value)
+
+			if got := m.ppuRead(0x1000); got != tt.want {
+				t.Errorf("chr = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscrete_BusConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		mapper    uint16
+		submapper byte
+		conflicts bool
+	}{
+		{"UxROM", 2, 0, false},
+		{"UxROM no conflicts", 2, 1, false},
+		{"UxROM conflicts", 2, 2, true},
+		{"CNROM", 3, 0, false},
+		{"CNROM conflicts", 3, 2, true},
+		{"AxROM", 7, 0, false},
+		{"AxROM conflicts", 7, 2, true},
+		{"ColorDreams", 11, 0, true},
+		{"BNROM", 34, 0, true},
+		{"GxROM", 66, 0, true},
+		{"Camerica", 71, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestBoard(tt.mapper, tt.submapper)
+			if got := c.mapper.(*discrete).busConflicts; got != tt.conflicts {
+				t.Errorf("busConflicts = %v, want %v", got, tt.conflicts)
+			}
+		})
+	}
+
+	// the ROM at $8000 holds 0, so the write is ANDed down to bank 0
+	c := newTestBoard(2, 2)
+	c.mapper.cpuWrite(0x8000, 5)
+	if got := c.mapper.cpuRead(0x8000); got != 0 {
+		t.Errorf("with bus conflicts: $8000 = %d, want %d", got, 0)
+	}
+
+	c = newTestBoard(2, 0)
+	c.mapper.cpuWrite(0x8000, 5)
+	if got := c.mapper.cpuRead(0x8000); got != 10 {
+		t.Errorf("without bus conflicts: $8000 = %d, want %d", got, 10)
+	}
+}
+
+func TestDiscrete_Mirroring(t *testing.T) {
+	m := newTestDiscrete(7)
+	if got := m.mirrorMode(); got != singleScreenLow {
+		t.Errorf("power on: mirroring = %v, want %v", got, singleScreenLow)
+	}
+
+	m.cpuWrite(0x8000, 0x10)
+	if got := m.mirrorMode(); got != singleScreenHigh {
+		t.Errorf("bit 4 set: mirroring = %v, want %v", got, singleScreenHigh)
+	}
+
+	m = newTestDiscrete(71)
+	m.cpuWrite(0x9000, 0x10)
+	if got := m.mirrorMode(); got != singleScreenHigh {
+		t.Errorf("camerica: mirroring = %v, want %v", got, singleScreenHigh)
+	}
+}
@@ -0,0 +1,474 @@
+package nes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+const (
+	fdsHeaderLen    = 16
+	fdsSideLen      = 65500
+	fdsBIOSSize     = 8192
+	fdsRAMSize      = 32768
+	fdsDiskMapperID = 20 // reserved by NES 2.0 for disk images
+
+	// fdsLeadIn is the gap before the first block, 28300 bits.
+	fdsLeadIn = 28300 / 8
+	// fdsBlockGap is the gap between blocks, 976 bits.
+	fdsBlockGap = 976 / 8
+
+	// fdsByteCycles is how many CPU cycles the drive takes to read or write
+	// a byte, at about 96.4kbit/s.
+	fdsByteCycles = 149
+	// fdsRewindCycles is how long the head takes to go back to the start of
+	// the disk once it reaches the end.
+	fdsRewindCycles = 50000
+	// fdsInsertCycles is how long a disk stays out when switching sides, so
+	// that the BIOS notices. About half a second.
+	fdsInsertCycles = 900000
+)
+
+var (
+	fdsMagic  = []byte{'F', 'D', 'S', 0x1A}
+	fdsVerify = []byte("*NINTENDO-HVC*")
+
+	errFDSBIOSSize = errors.New("nes: the FDS BIOS must be 8K")
+	errNoDiskSides = errors.New("nes: disk image has no sides")
+)
+
+// isDisk reports whether rom is a disk image, either with the fwNES header or
+// a raw dump that starts with the disk info block.
+func isDisk(rom []byte) bool {
+	if bytes.HasPrefix(rom, fdsMagic) {
+		return true
+	}
+	return len(rom) > len(fdsVerify) && rom[0] == 0x01 && bytes.HasPrefix(rom[1:], fdsVerify)
+}
+
+// diskInfo describes the RAM adapter, the BIOS takes the place of the PRG-ROM.
+var diskInfo = CartridgeInfo{
+	Format:     FDS,
+	Mapper:     fdsDiskMapperID,
+	PRGROMSize: fdsBIOSSize,
+	PRGRAMSize: fdsRAMSize,
+	CHRRAMSize: chrMul,
+}
+
+// diskSides splits a disk image into its sides, as stored in the file.
+func diskSides(image []byte) ([][]byte, error) {
+	if bytes.HasPrefix(image, fdsMagic) {
+		if len(image) < fdsHeaderLen {
+			return nil, fmt.Errorf("nes: unable to read disk header: %d bytes", len(image))
+		}
+		image = image[fdsHeaderLen:]
+	}
+
+	var sides [][]byte
+	for len(image) >= fdsSideLen {
+		sides = append(sides, image[:fdsSideLen])
+		image = image[fdsSideLen:]
+	}
+	if len(sides) == 0 {
+		return nil, errNoDiskSides
+	}
+
+	return sides, nil
+}
+
+// loadDisk builds the cartridge for a disk image: the RAM adapter with the
+// BIOS in place of the PRG-ROM, 32K of PRG-RAM and 8K of CHR-RAM.
+func loadDisk(image, bios []byte) (*cartridge, error) {
+	if len(bios) != fdsBIOSSize {
+		return nil, errFDSBIOSSize
+	}
+
+	raw, err := diskSides(image)
+	if err != nil {
+		return nil, err
+	}
+
+	var sides [][]byte
+	for _, data := range raw {
+		side, err := fdsSide(data)
+		if err != nil {
+			return nil, fmt.Errorf("nes: disk side %d: %s", len(sides)+1, err)
+		}
+		sides = append(sides, side)
+	}
+
+	c := &cartridge{
+		info:       diskInfo,
+		mirrorMode: horizontal,
+		mapperNum:  fdsDiskMapperID,
+		prg:        append([]byte(nil), bios...),
+		chr:        make([]byte, chrMul),
+		chrRAM:     true,
+		prgRAM:     make([]byte, fdsRAMSize),
+	}
+
+	m := newFDS(c, sides)
+	c.mapper = m
+	c.audio = m
+	return c, nil
+}
+
+// fdsSide converts a side as stored in .fds files, just the blocks, into the
+// bit stream the drive sees: a lead-in, and every block preceded by the gap
+// end mark and followed by its CRC and a gap. The CRCs are placeholders, the
+// drive never reports errors.
+func fdsSide(data []byte) ([]byte, error) {
+	if data[0] != 0x01 || !bytes.HasPrefix(data[1:], fdsVerify) {
+		return nil, errors.New("missing disk info block")
+	}
+
+	stream := make([]byte, fdsLeadIn, fdsLeadIn+fdsSideLen)
+
+	var fileSize int
+	for pos := 0; pos < len(data); {
+		var size int
+		switch data[pos] {
+		case 1:
+			size = 56
+		case 2:
+			size = 2
+		case 3:
+			size = 16
+			if pos+size <= len(data) {
+				fileSize = int(data[pos+13]) | int(data[pos+14])<<8
+			}
+		case 4:
+			size = 1 + fileSize
+		default:
+			// unused space
+			pos = len(data)
+			continue
+		}
+
+		if pos+size > len(data) {
+			return nil, fmt.Errorf("block %d at %d is truncated", data[pos], pos)
+		}
+
+		stream = append(stream, 0x80)
+		stream = append(stream, data[pos:pos+size]...)
+		stream = append(stream, 0x4D, 0x62)
+		stream = append(stream, make([]byte, fdsBlockGap)...)
+		pos += size
+	}
+
+	if size := fdsLeadIn + fdsSideLen; len(stream) < size {
+		stream = append(stream, make([]byte, size-len(stream))...)
+	}
+	return stream, nil
+}
+
+// fds is the Famicom Disk System RAM adapter: 32K of RAM at $6000-$DFFF, the
+// BIOS at $E000, a timer IRQ, the disk drive interface and a wavetable sound
+// channel.
+//
+//	$4020-$4021 Timer IRQ reload value, low and high byte
+//	$4022       Timer IRQ control: repeat (bit 0), enable (bit 1)
+//	$4023       Master I/O enable: disk (bit 0), sound (bit 1)
+//	$4024       Write data
+//	$4025       FDS control
+//	$4030       Disk status, reading it acknowledges both IRQs
+//	$4031       Read data, reading it acknowledges the byte transfer
+//	$4032       Drive status
+//	$4033       External connector, bit 7 is the battery status
+//	$4040-$4092 Sound, see fdsAudio
+//
+// FDS control ($4025)
+//
+//	7  bit  0
+//	---- ----
+//	IS1B MRTD
+//	|||| ||||
+//	|||| |||+- Drive motor on
+//	|||| ||+-- Transfer reset, holds the head at the start of the disk
+//	|||| |+--- Read mode (1) or write mode (0)
+//	|||| +---- Mirroring (0: vertical; 1: horizontal)
+//	|||+------ CRC control, set while the CRC is being transferred
+//	||+------- Always 1
+//	|+-------- Start the transfer, 0 skips the gap until the end mark
+//	+--------- Byte transfer IRQ enable
+//
+// The disk is a bit stream that the drive goes over a byte at a time while
+// the motor is on, and rewinds once it reaches the end.
+type fds struct {
+	cart *cartridge
+
+	sides        [][]byte
+	side         int // -1 when there's no disk in the drive
+	pendingSide  int
+	insertDelay  int
+	position     int
+	delay        int
+	endOfHead    bool
+	scanning     bool
+	gapEnded     bool
+	readData     byte
+	writeData    byte
+	transferDone bool
+
+	diskEnabled  bool
+	soundEnabled bool
+	control      byte // $4025
+
+	timerReload  uint16
+	timerCounter uint16
+	timerRepeat  bool
+	timerEnabled bool
+	timerIRQ     bool
+	diskIRQ      bool
+
+	audio fdsAudio
+}
+
+func newFDS(c *cartridge, sides [][]byte) *fds {
+	return &fds{
+		cart:        c,
+		sides:       sides,
+		side:        0,
+		pendingSide: -1,
+		endOfHead:   true,
+	}
+}
+
+// insertDisk ejects the disk in the drive and inserts side after a short
+// delay. A negative side leaves the drive empty.
+func (m *fds) insertDisk(side int) {
+	m.side = -1
+	m.pendingSide = side
+	m.insertDelay = fdsInsertCycles
+	m.scanning = false
+	m.endOfHead = true
+}
+
+func (m *fds) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0xE000:
+		return m.cart.prg[address-0xE000]
+	case address >= 0x6000:
+		return m.cart.prgRAM[address-0x6000]
+	case address >= 0x4040 && address <= 0x4092:
+		return m.audio.read(address)
+	}
+
+	switch address {
+	case 0x4030:
+		var value byte
+		if m.timerIRQ {
+			value |= 0x01
+		}
+		if m.transferDone {
+			value |= 0x02
+		}
+		if m.endOfHead {
+			value |= 0x40
+		}
+		m.transferDone = false
+		m.timerIRQ = false
+		m.diskIRQ = false
+		return value
+
+	case 0x4031:
+		m.transferDone = false
+		m.diskIRQ = false
+		return m.readData
+
+	case 0x4032:
+		value := byte(0x40)
+		if m.side < 0 {
+			value |= 0x05 // not inserted, write protected
+		}
+		if m.side < 0 || !m.scanning {
+			value |= 0x02
+		}
+		return value
+
+	case 0x4033:
+		return 0x80
+	}
+
+	return 0
+}
+
+func (m *fds) cpuWrite(address uint16, value byte) {
+	switch {
+	case address >= 0xE000:
+		return
+	case address >= 0x6000:
+		m.cart.prgRAM[address-0x6000] = value
+		return
+	case address >= 0x4040 && address <= 0x408A:
+		if m.soundEnabled {
+			m.audio.write(address, value)
+		}
+		return
+	}
+
+	if !m.diskEnabled && address != 0x4023 {
+		return
+	}
+
+	switch address {
+	case 0x4020:
+		m.timerReload = m.timerReload&0xFF00 | uint16(value)
+	case 0x4021:
+		m.timerReload = m.timerReload&0x00FF | uint16(value)<<8
+	case 0x4022:
+		m.timerRepeat = value&0x01 > 0
+		m.timerEnabled = value&0x02 > 0
+		if m.timerEnabled {
+			m.timerCounter = m.timerReload
+		} else {
+			m.timerIRQ = false
+		}
+	case 0x4023:
+		m.diskEnabled = value&0x01 > 0
+		m.soundEnabled = value&0x02 > 0
+		if !m.diskEnabled {
+			m.timerEnabled = false
+			m.timerIRQ = false
+			m.diskIRQ = false
+		}
+	case 0x4024:
+		m.writeData = value
+		m.transferDone = false
+		m.diskIRQ = false
+	case 0x4025:
+		m.control = value
+		m.diskIRQ = false
+	}
+}
+
+func (m *fds) ppuRead(address uint16) byte {
+	return m.cart.chr[address]
+}
+
+func (m *fds) ppuWrite(address uint16, value byte) {
+	m.cart.chr[address] = value
+}
+
+func (m *fds) mirrorMode() mirrorMode {
+	if m.control&0x08 > 0 {
+		return horizontal
+	}
+	return vertical
+}
+
+func (m *fds) irq() bool                 { return m.timerIRQ || m.diskIRQ }
+func (m *fds) ppuAddress(address uint16) {}
+
+func (m *fds) clock() {
+	m.clockTimer()
+	m.audio.clock()
+	m.clockDrive()
+}
+
+func (m *fds) audioChannels() []string { return fdsChannels }
+func (m *fds) sample(out []float32)    { m.audio.sample(out) }
+
+func (m *fds) clockTimer() {
+	if !m.timerEnabled {
+		return
+	}
+
+	if m.timerCounter > 0 {
+		m.timerCounter--
+		return
+	}
+
+	m.timerIRQ = true
+	m.timerCounter = m.timerReload
+	if !m.timerRepeat {
+		m.timerEnabled = false
+	}
+}
+
+func (m *fds) clockDrive() {
+	if m.insertDelay > 0 {
+		m.insertDelay--
+		if m.insertDelay == 0 {
+			m.side = m.pendingSide
+		}
+		return
+	}
+
+	motorOn := m.control&0x01 > 0
+	if m.side < 0 || !motorOn {
+		m.endOfHead = true
+		m.scanning = false
+		return
+	}
+
+	transferReset := m.control&0x02 > 0
+	if transferReset && !m.scanning {
+		return
+	}
+
+	if m.endOfHead {
+		m.delay = fdsRewindCycles
+		m.endOfHead = false
+		m.position = 0
+		m.gapEnded = false
+		return
+	}
+
+	if m.delay > 0 {
+		m.delay--
+		return
+	}
+
+	m.scanning = true
+	m.transferByte()
+
+	m.position++
+	if m.position >= len(m.sides[m.side]) {
+		m.endOfHead = true
+		return
+	}
+	m.delay = fdsByteCycles
+}
+
+func (m *fds) transferByte() {
+	disk := m.sides[m.side]
+	start := m.control&0x40 > 0
+	irqEnabled := m.control&0x80 > 0
+
+	if m.control&0x04 > 0 {
+		data := disk[m.position]
+		if !start {
+			m.gapEnded = false
+			return
+		}
+
+		// the byte with the gap end mark isn't handed to the CPU
+		if !m.gapEnded {
+			if data != 0 {
+				m.gapEnded = true
+			}
+			return
+		}
+
+		m.readData = data
+		m.transferDone = true
+		if irqEnabled {
+			m.diskIRQ = true
+		}
+		return
+	}
+
+	data := m.writeData
+	if m.control&0x10 == 0 {
+		m.transferDone = true
+		if irqEnabled {
+			m.diskIRQ = true
+		}
+	}
+	if !start {
+		data = 0
+	}
+	disk[m.position] = data
+	m.gapEnded = false
+}
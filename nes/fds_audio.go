@@ -0,0 +1,256 @@
+package nes
+
+// fdsVolume scales the FDS output to the APU's. At full volume the channel is
+// about twice as loud as an APU pulse.
+const fdsVolume = 0.0036
+
+// fdsMasterVolumes are the multipliers of the 4 master volume settings, 2/2,
+// 2/3, 2/4 and 2/5, over 36.
+var fdsMasterVolumes = [4]int{36, 24, 17, 14}
+
+// fdsModAdjust is how much each 3 bit modulation table entry moves the
+// modulation counter, 4 resets it to 0.
+var fdsModAdjust = [8]int{0, 1, 2, 4, 0, -4, -2, -1}
+
+// fdsAudio is the sound channel of the RAM adapter: a 64 step wavetable of 6
+// bit samples, with a volume envelope and a frequency modulator that has its
+// own envelope and a table of 64 pitch adjustments.
+//
+//	$4040-$407F Wavetable, writable while $4089 bit 7 is set
+//	$4080       Volume envelope: mode (bit 7, 1: fixed gain), increase
+//	            (bit 6), speed or gain (bits 0-5)
+//	$4082-$4083 Wave frequency, low 8 and high 4 bits. $4083 bit 7 halts
+//	            the wave and bit 6 the envelopes
+//	$4084       Modulation envelope, like $4080
+//	$4085       Modulation counter, 7 bit signed
+//	$4086-$4087 Modulation frequency, low 8 and high 4 bits. $4087 bit 7
+//	            halts the modulator
+//	$4088       Modulation table, writes 2 entries while halted
+//	$4089       Wavetable write (bit 7), master volume (bits 0-1)
+//	$408A       Envelope speed multiplier
+//	$4090       Volume gain (read)
+//	$4092       Modulation gain (read)
+type fdsAudio struct {
+	wave       [64]byte
+	wavePos    byte
+	waveAcc    uint16
+	waveFreq   uint16
+	waveHalt   bool
+	waveWrite  bool
+	masterVol  byte
+	envHalt    bool
+	envSpeed   byte
+	volume     fdsEnvelope
+	output     int
+	modTable   [64]byte
+	modPos     byte
+	modAcc     uint16
+	modFreq    uint16
+	modHalt    bool
+	modCounter int
+	modEnv     fdsEnvelope
+	modOutput  int
+}
+
+func (a *fdsAudio) read(address uint16) byte {
+	switch {
+	case address <= 0x407F:
+		return a.wave[address-0x4040] | 0x40
+	case address == 0x4090:
+		return a.volume.gain | 0x40
+	case address == 0x4092:
+		return a.modEnv.gain | 0x40
+	}
+
+	return 0
+}
+
+func (a *fdsAudio) write(address uint16, value byte) {
+	switch {
+	case address <= 0x407F:
+		if a.waveWrite {
+			a.wave[address-0x4040] = value & 0x3F
+		}
+	case address == 0x4080:
+		a.volume.write(value, a.envSpeed)
+	case address == 0x4082:
+		a.waveFreq = a.waveFreq&0x0F00 | uint16(value)
+	case address == 0x4083:
+		a.waveFreq = a.waveFreq&0x00FF | uint16(value&0x0F)<<8
+		a.waveHalt = value&0x80 > 0
+		a.envHalt = value&0x40 > 0
+		if a.waveHalt {
+			a.wavePos = 0
+			a.waveAcc = 0
+		}
+	case address == 0x4084:
+		a.modEnv.write(value, a.envSpeed)
+	case address == 0x4085:
+		a.setModCounter(int(value & 0x7F))
+	case address == 0x4086:
+		a.modFreq = a.modFreq&0x0F00 | uint16(value)
+	case address == 0x4087:
+		a.modFreq = a.modFreq&0x00FF | uint16(value&0x0F)<<8
+		a.modHalt = value&0x80 > 0
+		if a.modHalt {
+			a.modAcc = 0
+		}
+	case address == 0x4088:
+		if a.modHalt {
+			a.modTable[a.modPos] = value & 0x07
+			a.modTable[(a.modPos+1)&0x3F] = value & 0x07
+			a.modPos = (a.modPos + 2) & 0x3F
+		}
+	case address == 0x4089:
+		a.waveWrite = value&0x80 > 0
+		a.masterVol = value & 0x03
+	case address == 0x408A:
+		a.envSpeed = value
+	}
+}
+
+// setModCounter sets the modulation counter, wrapping it to -64..63.
+func (a *fdsAudio) setModCounter(value int) {
+	value &= 0x7F
+	if value >= 64 {
+		value -= 128
+	}
+	a.modCounter = value
+}
+
+func (a *fdsAudio) clock() {
+	if !a.waveHalt && !a.envHalt && a.envSpeed > 0 {
+		a.volume.clock(a.envSpeed)
+		a.modEnv.clock(a.envSpeed)
+	}
+
+	a.clockModulator()
+	a.updateModOutput()
+
+	if a.waveWrite {
+		return
+	}
+	if a.waveHalt {
+		a.output = a.level(0)
+		return
+	}
+
+	a.output = a.level(a.wavePos)
+
+	freq := int(a.waveFreq) + a.modOutput
+	if freq <= 0 {
+		return
+	}
+	acc := uint32(a.waveAcc) + uint32(freq)
+	if acc > 0xFFFF {
+		a.wavePos = (a.wavePos + 1) & 0x3F
+	}
+	a.waveAcc = uint16(acc)
+}
+
+func (a *fdsAudio) clockModulator() {
+	if a.modHalt || a.modFreq == 0 {
+		return
+	}
+
+	acc := uint32(a.modAcc) + uint32(a.modFreq)
+	a.modAcc = uint16(acc)
+	if acc <= 0xFFFF {
+		return
+	}
+
+	step := a.modTable[a.modPos]
+	if step == 4 {
+		a.setModCounter(0)
+	} else {
+		a.setModCounter(a.modCounter + fdsModAdjust[step])
+	}
+	a.modPos = (a.modPos + 1) & 0x3F
+}
+
+// updateModOutput computes the pitch adjustment of the wave from the
+// modulation counter and gain, rounding like the hardware does.
+func (a *fdsAudio) updateModOutput() {
+	temp := a.modCounter * int(a.modEnv.gain)
+	remainder := temp & 0x0F
+	temp >>= 4
+	if remainder > 0 && temp&0x80 == 0 {
+		if a.modCounter < 0 {
+			temp--
+		} else {
+			temp += 2
+		}
+	}
+
+	switch {
+	case temp >= 192:
+		temp -= 256
+	case temp < -64:
+		temp += 256
+	}
+
+	temp *= int(a.waveFreq)
+	remainder = temp & 0x3F
+	temp >>= 6
+	if remainder >= 32 {
+		temp++
+	}
+
+	a.modOutput = temp
+}
+
+// level is the output for the wave sample at pos, the gain saturates at 32.
+func (a *fdsAudio) level(pos byte) int {
+	gain := int(a.volume.gain)
+	if gain > 32 {
+		gain = 32
+	}
+	return int(a.wave[pos]) * gain * fdsMasterVolumes[a.masterVol] / 1152
+}
+
+// fdsChannels names the single FDS channel.
+var fdsChannels = []string{"fds"}
+
+func (a *fdsAudio) sample(out []float32) {
+	out[0] = float32(a.output) * fdsVolume
+}
+
+// fdsEnvelope moves its gain towards 0 or 32, one step every
+// 8 * (speed+1) * master speed CPU cycles. In fixed mode the gain is simply
+// the speed bits.
+type fdsEnvelope struct {
+	speed    byte
+	increase bool
+	fixed    bool
+	gain     byte
+	timer    int
+}
+
+func (e *fdsEnvelope) write(value, masterSpeed byte) {
+	e.speed = value & 0x3F
+	e.increase = value&0x40 > 0
+	e.fixed = value&0x80 > 0
+	e.timer = 8 * (int(e.speed) + 1) * int(masterSpeed)
+	if e.fixed {
+		e.gain = e.speed
+	}
+}
+
+func (e *fdsEnvelope) clock(masterSpeed byte) {
+	if e.fixed {
+		return
+	}
+
+	e.timer--
+	if e.timer > 0 {
+		return
+	}
+	e.timer = 8 * (int(e.speed) + 1) * int(masterSpeed)
+
+	switch {
+	case e.increase && e.gain < 32:
+		e.gain++
+	case !e.increase && e.gain > 0:
+		e.gain--
+	}
+}
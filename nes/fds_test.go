@@ -0,0 +1,248 @@
+package nes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testDiskSide returns a side with the disk info block, the file amount block
+// and a single file with the given contents.
+func testDiskSide(file []byte) []byte {
+	side := make([]byte, fdsSideLen)
+
+	info := append([]byte{0x01}, fdsVerify...)
+	copy(side, info)
+	pos := 56
+
+	side[pos], side[pos+1] = 0x02, 1
+	pos += 2
+
+	side[pos] = 0x03
+	side[pos+13], side[pos+14] = byte(len(file)), byte(len(file)>>8)
+	pos += 16
+
+	side[pos] = 0x04
+	copy(side[pos+1:], file)
+	return side
+}
+
+func testDisk(sides ...[]byte) []byte {
+	image := append([]byte{}, fdsMagic...)
+	image = append(image, byte(len(sides)))
+	image = append(image, make([]byte, fdsHeaderLen-len(image))...)
+	for _, side := range sides {
+		image = append(image, side...)
+	}
+	return image
+}
+
+func TestLoadDisk(t *testing.T) {
+	bios := make([]byte, fdsBIOSSize)
+	bios[0x1FFC] = 0x42 // reset vector low byte
+
+	image := testDisk(testDiskSide([]byte("ab")), testDiskSide([]byte("cd")))
+	if !isDisk(image) || !isDisk(image[fdsHeaderLen:]) {
+		t.Fatalf("isDisk() = false for a disk image")
+	}
+
+	c, err := loadDisk(image, bios)
+	if err != nil {
+		t.Fatalf("loadDisk() unexpected error %v", err)
+	}
+	m := c.mapper.(*fds)
+	if len(m.sides) != 2 {
+		t.Fatalf("sides = %d, want 2", len(m.sides))
+	}
+	if got := c.read(0xFFFC); got != 0x42 {
+		t.Errorf("$FFFC = %02X, want the bios", got)
+	}
+
+	// lead-in, then every block with the gap end mark, a crc and a gap
+	stream := m.sides[1]
+	if !bytes.Equal(stream[:fdsLeadIn], make([]byte, fdsLeadIn)) {
+		t.Errorf("missing lead-in")
+	}
+	pos := fdsLeadIn
+	for _, size := range []int{56, 2, 16, 3} {
+		if stream[pos] != 0x80 {
+			t.Fatalf("block at %d: no gap end mark", pos)
+		}
+		pos += 1 + size + 2 + fdsBlockGap
+	}
+	file := fdsLeadIn + 3*(1+2+fdsBlockGap) + 56 + 2 + 16 + 1
+	if got := string(stream[file+1 : file+3]); got != "cd" {
+		t.Errorf("file contents = %q, want %q", got, "cd")
+	}
+
+	if _, err := loadDisk(image, bios[:100]); err != errFDSBIOSSize {
+		t.Errorf("loadDisk() short bios: error %v, want %v", err, errFDSBIOSSize)
+	}
+	if _, err := loadDisk(image[:fdsHeaderLen+100], bios); err != errNoDiskSides {
+		t.Errorf("loadDisk() truncated: error %v, want %v", err, errNoDiskSides)
+	}
+
+	bad := testDiskSide(nil)
+	bad[56+2+13] = 0xFF // file larger than the side
+	bad[56+2+14] = 0xFF
+	if _, err := loadDisk(testDisk(bad), bios); err == nil {
+		t.Errorf("loadDisk() expected an error for a truncated block")
+	}
+}
+
+func newTestFDS(t *testing.T) *fds {
+	c, err := loadDisk(testDisk(testDiskSide([]byte("ab"))), make([]byte, fdsBIOSSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.mapper.(*fds)
+}
+
+func TestFDS_ReadDisk(t *testing.T) {
+	m := newTestFDS(t)
+	m.cpuWrite(0x4023, 0x01)
+	m.cpuWrite(0x4025, 0xC5) // irq, start, read, motor on
+
+	// the gap is skipped, the first byte handed over is the block type
+	for _, want := range append([]byte{0x01}, fdsVerify...) {
+		cycles := 0
+		for !m.irq() {
+			m.clock()
+			if cycles++; cycles > fdsRewindCycles+(fdsLeadIn+2)*(fdsByteCycles+1) {
+				t.Fatalf("no byte transferred after %d cycles", cycles)
+			}
+		}
+
+		if got := m.cpuRead(0x4031); got != want {
+			t.Fatalf("read %02X, want %02X", got, want)
+		}
+		if m.irq() {
+			t.Fatalf("reading $4031 didn't acknowledge the irq")
+		}
+	}
+
+	if got := m.cpuRead(0x4032); got&0x07 != 0 {
+		t.Errorf("drive status = %02X, want a ready disk", got)
+	}
+}
+
+func TestFDS_InsertDisk(t *testing.T) {
+	m := newTestFDS(t)
+	m.insertDisk(0)
+
+	if got := m.cpuRead(0x4032); got&0x01 == 0 {
+		t.Errorf("drive status = %02X, want no disk", got)
+	}
+	for i := 0; i < fdsInsertCycles; i++ {
+		m.clock()
+	}
+	if got := m.cpuRead(0x4032); got&0x01 != 0 {
+		t.Errorf("drive status = %02X, want a disk", got)
+	}
+}
+
+func TestFDS_TimerIRQ(t *testing.T) {
+	m := newTestFDS(t)
+	m.cpuWrite(0x4023, 0x01)
+	m.cpuWrite(0x4020, 0x02)
+	m.cpuWrite(0x4021, 0x00)
+	m.cpuWrite(0x4022, 0x03)
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 2; i++ {
+			m.clock()
+		}
+		if m.irq() {
+			t.Fatalf("round %d: irq fired early", round)
+		}
+		m.clock()
+		if !m.irq() {
+			t.Fatalf("round %d: irq didn't fire", round)
+		}
+		if got := m.cpuRead(0x4030); got&0x01 == 0 {
+			t.Errorf("round %d: $4030 = %02X, want the timer flag", round, got)
+		}
+		if m.irq() {
+			t.Errorf("round %d: reading $4030 didn't acknowledge the irq", round)
+		}
+	}
+
+	// without the disk registers enabled the timer is off
+	m.cpuWrite(0x4023, 0x00)
+	m.cpuWrite(0x4022, 0x03)
+	for i := 0; i < 10; i++ {
+		m.clock()
+	}
+	if m.irq() {
+		t.Errorf("irq fired with the disk registers disabled")
+	}
+}
+
+func TestFDSAudio_Wave(t *testing.T) {
+	var a fdsAudio
+	a.write(0x4089, 0x80)
+	for i := uint16(0); i < 64; i++ {
+		a.write(0x4040+i, byte(i))
+	}
+	a.write(0x4089, 0x00)    // full master volume
+	a.write(0x4080, 0x80|32) // fixed gain 32
+	a.write(0x4087, 0x80)    // no modulation
+	a.write(0x4082, 0x00)
+	a.write(0x4083, 0x04) // frequency $400, a step every 64 cycles
+
+	for step := 0; step < 4; step++ {
+		for i := 0; i < 64; i++ {
+			a.clock()
+		}
+		if got, want := a.output, step*32*36/1152; got != want {
+			t.Errorf("step %d: output %d, want %d", step, got, want)
+		}
+	}
+
+	a.write(0x4083, 0x84)
+	a.clock()
+	if a.wavePos != 0 {
+		t.Errorf("halting didn't reset the wave position")
+	}
+}
+
+func TestConsole_LoadPathDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vnes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	diskPath := filepath.Join(dir, "game.fds")
+	image := testDisk(testDiskSide(nil), testDiskSide(nil))
+	if err := ioutil.WriteFile(diskPath, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.LoadPath(diskPath); err == nil {
+		t.Fatalf("LoadPath() expected an error without a bios")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "disksys.rom"), make([]byte, fdsBIOSSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := console.LoadPath(diskPath); err != nil {
+		t.Fatalf("LoadPath() unexpected error %v", err)
+	}
+
+	if got := console.DiskSides(); got != 2 {
+		t.Errorf("DiskSides() = %d, want 2", got)
+	}
+	if err := console.InsertDisk(1); err != nil {
+		t.Errorf("InsertDisk() unexpected error %v", err)
+	}
+	if got := console.DiskSide(); got != 1 {
+		t.Errorf("DiskSide() = %d, want 1", got)
+	}
+	if err := console.InsertDisk(2); err == nil {
+		t.Errorf("InsertDisk() expected an error for a missing side")
+	}
+}
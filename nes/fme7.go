@@ -0,0 +1,354 @@
+package nes
+
+import "math"
+
+// FME-7 (mapper 69) is a Sunsoft board with four switchable 8K PRG banks, one
+// of them at $6000, eight 1K CHR banks and a CPU cycle IRQ counter. The
+// Sunsoft 5B variant adds an AY-3-8910 derived sound chip.
+//
+// The board has a command register and a parameter register:
+//
+//	$8000-$9FFF Command (bits 0-3)
+//	$A000-$BFFF Parameter
+//	$C000-$DFFF 5B audio register select
+//	$E000-$FFFF 5B audio register write
+//
+// Commands:
+//
+//	$0-$7  1K CHR bank
+//	$8     PRG bank at $6000, bit 6 selects RAM, bit 7 enables it
+//	$9-$B  8K PRG bank at $8000, $A000 and $C000
+//	$C     Mirroring (0 vertical, 1 horizontal, 2 one-screen low,
+//	       3 one-screen high)
+//	$D     IRQ control, bit 0 enables the IRQ and bit 7 the counter
+//	$E-$F  IRQ counter low and high byte
+//
+// The last bank is fixed at $E000.
+type fme7 struct {
+	cart *cartridge
+
+	command   byte
+	prgBanks  [4]byte // $6000 to $C000
+	chrBanks  [8]byte
+	mirroring byte
+
+	irqEnabled     bool
+	counterEnabled bool
+	irqCounter     uint16
+	irqPending     bool
+
+	audio sunsoft5B
+
+	prgOffsets [4]int // $6000 to $C000
+	chrOffsets [8]int
+}
+
+func newFME7(c *cartridge) Mapper {
+	m := &fme7{cart: c}
+	m.audio.noise.lfsr = 1
+	m.updateOffsets()
+	return m
+}
+
+func (m *fme7) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0xE000:
+		return m.cart.prg[bankOffset(m.cart.prg, -1, 0x2000)+int(address%0x2000)]
+	case address >= 0x8000:
+		slot := (address-0x8000)/0x2000 + 1
+		return m.cart.prg[m.prgOffsets[slot]+int(address%0x2000)]
+	case address >= 0x6000:
+		switch {
+		case m.prgBanks[0]&0x40 == 0:
+			return m.cart.prg[m.prgOffsets[0]+int(address%0x2000)]
+		case m.prgBanks[0]&0x80 > 0:
+			return m.cart.prgRAM[(m.prgOffsets[0]+int(address%0x2000))%len(m.cart.prgRAM)]
+		}
+	}
+
+	return 0
+}
+
+func (m *fme7) cpuWrite(address uint16, value byte) {
+	switch {
+	case address >= 0xE000:
+		m.audio.writeRegister(value)
+	case address >= 0xC000:
+		m.audio.selectRegister(value)
+	case address >= 0xA000:
+		m.writeParameter(value)
+	case address >= 0x8000:
+		m.command = value & 0x0F
+	case address >= 0x6000:
+		if m.prgBanks[0]&0xC0 == 0xC0 {
+			m.cart.prgRAM[(m.prgOffsets[0]+int(address%0x2000))%len(m.cart.prgRAM)] = value
+		}
+	}
+}
+
+func (m *fme7) writeParameter(value byte) {
+	switch {
+	case m.command <= 0x7:
+		m.chrBanks[m.command] = value
+	case m.command <= 0xB:
+		m.prgBanks[m.command-0x8] = value
+	case m.command == 0xC:
+		m.mirroring = value & 0x03
+	case m.command == 0xD:
+		m.irqEnabled = value&0x01 > 0
+		m.counterEnabled = value&0x80 > 0
+		m.irqPending = false
+	case m.command == 0xE:
+		m.irqCounter = m.irqCounter&0xFF00 | uint16(value)
+	case m.command == 0xF:
+		m.irqCounter = m.irqCounter&0x00FF | uint16(value)<<8
+	}
+
+	m.updateOffsets()
+}
+
+func (m *fme7) updateOffsets() {
+	if m.prgBanks[0]&0x40 > 0 {
+		m.prgOffsets[0] = bankOffset(m.cart.prgRAM, int(m.prgBanks[0]&0x3F), 0x2000)
+	} else {
+		m.prgOffsets[0] = bankOffset(m.cart.prg, int(m.prgBanks[0]&0x3F), 0x2000)
+	}
+	for i := 1; i < 4; i++ {
+		m.prgOffsets[i] = bankOffset(m.cart.prg, int(m.prgBanks[i]&0x3F), 0x2000)
+	}
+
+	for i, bank := range m.chrBanks {
+		m.chrOffsets[i] = bankOffset(m.cart.chr, int(bank), 0x0400)
+	}
+}
+
+func (m *fme7) ppuRead(address uint16) byte {
+	return m.cart.chr[m.chrOffsets[address/0x0400]+int(address%0x0400)]
+}
+
+func (m *fme7) ppuWrite(address uint16, value byte) {
+	if m.cart.chrRAM {
+		m.cart.chr[m.chrOffsets[address/0x0400]+int(address%0x0400)] = value
+	}
+}
+
+func (m *fme7) mirrorMode() mirrorMode {
+	switch m.mirroring {
+	case 0:
+		return vertical
+	case 1:
+		return horizontal
+	case 2:
+		return singleScreenLow
+	default:
+		return singleScreenHigh
+	}
+}
+
+func (m *fme7) irq() bool                 { return m.irqPending }
+func (m *fme7) ppuAddress(address uint16) {}
+
+func (m *fme7) clock() {
+	if m.counterEnabled {
+		m.irqCounter--
+		if m.irqCounter == 0xFFFF && m.irqEnabled {
+			m.irqPending = true
+		}
+	}
+
+	m.audio.clock()
+}
+
+func (m *fme7) audioChannels() []string { return sunsoft5BChannels }
+func (m *fme7) sample(out []float32)    { m.audio.sample(out) }
+
+// sunsoft5BVolume scales the 5B output to the APU's, a channel at full volume
+// is about as loud as a VRC6 pulse at full volume.
+const sunsoft5BVolume = 0.113
+
+// sunsoft5BLevels maps the 5 bit envelope levels to amplitudes, the chip
+// steps them by 1.5dB and level 0 is silence. The 4 bit channel volumes use
+// every other entry, 3dB per step.
+var sunsoft5BLevels = func() (levels [32]float32) {
+	for i := 1; i < len(levels); i++ {
+		levels[i] = float32(math.Pow(10, -1.5*float64(31-i)/20))
+	}
+	return levels
+}()
+
+// sunsoft5B is the sound hardware of the Sunsoft 5B: three square wave
+// channels that can be mixed with a shared noise generator and have either a
+// fixed volume or the shared envelope.
+//
+//	$00-$05  Tone period of channels A, B and C, low 8 and high 4 bits
+//	$06      Noise period (5 bits)
+//	$07      ..NN NTTT  noise and tone disable for each channel
+//	$08-$0A  ...E VVVV  envelope enable, volume of channels A, B and C
+//	$0B-$0C  Envelope period, low and high byte
+//	$0D      .... CAaH  envelope shape: continue, attack, alternate, hold
+//
+// The chip runs at the CPU clock with a divider of 16 in front of the tone,
+// noise and envelope counters, so a tone of period P plays at
+// CPU / (32 * P).
+type sunsoft5B struct {
+	reg  byte
+	regs [16]byte
+
+	divider  int
+	tones    [3]sunsoft5BTone
+	noise    sunsoft5BNoise
+	envelope sunsoft5BEnvelope
+}
+
+func (s *sunsoft5B) selectRegister(value byte) {
+	s.reg = value & 0x0F
+}
+
+func (s *sunsoft5B) writeRegister(value byte) {
+	s.regs[s.reg] = value
+
+	switch {
+	case s.reg <= 0x05:
+		ch := s.reg / 2
+		s.tones[ch].period = uint16(s.regs[ch*2+1]&0x0F)<<8 | uint16(s.regs[ch*2])
+	case s.reg == 0x06:
+		s.noise.period = value & 0x1F
+	case s.reg == 0x0B || s.reg == 0x0C:
+		s.envelope.period = uint16(s.regs[0x0C])<<8 | uint16(s.regs[0x0B])
+	case s.reg == 0x0D:
+		s.envelope.reset(value)
+	}
+}
+
+func (s *sunsoft5B) clock() {
+	s.divider++
+	if s.divider < 16 {
+		return
+	}
+	s.divider = 0
+
+	for i := range s.tones {
+		s.tones[i].clock()
+	}
+	s.noise.clock()
+	s.envelope.clock()
+}
+
+// sunsoft5BChannels names the 5B channels, in the order sample writes them.
+var sunsoft5BChannels = []string{"5b_a", "5b_b", "5b_c"}
+
+func (s *sunsoft5B) sample(out []float32) {
+	for i, t := range s.tones {
+		out[i] = 0
+
+		toneOff := s.regs[0x07]>>uint(i)&1 > 0
+		noiseOff := s.regs[0x07]>>uint(i+3)&1 > 0
+		if !(t.high || toneOff) || !(s.noise.high() || noiseOff) {
+			continue
+		}
+
+		volume := s.regs[0x08+i]
+		if volume&0x10 > 0 {
+			out[i] = sunsoft5BLevels[s.envelope.level()] * sunsoft5BVolume
+		} else if volume&0x0F > 0 {
+			out[i] = sunsoft5BLevels[volume&0x0F*2+1] * sunsoft5BVolume
+		}
+	}
+}
+
+type sunsoft5BTone struct {
+	period uint16
+	timer  uint16
+	high   bool
+}
+
+func (t *sunsoft5BTone) clock() {
+	t.timer++
+	if t.timer >= t.period {
+		t.timer = 0
+		t.high = !t.high
+	}
+}
+
+// sunsoft5BNoise is a 17 bit LFSR with taps on bits 0 and 3.
+type sunsoft5BNoise struct {
+	period byte
+	timer  byte
+	lfsr   uint32
+}
+
+func (n *sunsoft5BNoise) clock() {
+	n.timer++
+	if n.timer < n.period {
+		return
+	}
+	n.timer = 0
+
+	bit := (n.lfsr ^ n.lfsr>>3) & 1
+	n.lfsr = n.lfsr>>1 | bit<<16
+}
+
+func (n *sunsoft5BNoise) high() bool {
+	return n.lfsr&1 > 0
+}
+
+// sunsoft5BEnvelope steps through 32 levels, up if the attack bit is set and
+// down otherwise. At the end of a ramp it stops at 0 without the continue
+// bit, holds the last level (flipped with alternate) with the hold bit, and
+// starts the next ramp otherwise, in the opposite direction with alternate.
+type sunsoft5BEnvelope struct {
+	period uint16
+	timer  uint16
+	shape  byte
+
+	step    byte
+	attack  bool
+	holding bool
+}
+
+func (e *sunsoft5BEnvelope) reset(shape byte) {
+	e.shape = shape & 0x0F
+	e.timer = 0
+	e.step = 0
+	e.attack = shape&0x04 > 0
+	e.holding = false
+}
+
+func (e *sunsoft5BEnvelope) clock() {
+	e.timer++
+	if e.timer < e.period {
+		return
+	}
+	e.timer = 0
+
+	if e.holding {
+		return
+	}
+	if e.step < 31 {
+		e.step++
+		return
+	}
+
+	switch {
+	case e.shape&0x08 == 0:
+		e.holding = true
+		e.attack = false
+	case e.shape&0x01 > 0:
+		e.holding = true
+		if e.shape&0x02 > 0 {
+			e.attack = !e.attack
+		}
+	default:
+		if e.shape&0x02 > 0 {
+			e.attack = !e.attack
+		}
+		e.step = 0
+	}
+}
+
+func (e *sunsoft5BEnvelope) level() byte {
+	if e.attack {
+		return e.step
+	}
+	return 31 - e.step
+}
@@ -0,0 +1,139 @@
+package nes
+
+import "testing"
+
+func TestFME7_Banking(t *testing.T) {
+	c := newTestBoard(69, 0)
+	command := func(cmd, value byte) {
+		c.mapper.cpuWrite(0x8000, cmd)
+		c.mapper.cpuWrite(0xA000, value)
+	}
+
+	command(0x8, 2)
+	command(0x9, 3)
+	command(0xA, 4)
+	command(0xB, 5)
+	command(0x1, 17)
+	command(0x7, 21)
+
+	for slot, want := range [5]byte{2, 3, 4, 5, 31} {
+		addr := 0x6000 + uint16(slot)*0x2000
+		if got := c.mapper.cpuRead(addr); got != want {
+			t.Errorf("$%04X bank = %d, want %d", addr, got, want)
+		}
+	}
+	if got := c.mapper.ppuRead(0x0400); got != 17 {
+		t.Errorf("$0400 bank = %d, want 17", got)
+	}
+	if got := c.mapper.ppuRead(0x1C00); got != 21 {
+		t.Errorf("$1C00 bank = %d, want 21", got)
+	}
+
+	// RAM selected but disabled
+	command(0x8, 0x40)
+	c.mapper.cpuWrite(0x6000, 0x42)
+	if got := c.mapper.cpuRead(0x6000); got != 0 {
+		t.Errorf("disabled ram: $6000 = %02X, want 00", got)
+	}
+
+	command(0x8, 0xC0)
+	c.mapper.cpuWrite(0x6000, 0x42)
+	if got := c.mapper.cpuRead(0x6000); got != 0x42 {
+		t.Errorf("ram: $6000 = %02X, want 42", got)
+	}
+}
+
+func TestFME7_IRQ(t *testing.T) {
+	c := newTestBoard(69, 0)
+	command := func(cmd, value byte) {
+		c.mapper.cpuWrite(0x8000, cmd)
+		c.mapper.cpuWrite(0xA000, value)
+	}
+
+	command(0xE, 2)
+	command(0xF, 0)
+	command(0xD, 0x81)
+
+	for i := 0; i < 2; i++ {
+		c.mapper.clock()
+	}
+	if c.mapper.irq() {
+		t.Fatalf("irq fired early")
+	}
+	c.mapper.clock()
+	if !c.mapper.irq() {
+		t.Fatalf("irq didn't fire when the counter wrapped")
+	}
+
+	command(0xD, 0x80)
+	if c.mapper.irq() {
+		t.Errorf("writing the control didn't acknowledge the irq")
+	}
+
+	// the counter keeps going without firing
+	for i := 0; i < 0x10000; i++ {
+		c.mapper.clock()
+	}
+	if c.mapper.irq() {
+		t.Errorf("irq fired while disabled")
+	}
+}
+
+func TestSunsoft5B_Tone(t *testing.T) {
+	var s sunsoft5B
+	s.noise.lfsr = 1
+	write := func(reg, value byte) {
+		s.selectRegister(reg)
+		s.writeRegister(value)
+	}
+
+	write(0x00, 2)    // channel A, period 2
+	write(0x07, 0x3E) // only tone A
+	write(0x08, 0x0F)
+
+	// 2 * 16 cpu cycles high, 2 * 16 low
+	high := sunsoft5BLevels[31] * sunsoft5BVolume
+	got := make([]float32, len(sunsoft5BChannels))
+	for i := 0; i < 128; i++ {
+		s.clock()
+
+		want := float32(0)
+		if (i+1)/32%2 == 1 {
+			want = high
+		}
+		if s.sample(got); got[0] != want || got[1] != 0 || got[2] != 0 {
+			t.Fatalf("cycle %d: sample = %v, want [%f 0 0]", i, got, want)
+		}
+	}
+}
+
+func TestSunsoft5B_Envelope(t *testing.T) {
+	tests := []struct {
+		shape byte
+		want  []byte // level at the start of each of 3 ramps
+	}{
+		{0x00, []byte{31, 0, 0}},   // \___
+		{0x04, []byte{0, 0, 0}},    // /___
+		{0x08, []byte{31, 31, 31}}, // \\\\
+		{0x0A, []byte{31, 0, 31}},  // \/\/
+		{0x0B, []byte{31, 31, 31}}, // \‾‾‾
+		{0x0C, []byte{0, 0, 0}},    // ////
+		{0x0D, []byte{0, 31, 31}},  // /‾‾‾
+		{0x0E, []byte{0, 31, 0}},   // /\/\
+	}
+
+	for _, tt := range tests {
+		var e sunsoft5BEnvelope
+		e.period = 1
+		e.reset(tt.shape)
+
+		for ramp, want := range tt.want {
+			if got := e.level(); got != want {
+				t.Errorf("shape %X ramp %d: level %d, want %d", tt.shape, ramp, got, want)
+			}
+			for i := 0; i < 32; i++ {
+				e.clock()
+			}
+		}
+	}
+}
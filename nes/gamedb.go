@@ -0,0 +1,166 @@
+package nes
+
+//go:generate go run ../cmd/embed -o assets.go gamedb.txt
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gameDBEntry is a game in the database, see gamedb.txt for the format.
+// Numeric fields are -1 and mirroring is 0 when the header should be kept.
+type gameDBEntry struct {
+	sha1      string
+	mapper    int
+	submapper int
+	mirroring byte
+	battery   int
+	title     string
+}
+
+var gameDB struct {
+	once    sync.Once
+	entries map[uint32]gameDBEntry
+	err     error
+}
+
+func loadGameDB() {
+	f, err := assets.Open("gamedb.txt")
+	if err != nil {
+		gameDB.err = fmt.Errorf("nes: unable to open game database: %s", err)
+		return
+	}
+	defer f.Close()
+
+	gameDB.entries, gameDB.err = parseGameDB(f)
+}
+
+func parseGameDB(r io.Reader) (map[uint32]gameDBEntry, error) {
+	entries := make(map[uint32]gameDBEntry)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("nes: game database line %d: expected 7 fields, got %d", line, len(fields))
+		}
+
+		crc, err := strconv.ParseUint(fields[0], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("nes: game database line %d: invalid crc32: %s", line, err)
+		}
+		if _, ok := entries[uint32(crc)]; ok {
+			return nil, fmt.Errorf("nes: game database line %d: duplicate crc32 %s", line, fields[0])
+		}
+
+		e := gameDBEntry{
+			mapper:    -1,
+			submapper: -1,
+			battery:   -1,
+			title:     strings.Join(fields[6:], " "),
+		}
+
+		if fields[1] != "-" {
+			e.sha1 = strings.ToLower(fields[1])
+		}
+		if fields[2] != "-" {
+			if e.mapper, err = strconv.Atoi(fields[2]); err != nil {
+				return nil, fmt.Errorf("nes: game database line %d: invalid mapper: %s", line, err)
+			}
+		}
+		if fields[3] != "-" {
+			if e.submapper, err = strconv.Atoi(fields[3]); err != nil {
+				return nil, fmt.Errorf("nes: game database line %d: invalid submapper: %s", line, err)
+			}
+		}
+		switch fields[4] {
+		case "h", "v", "4":
+			e.mirroring = fields[4][0]
+		case "-":
+		default:
+			return nil, fmt.Errorf("nes: game database line %d: invalid mirroring %q", line, fields[4])
+		}
+		switch fields[5] {
+		case "y":
+			e.battery = 1
+		case "n":
+			e.battery = 0
+		case "-":
+		default:
+			return nil, fmt.Errorf("nes: game database line %d: invalid battery %q", line, fields[5])
+		}
+
+		entries[uint32(crc)] = e
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("nes: unable to read game database: %s", err)
+	}
+
+	return entries, nil
+}
+
+// applyGameDB looks the game up by the checksums of its ROMs and corrects
+// info with what the database knows about it.
+func applyGameDB(info *CartridgeInfo, prg, chr []byte) error {
+	gameDB.once.Do(loadGameDB)
+	if gameDB.err != nil {
+		return gameDB.err
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(prg)
+	crc.Write(chr)
+
+	e, ok := gameDB.entries[crc.Sum32()]
+	if !ok {
+		return nil
+	}
+
+	if e.sha1 != "" {
+		sum := sha1.New()
+		sum.Write(prg)
+		sum.Write(chr)
+		if hex.EncodeToString(sum.Sum(nil)) != e.sha1 {
+			return nil
+		}
+	}
+
+	info.Title = e.title
+	info.InDatabase = true
+
+	if e.mapper >= 0 && uint16(e.mapper) != info.Mapper {
+		info.Mapper = uint16(e.mapper)
+		info.Overridden = true
+	}
+	if e.submapper >= 0 && byte(e.submapper) != info.Submapper {
+		info.Submapper = byte(e.submapper)
+		info.Overridden = true
+	}
+	if e.mirroring != 0 {
+		vertical, fourScreen := e.mirroring == 'v', e.mirroring == '4'
+		if vertical != info.VerticalMirroring || fourScreen != info.FourScreen {
+			info.VerticalMirroring = vertical
+			info.FourScreen = fourScreen
+			info.Overridden = true
+		}
+	}
+	if e.battery >= 0 && (e.battery == 1) != info.Battery {
+		info.Battery = e.battery == 1
+		info.Overridden = true
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package nes
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGameDB_Lookup(t *testing.T) {
+	f, err := os.Open("../roms/cpu/nestest/nestest.nes")
+	if err != nil {
+		t.Fatal("unable to open rom")
+	}
+	defer f.Close()
+
+	c, err := loadRom(f)
+	if err != nil {
+		t.Fatalf("loadRom() unexpected error %v", err)
+	}
+
+	if !c.info.InDatabase || c.info.Title != "nestest" {
+		t.Errorf("nestest not found in the database, got %+v", c.info)
+	}
+	if c.info.Overridden {
+		t.Errorf("nestest has a good header, but it was overridden")
+	}
+}
+
+func TestGameDB_BadHeader(t *testing.T) {
+	rom, err := ioutil.ReadFile("../roms/cpu/cpu_dummy_reads/cpu_dummy_reads.nes")
+	if err != nil {
+		t.Fatal("unable to open rom")
+	}
+	// the dump is CNROM with vertical mirroring, make the header claim NROM
+	// with horizontal mirroring
+	rom[6], rom[7] = 0x00, 0x00
+
+	c, err := loadRom(bytes.NewReader(rom))
+	if err != nil {
+		t.Fatalf("loadRom() unexpected error %v", err)
+	}
+
+	if !c.info.Overridden || c.info.Title != "cpu_dummy_reads" {
+		t.Errorf("override not applied, got %+v", c.info)
+	}
+	if c.info.Mapper != 3 {
+		t.Errorf("mapper = %d, want %d", c.info.Mapper, 3)
+	}
+	if c.mirrorMode != vertical {
+		t.Errorf("mirroring = %v, want %v", c.mirrorMode, vertical)
+	}
+}
+
+func TestGameDB_Override(t *testing.T) {
+	// a header claiming mapper 0 with horizontal mirroring and no battery
+	rom := []byte{'N', 'E', 'S', 0x1a, 1, 1, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}
+	rom = append(rom, bytes.Repeat([]byte{0xAB}, prgMul+chrMul)...)
+
+	gameDB.once.Do(loadGameDB)
+	crc := crc32.ChecksumIEEE(rom[16:])
+	gameDB.entries[crc] = gameDBEntry{mapper: 1, submapper: -1, mirroring: 'v', battery: 1, title: "Bad Header"}
+	defer delete(gameDB.entries, crc)
+
+	c, err := loadRom(bytes.NewReader(rom))
+	if err != nil {
+		t.Fatalf("loadRom() unexpected error %v", err)
+	}
+
+	if !c.info.Overridden || c.info.Title != "Bad Header" {
+		t.Errorf("override not applied, got %+v", c.info)
+	}
+	if _, ok := c.mapper.(*mmc1); !ok {
+		t.Errorf("mapper = %T, want %T", c.mapper, &mmc1{})
+	}
+	if c.mirrorMode != vertical || !c.saveRAM {
+		t.Errorf("mirroring = %v, battery = %v, want %v, %v", c.mirrorMode, c.saveRAM, vertical, true)
+	}
+}
+
+func TestGameDB_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		db      string
+		wantErr bool
+	}{
+		{"valid", "# comment\n\n0000abcd - 4 1 4 y Some Game (U)\n", false},
+		{"missing fields", "0000abcd - 4 1 4\n", true},
+		{"bad crc", "xyz - 4 1 4 y Game\n", true},
+		{"bad mirroring", "0000abcd - 4 1 x y Game\n", true},
+		{"bad battery", "0000abcd - 4 1 h x Game\n", true},
+		{"duplicate", "0000abcd - 4 - - - A\n0000abcd - 1 - - - B\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseGameDB(strings.NewReader(tt.db))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGameDB() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			want := gameDBEntry{mapper: 4, submapper: 1, mirroring: '4', battery: 1, title: "Some Game (U)"}
+			if got := entries[0xabcd]; got != want {
+				t.Errorf("entry = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// HeaderFormat is the flavour of the iNES header a rom was dumped with.
+type HeaderFormat int
+
+const (
+	// ArchaicINES headers have garbage in bytes 7-15, usually the name of
+	// the tool that made the dump, so only the first 7 bytes are trusted.
+	ArchaicINES HeaderFormat = iota
+	INES
+	NES20
+
+	// UNIF roms are a list of chunks, and name the board instead of giving
+	// it a mapper number.
+	UNIF
+
+	// FDS is a Famicom Disk System disk image, there's no cartridge header.
+	FDS
+
+	// NSF is a music file, the cartridge is made up around the tune.
+	NSF
+)
+
+func (f HeaderFormat) String() string {
+	switch f {
+	case ArchaicINES:
+		return "archaic iNES"
+	case INES:
+		return "iNES"
+	case NES20:
+		return "NES 2.0"
+	case UNIF:
+		return "UNIF"
+	case FDS:
+		return "FDS"
+	case NSF:
+		return "NSF"
+	default:
+		return fmt.Sprintf("HeaderFormat(%d)", int(f))
+	}
+}
+
+// Timing is the CPU/PPU timing the cartridge was made for.
+type Timing int
+
+const (
+	NTSC Timing = iota
+	PAL
+	MultiRegion
+	Dendy
+)
+
+func (t Timing) String() string {
+	switch t {
+	case NTSC:
+		return "NTSC"
+	case PAL:
+		return "PAL"
+	case MultiRegion:
+		return "multi-region"
+	case Dendy:
+		return "Dendy"
+	default:
+		return fmt.Sprintf("Timing(%d)", int(t))
+	}
+}
+
+// ConsoleType is the system the cartridge runs on.
+type ConsoleType int
+
+const (
+	NES ConsoleType = iota
+	VSSystem
+	PlayChoice10
+	ExtendedConsole
+)
+
+func (c ConsoleType) String() string {
+	switch c {
+	case NES:
+		return "NES"
+	case VSSystem:
+		return "VS System"
+	case PlayChoice10:
+		return "PlayChoice-10"
+	case ExtendedConsole:
+		return "extended"
+	default:
+		return fmt.Sprintf("ConsoleType(%d)", int(c))
+	}
+}
+
+// CartridgeInfo is what the header says about a cartridge, after being
+// corrected by the game database. Sizes are in bytes. Fields that only exist
+// in NES 2.0 are left zeroed for older headers.
+type CartridgeInfo struct {
+	Format HeaderFormat
+
+	// Title is only known for games found in the database. Overridden
+	// reports whether the database changed any of the header fields.
+	Title      string
+	InDatabase bool
+	Overridden bool
+
+	Mapper    uint16
+	Submapper byte
+
+	PRGROMSize   int
+	CHRROMSize   int
+	PRGRAMSize   int
+	PRGNVRAMSize int
+	CHRRAMSize   int
+	CHRNVRAMSize int
+
+	VerticalMirroring bool
+	FourScreen        bool
+	Battery           bool
+	Trainer           bool
+
+	Timing      Timing
+	ConsoleType ConsoleType
+
+	// VSPPUType and VSHardwareType are only valid for VS System games,
+	// ExtendedConsoleType only when ConsoleType is ExtendedConsole.
+	VSPPUType           byte
+	VSHardwareType      byte
+	ExtendedConsoleType byte
+
+	MiscROMs        int
+	ExpansionDevice byte
+}
+
+type header struct {
+	// String "NES^Z" used to recognize .NES files.
+	Magic [4]byte
+
+	// Number of 16kB ROM banks.
+	ROMBanks byte
+
+	// Number of 8kB VROM banks.
+	CHROMBanks byte
+
+	// 76543210
+	// ||||||||
+	// |||||||+- Mirroring: 0: horizontal (vertical arrangement)
+	// |||||||                 (CIRAM A10 = PPU A11)
+	// |||||||              1: vertical (horizontal arrangement)
+	// |||||||                 (CIRAM A10 = PPU A10)
+	// ||||||+-- 1: Cartridge contains battery-backed
+	// ||||||       PRG RAM ($6000-7FFF) or other persistent memory
+	// |||||+--- 1: 512-byte trainer at $7000-$71FF (stored before PRG data)
+	// ||||+---- 1: Ignore mirroring control or above mirroring bit;
+	// ||||         instead provide four-screen VRAM
+	// ++++----- Lower nybble of mapper number
+	ROMControl1 byte
+
+	// 76543210
+	// ||||||||
+	// |||||||+- VS Unisystem
+	// ||||||+-- PlayChoice10, 8KB of Hint Screen data stored after CHR data
+	// ||||++--- If equal to 2, flags 8-15 are in NES 2.0 format
+	// ++++----- Upper nybble of mapper number
+	//
+	// In NES 2.0 bits 0-1 are the console type: 0 NES, 1 VS System,
+	// 2 PlayChoice-10, 3 extended console type.
+	ROMControl2 byte
+
+	// iNES: Number of 8kB RAM banks. For compatibility with the previous
+	// versions of the .NES format, assume 1x8kB RAM page when this
+	// byte is zero.
+	//
+	// NES 2.0: submapper in the upper nybble, bits 8-11 of the mapper
+	// number in the lower one.
+	PRGRAMSize byte
+
+	// iNES: bit 0 is the TV system, 0: NTSC, 1: PAL.
+	//
+	// NES 2.0: upper bits of the CHR (upper nybble) and PRG (lower nybble)
+	// ROM sizes. A value of $F means the size is in exponent-multiplier
+	// notation instead.
+	Flags9 byte
+
+	// NES 2.0 only: PRG-NVRAM (upper nybble) and PRG-RAM (lower nybble)
+	// shift counts, the size is 64 << shift, 0 means none.
+	Flags10 byte
+
+	// NES 2.0 only: CHR-NVRAM and CHR-RAM shift counts, like Flags10.
+	Flags11 byte
+
+	// NES 2.0 only: bits 0-1 are the timing, 0: NTSC, 1: PAL,
+	// 2: multi-region, 3: Dendy.
+	Flags12 byte
+
+	// NES 2.0 only: for VS System games the hardware type (upper nybble) and
+	// PPU type (lower nybble), for extended consoles the console type in
+	// the lower nybble.
+	Flags13 byte
+
+	// NES 2.0 only: bits 0-1 are the number of miscellaneous ROMs.
+	Flags14 byte
+
+	// NES 2.0 only: bits 0-5 are the default expansion device.
+	Flags15 byte
+}
+
+func readHeader(r io.Reader) (header, error) {
+	var h header
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return h, fmt.Errorf("nes: unable to read header: %s", err)
+	}
+
+	if !bytes.Equal(h.Magic[:], inesMagic) {
+		return h, errNoMagic
+	}
+
+	return h, nil
+}
+
+func (h header) format() HeaderFormat {
+	switch h.ROMControl2 & 0x0C {
+	case 0x08:
+		return NES20
+	case 0x00:
+		if h.Flags12 == 0 && h.Flags13 == 0 && h.Flags14 == 0 && h.Flags15 == 0 {
+			return INES
+		}
+	}
+
+	return ArchaicINES
+}
+
+func (h header) info() CartridgeInfo {
+	info := CartridgeInfo{
+		Format:            h.format(),
+		Mapper:            uint16(h.ROMControl1 >> 4),
+		PRGROMSize:        int(h.ROMBanks) * prgMul,
+		CHRROMSize:        int(h.CHROMBanks) * chrMul,
+		VerticalMirroring: h.ROMControl1&rc1MirrorModeVertical > 0,
+		FourScreen:        h.ROMControl1&rc1FourScreen > 0,
+		Battery:           h.ROMControl1&rc1SaveRAM > 0,
+		Trainer:           h.ROMControl1&rc1Trainer > 0,
+	}
+
+	switch info.Format {
+	case ArchaicINES:
+		info.PRGRAMSize = sramSize
+		if info.CHRROMSize == 0 {
+			info.CHRRAMSize = chrMul
+		}
+
+	case INES:
+		info.Mapper |= uint16(h.ROMControl2 & 0xF0)
+		info.ConsoleType = ConsoleType(h.ROMControl2 & 0x03)
+		if info.ConsoleType == ExtendedConsole { // both bits set, pick one
+			info.ConsoleType = VSSystem
+		}
+
+		info.PRGRAMSize = int(h.PRGRAMSize) * sramSize
+		if info.PRGRAMSize == 0 {
+			info.PRGRAMSize = sramSize
+		}
+		if info.CHRROMSize == 0 {
+			info.CHRRAMSize = chrMul
+		}
+		if h.Flags9&0x01 > 0 {
+			info.Timing = PAL
+		}
+
+	case NES20:
+		info.Mapper |= uint16(h.ROMControl2&0xF0) | uint16(h.PRGRAMSize&0x0F)<<8
+		info.Submapper = h.PRGRAMSize >> 4
+		info.ConsoleType = ConsoleType(h.ROMControl2 & 0x03)
+
+		info.PRGROMSize = romSize(h.ROMBanks, h.Flags9&0x0F, prgMul)
+		info.CHRROMSize = romSize(h.CHROMBanks, h.Flags9>>4, chrMul)
+		info.PRGRAMSize = shiftSize(h.Flags10 & 0x0F)
+		info.PRGNVRAMSize = shiftSize(h.Flags10 >> 4)
+		info.CHRRAMSize = shiftSize(h.Flags11 & 0x0F)
+		info.CHRNVRAMSize = shiftSize(h.Flags11 >> 4)
+
+		info.Timing = Timing(h.Flags12 & 0x03)
+		switch info.ConsoleType {
+		case VSSystem:
+			info.VSPPUType = h.Flags13 & 0x0F
+			info.VSHardwareType = h.Flags13 >> 4
+		case ExtendedConsole:
+			info.ExtendedConsoleType = h.Flags13 & 0x0F
+		}
+		info.MiscROMs = int(h.Flags14 & 0x03)
+		info.ExpansionDevice = h.Flags15 & 0x3F
+	}
+
+	return info
+}
+
+// romSize decodes a NES 2.0 ROM size from its LSB and the 4 MSBs. When the
+// MSBs are all set the LSB holds the size as 2^E * (MM*2+1), EEEEEEMM.
+// Exponents too big for any real rom give maxROMSize+1, instead of
+// overflowing.
+func romSize(lsb, msb byte, unit int) int {
+	if msb == 0x0F {
+		if lsb>>2 > 26 {
+			return maxROMSize + 1
+		}
+		return 1 << (lsb >> 2) * (int(lsb&0x03)*2 + 1)
+	}
+
+	return (int(msb)<<8 | int(lsb)) * unit
+}
+
+// shiftSize decodes a NES 2.0 RAM size, 64 << shift, with 0 meaning none.
+func shiftSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+
+	return 64 << shift
+}
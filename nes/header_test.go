@@ -0,0 +1,125 @@
+package nes
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestHeader_Info(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   CartridgeInfo
+	}{
+		{
+			name:   "iNES",
+			header: []byte{'N', 'E', 'S', 0x1a, 2, 1, 0x13, 0x41, 0, 1, 0, 0, 0, 0, 0, 0},
+			want: CartridgeInfo{
+				Format:            INES,
+				Mapper:            0x41,
+				PRGROMSize:        2 * prgMul,
+				CHRROMSize:        chrMul,
+				PRGRAMSize:        sramSize,
+				VerticalMirroring: true,
+				Battery:           true,
+				ConsoleType:       VSSystem,
+				Timing:            PAL,
+			},
+		},
+		{
+			name:   "iNES CHR-RAM",
+			header: []byte{'N', 'E', 'S', 0x1a, 8, 0, 0x20, 0, 2, 0, 0, 0, 0, 0, 0, 0},
+			want: CartridgeInfo{
+				Format:     INES,
+				Mapper:     2,
+				PRGROMSize: 8 * prgMul,
+				PRGRAMSize: 2 * sramSize,
+				CHRRAMSize: chrMul,
+			},
+		},
+		{
+			name:   "archaic iNES",
+			header: []byte{'N', 'E', 'S', 0x1a, 2, 1, 0x41, 'D', 'i', 's', 'k', 'D', 'u', 'd', 'e', '!'},
+			want: CartridgeInfo{
+				Format:            ArchaicINES,
+				Mapper:            4,
+				PRGROMSize:        2 * prgMul,
+				CHRROMSize:        chrMul,
+				PRGRAMSize:        sramSize,
+				VerticalMirroring: true,
+			},
+		},
+		{
+			name:   "NES 2.0",
+			header: []byte{'N', 'E', 'S', 0x1a, 0x00, 0x00, 0x46, 0x19, 0x32, 0x21, 0x70, 0x07, 0x02, 0x00, 0x01, 0x01},
+			want: CartridgeInfo{
+				Format:          NES20,
+				Mapper:          0x214,
+				Submapper:       3,
+				PRGROMSize:      0x100 * prgMul,
+				CHRROMSize:      0x200 * chrMul,
+				PRGNVRAMSize:    8192,
+				CHRRAMSize:      8192,
+				Battery:         true,
+				Trainer:         true,
+				ConsoleType:     VSSystem,
+				Timing:          MultiRegion,
+				MiscROMs:        1,
+				ExpansionDevice: 1,
+			},
+		},
+		{
+			name:   "NES 2.0 exponent-multiplier",
+			header: []byte{'N', 'E', 'S', 0x1a, 0x4D, 0x00, 0x00, 0x0B, 0x00, 0x0F, 0x00, 0x00, 0x03, 0x21, 0x00, 0x00},
+			want: CartridgeInfo{
+				Format:              NES20,
+				PRGROMSize:          (1 << 19) * 3,
+				ConsoleType:         ExtendedConsole,
+				ExtendedConsoleType: 1,
+				Timing:              Dendy,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := readHeader(bytes.NewReader(tt.header))
+			if err != nil {
+				t.Fatalf("readHeader() unexpected error %v", err)
+			}
+
+			if got := h.info(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("info() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeader_NoMagic(t *testing.T) {
+	_, err := readHeader(bytes.NewReader(make([]byte, 16)))
+	if err != errNoMagic {
+		t.Errorf("readHeader() error = %v, want %v", err, errNoMagic)
+	}
+}
+
+func TestParseRom_Sizes(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   error
+	}{
+		{"no PRG", []byte{'N', 'E', 'S', 0x1a, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, errNoPRG},
+		{"exponent overflow", []byte{'N', 'E', 'S', 0x1a, 0xFF, 0, 0, 0x08, 0, 0x0F, 0, 0, 0, 0, 0, 0}, errROMSize},
+		{"exponent too big", []byte{'N', 'E', 'S', 0x1a, 0x80, 0, 0, 0x08, 0, 0x0F, 0, 0, 0, 0, 0, 0}, errROMSize},
+		{"CHR too big", []byte{'N', 'E', 'S', 0x1a, 1, 0xFC, 0, 0x08, 0, 0xF0, 0, 0, 0, 0, 0, 0}, errROMSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseRom(bytes.NewReader(tt.header)); err != tt.want {
+				t.Errorf("parseRom() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
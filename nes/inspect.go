@@ -0,0 +1,106 @@
+package nes
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+)
+
+// Checksums of some data, as used by rom databases.
+type Checksums struct {
+	CRC32 uint32
+	SHA1  string
+}
+
+func checksums(data []byte) Checksums {
+	sum := sha1.Sum(data)
+	return Checksums{
+		CRC32: crc32.ChecksumIEEE(data),
+		SHA1:  hex.EncodeToString(sum[:]),
+	}
+}
+
+// RomInfo describes a rom file.
+type RomInfo struct {
+	CartridgeInfo
+
+	// Supported reports whether the mapper is implemented.
+	Supported bool
+
+	// DiskSides is the number of sides of a disk image.
+	DiskSides int
+
+	// File is the whole file as stored on disk, before any patch. CHR is
+	// left zeroed for boards with CHR-RAM, PRG and CHR for disk images.
+	File Checksums
+	PRG  Checksums
+	CHR  Checksums
+}
+
+// Inspect reads the rom at path, which may be inside a zip archive, without
+// loading it. Unlike LoadPath it works with unsupported mappers.
+func Inspect(path string) (RomInfo, error) {
+	f, err := openRom(path)
+	if err != nil {
+		return RomInfo{}, err
+	}
+	defer f.Close()
+
+	rom, err := ioutil.ReadAll(f)
+	if err != nil {
+		return RomInfo{}, fmt.Errorf("nes: unable to read rom: %s", err)
+	}
+
+	return inspectRom(rom)
+}
+
+func inspectRom(rom []byte) (RomInfo, error) {
+	if isDisk(rom) {
+		sides, err := diskSides(rom)
+		if err != nil {
+			return RomInfo{}, err
+		}
+
+		return RomInfo{
+			CartridgeInfo: diskInfo,
+			Supported:     true,
+			DiskSides:     len(sides),
+			File:          checksums(rom),
+		}, nil
+	}
+
+	if isNSF(rom) {
+		c, err := loadNSF(rom)
+		if err != nil {
+			return RomInfo{}, err
+		}
+
+		return RomInfo{
+			CartridgeInfo: c.info,
+			Supported:     true,
+			File:          checksums(rom),
+			PRG:           checksums(c.mapper.(*nsf).data),
+		}, nil
+	}
+
+	f, err := parseRom(bytes.NewReader(rom))
+	if err != nil {
+		return RomInfo{}, err
+	}
+
+	_, supported := mappers[f.info.Mapper]
+	info := RomInfo{
+		CartridgeInfo: f.info,
+		Supported:     supported,
+		File:          checksums(rom),
+		PRG:           checksums(f.prg),
+	}
+	if !f.chrRAM {
+		info.CHR = checksums(f.chr)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,58 @@
+package nes
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vnes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rom := testRom()
+	rom[6] = 0xF1 // mapper 15, vertical mirroring
+	rom[0x10] = 0x42
+	path := filepath.Join(dir, "game.zip")
+	writeZip(t, path, map[string][]byte{"game.nes": rom})
+
+	info, err := Inspect(path)
+	if err != nil {
+		t.Fatalf("Inspect() unexpected error %v", err)
+	}
+
+	if info.Mapper != 15 || info.Supported {
+		t.Errorf("mapper %d, supported %v, want 15 and unsupported", info.Mapper, info.Supported)
+	}
+	if !info.VerticalMirroring || info.PRGROMSize != prgMul || info.CHRROMSize != chrMul {
+		t.Errorf("info = %+v, want the header", info.CartridgeInfo)
+	}
+	if got, want := info.File.CRC32, crc32.ChecksumIEEE(rom); got != want {
+		t.Errorf("file crc = %08X, want %08X", got, want)
+	}
+	if got, want := info.PRG.CRC32, crc32.ChecksumIEEE(rom[16:16+prgMul]); got != want {
+		t.Errorf("prg crc = %08X, want %08X", got, want)
+	}
+	if got, want := info.CHR.SHA1, "0631457264ff7f8d5fb1edc2c0211992a67c73e6"; got != want {
+		t.Errorf("chr sha1 = %s, want %s", got, want)
+	}
+}
+
+func TestInspect_Disk(t *testing.T) {
+	info, err := inspectRom(testDisk(testDiskSide(nil), testDiskSide(nil)))
+	if err != nil {
+		t.Fatalf("inspectRom() unexpected error %v", err)
+	}
+
+	if info.Format != FDS || info.DiskSides != 2 || !info.Supported {
+		t.Errorf("info = %+v, want a supported disk with 2 sides", info)
+	}
+	if info.PRG != (Checksums{}) {
+		t.Errorf("prg = %+v, want no checksums for the bios", info.PRG)
+	}
+}
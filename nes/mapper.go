@@ -0,0 +1,121 @@
+package nes
+
+import "fmt"
+
+// Mapper is the board logic of a cartridge. Every CPU access in the cartridge
+// space ($4020-$FFFF) and every PPU access to the pattern tables
+// ($0000-$1FFF) is forwarded to it, which lets it do bank switching, expose
+// extra registers, drive the nametable mirroring and raise IRQs.
+type Mapper interface {
+	// cpuRead handles a CPU read in the $4020-$FFFF range.
+	cpuRead(address uint16) byte
+
+	// cpuWrite handles a CPU write in the $4020-$FFFF range.
+	cpuWrite(address uint16, value byte)
+
+	// ppuRead handles a PPU read in the $0000-$1FFF range.
+	ppuRead(address uint16) byte
+
+	// ppuWrite handles a PPU write in the $0000-$1FFF range.
+	ppuWrite(address uint16, value byte)
+
+	// mirrorMode returns the nametable arrangement currently selected by the
+	// board. Boards that can't switch it simply return the one in the header.
+	mirrorMode() mirrorMode
+
+	// irq reports whether the board is pulling the CPU /IRQ line low.
+	irq() bool
+
+	// ppuAddress is called every time the PPU puts an address on its bus,
+	// be it a rendering fetch or a $2006/$2007 access, before the data is
+	// read. Boards that count scanlines by watching PPU A12, or that switch
+	// banks when specific tiles are fetched, hook into this.
+	ppuAddress(address uint16)
+
+	// clock is called once per CPU cycle.
+	clock()
+}
+
+// nametableMapper is implemented by boards that decide what every nametable
+// access sees, instead of just picking an arrangement of the console VRAM.
+// ciram is the 2K of VRAM in the console, address is in $2000-$3EFF.
+type nametableMapper interface {
+	readNametable(address uint16, ciram [2]*[1024]byte) byte
+	writeNametable(address uint16, value byte, ciram [2]*[1024]byte)
+}
+
+// ppuRegisterWatcher is implemented by boards that snoop the CPU writes to
+// the PPU registers, which are visible on the cartridge connector.
+type ppuRegisterWatcher interface {
+	ppuRegisterWrite(address uint16, value byte)
+}
+
+// controllerPortWatcher is implemented by boards that use the OUT lines of
+// the controller port, bits 0-2 of the writes to $4016.
+type controllerPortWatcher interface {
+	controllerPortWrite(value byte)
+}
+
+// audioMapper is implemented by boards with their own sound channels, which
+// are mixed and recorded like the APU ones. audioChannels names them, and
+// sample writes their current output to out, one value per name, on the same
+// scale as the APU mix. The APU calls sample once per CPU cycle, before the
+// board is clocked for that cycle, so it sees the output left by the previous
+// one.
+type audioMapper interface {
+	audioChannels() []string
+	sample(out []float32)
+}
+
+type mapperFunc func(*cartridge) Mapper
+
+// mappers maps iNES mapper numbers to their implementation.
+var mappers = map[uint16]mapperFunc{
+	0:  newNROM,
+	1:  newMMC1,
+	2:  newUxROM,
+	3:  newCNROM,
+	4:  newMMC3,
+	5:  newMMC5,
+	7:  newAxROM,
+	9:  newMMC2,
+	10: newMMC4,
+	11: newColorDreams,
+	19: newN163,
+	21: newVRC24,
+	22: newVRC24,
+	23: newVRC24,
+	24: newVRC6,
+	25: newVRC24,
+	26: newVRC6,
+	34: newBNROM,
+	66: newGxROM,
+	69: newFME7,
+	71: newCamerica,
+	99: newVSUnisystem,
+}
+
+func newMapper(c *cartridge) (Mapper, error) {
+	fn, ok := mappers[c.mapperNum]
+	if !ok {
+		return nil, fmt.Errorf("nes: unsupported mapper %d", c.mapperNum)
+	}
+
+	return fn(c), nil
+}
+
+// bankOffset returns the offset into data of the given bank, wrapping around
+// when the board selects a bank past the end of the chip.
+func bankOffset(data []byte, bank, size int) int {
+	banks := len(data) / size
+	if banks == 0 {
+		return 0
+	}
+
+	bank %= banks
+	if bank < 0 {
+		bank += banks
+	}
+
+	return bank * size
+}
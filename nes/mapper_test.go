@@ -0,0 +1,106 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLoadRom_Mapper(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		rom := []byte{'N', 'E', 'S', 0x1a, 1, 1, byte(i&0x0F) << 4, byte(i & 0xF0), 0, 0, 0, 0, 0, 0, 0, 0}
+		rom = append(rom, make([]byte, prgMul+chrMul)...)
+
+		_, supported := mappers[uint16(i)]
+
+		c, err := loadRom(bytes.NewBuffer(rom))
+		if supported && err != nil {
+			t.Errorf("loadRom() mapper %d: unexpected error %v", i, err)
+			continue
+		}
+		if !supported && err == nil {
+			t.Errorf("loadRom() mapper %d: expected an error, got nil", i)
+			continue
+		}
+		if supported && c.mapper == nil {
+			t.Errorf("loadRom() mapper %d: mapper was not set", i)
+		}
+	}
+}
+
+func TestLoadRom_CHRRAM(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []byte
+		chrRAM   bool
+		chrSize  int
+		bankSize uint16
+	}{
+		{"CHR-ROM", []byte{'N', 'E', 'S', 0x1a, 2, 1, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}, false, chrMul, 0x2000},
+		{"iNES CHR-RAM", []byte{'N', 'E', 'S', 0x1a, 2, 0, 0x20, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}, true, chrMul, 0x2000},
+		{"NES 2.0 32K CHR-RAM", []byte{'N', 'E', 'S', 0x1a, 2, 0, 0x40, 0x08, 0, 0, 0, 0x09, 0, 0, 0, 0}, true, 32 * 1024, 0x0400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rom := append(tt.header, make([]byte, 2*prgMul)...)
+			if !tt.chrRAM {
+				rom = append(rom, make([]byte, chrMul)...)
+			}
+
+			c, err := loadRom(bytes.NewBuffer(rom))
+			if err != nil {
+				t.Fatalf("loadRom() unexpected error %v", err)
+			}
+			if len(c.chr) != tt.chrSize {
+				t.Errorf("len(chr) = %d, want %d", len(c.chr), tt.chrSize)
+			}
+
+			c.write(0x0010, 0x42)
+			want := byte(0)
+			if tt.chrRAM {
+				want = 0x42
+			}
+			if got := c.read(0x0010); got != want {
+				t.Errorf("chr $0010 = %02X, want %02X", got, want)
+			}
+
+			if tt.bankSize == 0x0400 {
+				// the last 1K bank of the RAM is reachable through R5
+				c.write(0x8000, 5)
+				c.write(0x8001, 31)
+				c.write(0x1C00, 0x24)
+				if got := c.chr[len(c.chr)-0x0400]; got != 0x24 {
+					t.Errorf("last chr bank = %02X, want %02X", got, 0x24)
+				}
+			}
+		})
+	}
+}
+
+// newTestBoard returns a cartridge with 256K of PRG and CHR for the given
+// mapper, with the first byte of every 8K PRG and 1K CHR bank set to its
+// number. It gets as much PRG-RAM as an iNES 1.0 rom would.
+func newTestBoard(mapper uint16, submapper byte) *cartridge {
+	info := CartridgeInfo{Mapper: mapper, Submapper: submapper}
+	c := &cartridge{
+		info:      info,
+		mapperNum: mapper,
+		prg:       make([]byte, 16*prgMul),
+		chr:       make([]byte, 32*chrMul),
+		prgRAM:    make([]byte, prgRAMSize(info)),
+	}
+
+	for i := 0; i < len(c.prg); i += 0x2000 {
+		c.prg[i] = byte(i / 0x2000)
+	}
+	for i := 0; i < len(c.chr); i += 0x0400 {
+		c.chr[i] = byte(i / 0x0400)
+	}
+
+	m, err := newMapper(c)
+	if err != nil {
+		panic(err)
+	}
+	c.mapper = m
+	return c
+}
@@ -0,0 +1,202 @@
+package nes
+
+// MMC1 (mapper 1) is configured through a 5 bit serial shift register.
+//
+// Writing a value with bit 7 set to $8000-$FFFF clears the shift register and
+// locks the PRG mode to 3. Otherwise bit 0 of the value is shifted in, and on
+// the fifth write the accumulated value is copied into the internal register
+// selected by bits 13 and 14 of the address of that last write:
+//
+//	$8000-$9FFF control
+//	$A000-$BFFF CHR bank 0
+//	$C000-$DFFF CHR bank 1
+//	$E000-$FFFF PRG bank
+//
+// Control (internal, $8000-$9FFF)
+//
+//	4bit0
+//	-----
+//	CPPMM
+//	|||||
+//	|||++- Mirroring (0: one-screen, lower bank; 1: one-screen, upper bank;
+//	|||               2: vertical; 3: horizontal)
+//	|++--- PRG ROM bank mode (0, 1: switch 32 KB at $8000, ignoring low bit of
+//	|                         bank number;
+//	|                         2: fix first bank at $8000 and switch 16 KB bank
+//	|                         at $C000;
+//	|                         3: fix last bank at $C000 and switch 16 KB bank
+//	|                         at $8000)
+//	+----- CHR ROM bank mode (0: switch 8 KB at a time; 1: switch two
+//	                          separate 4 KB banks)
+//
+// PRG bank (internal, $E000-$FFFF)
+//
+//	4bit0
+//	-----
+//	RPPPP
+//	|||||
+//	|++++- Select 16 KB PRG ROM bank (low bit ignored in 32 KB mode)
+//	+----- PRG RAM chip enable (0: enabled; 1: disabled)
+//
+// SOROM and SXROM have 16K and 32K of PRG RAM, banked in 8K at $6000 by bit 3
+// and bits 2-3 of CHR bank 0.
+//
+// When the CPU writes to the serial port on consecutive cycles, the MMC1
+// ignores all writes but the first. This happens when the 6502 executes
+// read-modify-write instructions, such as DEC and ROR, by writing back the
+// old value and then writing the new value on the next cycle.
+type mmc1 struct {
+	cart *cartridge
+
+	shift    byte
+	control  byte
+	chrBank0 byte
+	chrBank1 byte
+	prgBank  byte
+
+	prgOffsets   [2]int
+	chrOffsets   [2]int
+	prgRAMOffset int
+
+	cycles    uint64
+	lastWrite uint64 // cycle after the last serial write
+}
+
+func newMMC1(c *cartridge) Mapper {
+	m := &mmc1{
+		cart:    c,
+		shift:   0x10,
+		control: 0x0C,
+	}
+	m.updateOffsets()
+	return m
+}
+
+func (m *mmc1) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0xC000:
+		return m.cart.prg[m.prgOffsets[1]+int(address-0xC000)]
+	case address >= 0x8000:
+		return m.cart.prg[m.prgOffsets[0]+int(address-0x8000)]
+	case address >= 0x6000:
+		if m.prgBank&0x10 == 0 {
+			return m.cart.prgRAM[(m.prgRAMOffset+int(address-0x6000))%len(m.cart.prgRAM)]
+		}
+	}
+
+	return 0
+}
+
+func (m *mmc1) cpuWrite(address uint16, value byte) {
+	switch {
+	case address >= 0x8000:
+		m.writeShift(address, value)
+	case address >= 0x6000:
+		if m.prgBank&0x10 == 0 {
+			m.cart.prgRAM[(m.prgRAMOffset+int(address-0x6000))%len(m.cart.prgRAM)] = value
+		}
+	}
+}
+
+func (m *mmc1) writeShift(address uint16, value byte) {
+	consecutive := m.cycles == m.lastWrite
+	m.lastWrite = m.cycles + 1
+	if consecutive {
+		return
+	}
+
+	if value&0x80 > 0 {
+		m.shift = 0x10
+		m.control |= 0x0C
+		m.updateOffsets()
+		return
+	}
+
+	// the register is full once the initial 1 reaches bit 0
+	full := m.shift&1 == 1
+	m.shift = m.shift>>1 | (value&1)<<4
+	if !full {
+		return
+	}
+
+	switch address & 0xE000 {
+	case 0x8000:
+		m.control = m.shift
+	case 0xA000:
+		m.chrBank0 = m.shift
+	case 0xC000:
+		m.chrBank1 = m.shift
+	case 0xE000:
+		m.prgBank = m.shift
+	}
+
+	m.shift = 0x10
+	m.updateOffsets()
+}
+
+func (m *mmc1) updateOffsets() {
+	// SUROM and friends use bit 4 of the CHR registers to select which 256K
+	// half of the PRG ROM is in use.
+	var outer int
+	if len(m.cart.prg) > 256*1024 {
+		outer = int(m.chrBank0&0x10) << 14
+	}
+
+	prgBank := int(m.prgBank & 0x0F)
+	switch m.control >> 2 & 0x03 {
+	case 0, 1:
+		m.prgOffsets[0] = outer + bankOffset(m.cart.prg, prgBank&^1, 0x4000)
+		m.prgOffsets[1] = outer + bankOffset(m.cart.prg, prgBank|1, 0x4000)
+	case 2:
+		m.prgOffsets[0] = outer + bankOffset(m.cart.prg, 0, 0x4000)
+		m.prgOffsets[1] = outer + bankOffset(m.cart.prg, prgBank, 0x4000)
+	case 3:
+		m.prgOffsets[0] = outer + bankOffset(m.cart.prg, prgBank, 0x4000)
+		m.prgOffsets[1] = outer + bankOffset(m.cart.prg, 0x0F, 0x4000)
+	}
+
+	switch len(m.cart.prgRAM) {
+	case 16 * 1024:
+		m.prgRAMOffset = int(m.chrBank0>>3&1) * 0x2000
+	case 32 * 1024:
+		m.prgRAMOffset = int(m.chrBank0>>2&3) * 0x2000
+	}
+
+	if m.control&0x10 == 0 {
+		m.chrOffsets[0] = bankOffset(m.cart.chr, int(m.chrBank0&^1), 0x1000)
+		m.chrOffsets[1] = bankOffset(m.cart.chr, int(m.chrBank0|1), 0x1000)
+	} else {
+		m.chrOffsets[0] = bankOffset(m.cart.chr, int(m.chrBank0), 0x1000)
+		m.chrOffsets[1] = bankOffset(m.cart.chr, int(m.chrBank1), 0x1000)
+	}
+}
+
+func (m *mmc1) ppuRead(address uint16) byte {
+	return m.cart.chr[m.chrOffsets[address/0x1000]+int(address%0x1000)]
+}
+
+func (m *mmc1) ppuWrite(address uint16, value byte) {
+	if m.cart.chrRAM {
+		m.cart.chr[m.chrOffsets[address/0x1000]+int(address%0x1000)] = value
+	}
+}
+
+func (m *mmc1) mirrorMode() mirrorMode {
+	switch m.control & 0x03 {
+	case 0:
+		return singleScreenLow
+	case 1:
+		return singleScreenHigh
+	case 2:
+		return vertical
+	default:
+		return horizontal
+	}
+}
+
+func (m *mmc1) irq() bool                 { return false }
+func (m *mmc1) ppuAddress(address uint16) {}
+
+func (m *mmc1) clock() {
+	m.cycles++
+}
@@ -0,0 +1,160 @@
+package nes
+
+import "testing"
+
+func newTestMMC1() (*mmc1, *cartridge) {
+	c := newTestBoard(1, 0)
+	return c.mapper.(*mmc1), c
+}
+
+// writeMMC1 performs the five serial writes needed to load a register,
+// leaving a cycle between them so they aren't ignored.
+func writeMMC1(m *mmc1, address uint16, value byte) {
+	for i := 0; i < 5; i++ {
+		m.clock()
+		m.clock()
+		m.cpuWrite(address, value>>uint(i)&1)
+	}
+}
+
+func TestMMC1_PRGModes(t *testing.T) {
+	m, _ := newTestMMC1()
+
+	// the board tags 8K banks, so 16K bank n reads as 2n
+
+	// power on: mode 3, last bank fixed at $C000
+	if got := m.cpuRead(0xC000); got != 30 {
+		t.Errorf("mode 3: $C000 = %d, want %d", got, 30)
+	}
+
+	writeMMC1(m, 0xE000, 2)
+	if got := m.cpuRead(0x8000); got != 4 {
+		t.Errorf("mode 3: $8000 = %d, want %d", got, 4)
+	}
+
+	// mode 2: first bank fixed at $8000
+	writeMMC1(m, 0x8000, 0x08)
+	if got := m.cpuRead(0x8000); got != 0 {
+		t.Errorf("mode 2: $8000 = %d, want %d", got, 0)
+	}
+	if got := m.cpuRead(0xC000); got != 4 {
+		t.Errorf("mode 2: $C000 = %d, want %d", got, 4)
+	}
+
+	// mode 0: 32K, low bit ignored
+	writeMMC1(m, 0x8000, 0x00)
+	writeMMC1(m, 0xE000, 5)
+	if got := m.cpuRead(0x8000); got != 8 {
+		t.Errorf("mode 0: $8000 = %d, want %d", got, 8)
+	}
+	if got := m.cpuRead(0xC000); got != 10 {
+		t.Errorf("mode 0: $C000 = %d, want %d", got, 10)
+	}
+}
+
+func TestMMC1_CHRModes(t *testing.T) {
+	m, _ := newTestMMC1()
+
+	// the board tags 1K banks, so 4K bank n reads as 4n
+
+	// 8K mode, low bit ignored
+	writeMMC1(m, 0xA000, 3)
+	if got := m.ppuRead(0x0000); got != 8 {
+		t.Errorf("8K: $0000 = %d, want %d", got, 8)
+	}
+	if got := m.ppuRead(0x1000); got != 12 {
+		t.Errorf("8K: $1000 = %d, want %d", got, 12)
+	}
+
+	// 4K mode
+	writeMMC1(m, 0x8000, 0x10)
+	writeMMC1(m, 0xA000, 5)
+	writeMMC1(m, 0xC000, 1)
+	if got := m.ppuRead(0x0000); got != 20 {
+		t.Errorf("4K: $0000 = %d, want %d", got, 20)
+	}
+	if got := m.ppuRead(0x1000); got != 4 {
+		t.Errorf("4K: $1000 = %d, want %d", got, 4)
+	}
+}
+
+func TestMMC1_Mirroring(t *testing.T) {
+	m, _ := newTestMMC1()
+
+	for v, want := range []mirrorMode{singleScreenLow, singleScreenHigh, vertical, horizontal} {
+		writeMMC1(m, 0x8000, byte(v))
+		if got := m.mirrorMode(); got != want {
+			t.Errorf("control %d: mirroring = %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestMMC1_ConsecutiveWrites(t *testing.T) {
+	m, _ := newTestMMC1()
+
+	// the second write of a pair on consecutive cycles must be dropped,
+	// so only the ones get shifted in.
+	for i := 0; i < 5; i++ {
+		m.clock()
+		m.clock()
+		m.cpuWrite(0xE000, 1)
+		m.clock()
+		m.cpuWrite(0xE000, 0)
+	}
+	if got := m.prgBank; got != 0x1F {
+		t.Errorf("prgBank = %05b, want %05b", got, 0x1F)
+	}
+
+	// a reset still works and locks the PRG mode to 3
+	writeMMC1(m, 0x8000, 0x00)
+	m.clock()
+	m.clock()
+	m.cpuWrite(0x8000, 0x80)
+	if got := m.control >> 2 & 3; got != 3 {
+		t.Errorf("prg mode after reset = %d, want %d", got, 3)
+	}
+}
+
+func TestMMC1_PRGRAM(t *testing.T) {
+	m, c := newTestMMC1()
+
+	m.cpuWrite(0x6000, 0x42)
+	if got := m.cpuRead(0x6000); got != 0x42 {
+		t.Errorf("enabled: $6000 = %02X, want %02X", got, 0x42)
+	}
+
+	writeMMC1(m, 0xE000, 0x10)
+	m.cpuWrite(0x6000, 0x24)
+	if got := c.prgRAM[0]; got != 0x42 {
+		t.Errorf("disabled: write went through, prgRAM[0] = %02X", got)
+	}
+	if got := m.cpuRead(0x6000); got != 0 {
+		t.Errorf("disabled: $6000 = %02X, want %02X", got, 0)
+	}
+}
+
+func TestMMC1_PRGRAMBanks(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		chr0   byte
+		offset int
+	}{
+		{"SOROM", 16 * 1024, 0x08, 0x2000},
+		{"SXROM", 32 * 1024, 0x0C, 0x6000},
+		{"SNROM", 8 * 1024, 0x0C, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, c := newTestMMC1()
+			c.prgRAM = make([]byte, tt.size)
+
+			writeMMC1(m, 0xA000, tt.chr0)
+			m.cpuWrite(0x6001, 0x42)
+			if got := c.prgRAM[tt.offset+1]; got != 0x42 {
+				t.Errorf("prgRAM[%04X] = %02X, want %02X", tt.offset+1, got, 0x42)
+			}
+		})
+	}
+}
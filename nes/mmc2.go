@@ -0,0 +1,160 @@
+package nes
+
+// MMC2 (mapper 9, Punch-Out!!) and MMC4 (mapper 10, Fire Emblem) switch CHR
+// banks on their own when the PPU fetches specific tiles.
+//
+//	$A000-$AFFF PRG bank (8K at $8000 on the MMC2, 16K on the MMC4)
+//	$B000-$BFFF CHR bank for PPU $0000-$0FFF when latch 0 is $FD
+//	$C000-$CFFF CHR bank for PPU $0000-$0FFF when latch 0 is $FE
+//	$D000-$DFFF CHR bank for PPU $1000-$1FFF when latch 1 is $FD
+//	$E000-$EFFF CHR bank for PPU $1000-$1FFF when latch 1 is $FE
+//	$F000-$FFFF Mirroring (0: vertical; 1: horizontal)
+//
+// The rest of the PRG space is fixed to the last banks. Each 4K pattern table
+// has a latch that is set by fetches of tiles $FD and $FE:
+//
+//	$0FD8        latch 0 = $FD ($0FD8-$0FDF on the MMC4)
+//	$0FE8        latch 0 = $FE ($0FE8-$0FEF on the MMC4)
+//	$1FD8-$1FDF  latch 1 = $FD
+//	$1FE8-$1FEF  latch 1 = $FE
+//
+// Those are the high plane of the tiles, so the tile that triggers the switch
+// is still drawn from the old bank and the new one takes effect on the next
+// fetch.
+type mmc2 struct {
+	cart *cartridge
+	mmc4 bool
+
+	prgBank   byte
+	chrBanks  [4]byte // $FD/0000, $FE/0000, $FD/1000, $FE/1000
+	mirroring byte
+
+	latches      [2]byte
+	pendingLatch int // latch to update on the next fetch, -1 if none
+	pendingValue byte
+
+	prgOffsets [4]int
+	chrOffsets [2]int
+}
+
+func newMMC2(c *cartridge) Mapper {
+	return newMMC2Board(c, false)
+}
+
+func newMMC4(c *cartridge) Mapper {
+	return newMMC2Board(c, true)
+}
+
+func newMMC2Board(c *cartridge, mmc4 bool) *mmc2 {
+	m := &mmc2{
+		cart:         c,
+		mmc4:         mmc4,
+		latches:      [2]byte{0xFE, 0xFE},
+		pendingLatch: -1,
+	}
+	m.updateOffsets()
+	return m
+}
+
+func (m *mmc2) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0x8000:
+		slot := (address - 0x8000) / 0x2000
+		return m.cart.prg[m.prgOffsets[slot]+int(address%0x2000)]
+	case address >= 0x6000 && m.mmc4:
+		return m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)]
+	}
+
+	return 0
+}
+
+func (m *mmc2) cpuWrite(address uint16, value byte) {
+	switch {
+	case address >= 0xA000:
+		m.writeRegister(address, value)
+	case address >= 0x6000 && address < 0x8000 && m.mmc4:
+		m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)] = value
+	}
+}
+
+func (m *mmc2) writeRegister(address uint16, value byte) {
+	switch address & 0xF000 {
+	case 0xA000:
+		m.prgBank = value & 0x0F
+	case 0xB000, 0xC000, 0xD000, 0xE000:
+		m.chrBanks[(address-0xB000)/0x1000] = value & 0x1F
+	case 0xF000:
+		m.mirroring = value & 0x01
+	}
+
+	m.updateOffsets()
+}
+
+func (m *mmc2) updateOffsets() {
+	if m.mmc4 {
+		m.prgOffsets[0] = bankOffset(m.cart.prg, int(m.prgBank)*2, 0x2000)
+		m.prgOffsets[1] = m.prgOffsets[0] + 0x2000
+	} else {
+		m.prgOffsets[0] = bankOffset(m.cart.prg, int(m.prgBank), 0x2000)
+		m.prgOffsets[1] = bankOffset(m.cart.prg, -3, 0x2000)
+	}
+	m.prgOffsets[2] = bankOffset(m.cart.prg, -2, 0x2000)
+	m.prgOffsets[3] = bankOffset(m.cart.prg, -1, 0x2000)
+
+	for i, latch := range m.latches {
+		bank := m.chrBanks[i*2]
+		if latch == 0xFE {
+			bank = m.chrBanks[i*2+1]
+		}
+		m.chrOffsets[i] = bankOffset(m.cart.chr, int(bank), 0x1000)
+	}
+}
+
+func (m *mmc2) ppuRead(address uint16) byte {
+	return m.cart.chr[m.chrOffsets[address/0x1000]+int(address%0x1000)]
+}
+
+func (m *mmc2) ppuWrite(address uint16, value byte) {
+	if m.cart.chrRAM {
+		m.cart.chr[m.chrOffsets[address/0x1000]+int(address%0x1000)] = value
+	}
+}
+
+func (m *mmc2) mirrorMode() mirrorMode {
+	if m.mirroring == 0 {
+		return vertical
+	}
+	return horizontal
+}
+
+func (m *mmc2) irq() bool { return false }
+
+func (m *mmc2) ppuAddress(address uint16) {
+	// the previous fetch has completed by now, so its latch change can be
+	// applied
+	if m.pendingLatch >= 0 {
+		m.latches[m.pendingLatch] = m.pendingValue
+		m.pendingLatch = -1
+		m.updateOffsets()
+	}
+
+	if address >= 0x2000 {
+		return
+	}
+
+	latch := int(address / 0x1000)
+	tile := address & 0x0FF8
+	if latch == 0 && !m.mmc4 && address&0x07 != 0 {
+		// the MMC2 only looks at the first row of the tiles in the low table
+		return
+	}
+
+	switch tile {
+	case 0x0FD8:
+		m.pendingLatch, m.pendingValue = latch, 0xFD
+	case 0x0FE8:
+		m.pendingLatch, m.pendingValue = latch, 0xFE
+	}
+}
+
+func (m *mmc2) clock() {}
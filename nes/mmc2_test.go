@@ -0,0 +1,92 @@
+package nes
+
+import "testing"
+
+func newTestMMC2(mmc4 bool) *mmc2 {
+	if mmc4 {
+		return newTestBoard(10, 0).mapper.(*mmc2)
+	}
+	return newTestBoard(9, 0).mapper.(*mmc2)
+}
+
+func TestMMC2_PRGBanking(t *testing.T) {
+	tests := []struct {
+		name string
+		mmc4 bool
+		want [4]byte
+	}{
+		{"mmc2", false, [4]byte{5, 29, 30, 31}},
+		{"mmc4", true, [4]byte{10, 11, 30, 31}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMMC2(tt.mmc4)
+			m.cpuWrite(0xA000, 5)
+
+			for slot, want := range tt.want {
+				addr := 0x8000 + uint16(slot)*0x2000
+				if got := m.cpuRead(addr); got != want {
+					t.Errorf("$%04X = %d, want %d", addr, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMMC2_Latches(t *testing.T) {
+	tests := []struct {
+		name    string
+		mmc4    bool
+		address uint16
+		table   uint16
+		fd, fe  byte // the tags of the 4K banks, 4 times their number
+	}{
+		{"mmc2 low table", false, 0x0FD8, 0x0000, 4, 8},
+		{"mmc2 high table", false, 0x1FDB, 0x1000, 12, 16},
+		{"mmc4 low table", true, 0x0FDB, 0x0000, 4, 8},
+		{"mmc4 high table", true, 0x1FDF, 0x1000, 12, 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMMC2(tt.mmc4)
+			m.cpuWrite(0xB000, 1)
+			m.cpuWrite(0xC000, 2)
+			m.cpuWrite(0xD000, 3)
+			m.cpuWrite(0xE000, 4)
+
+			if got := m.ppuRead(tt.table); got != tt.fe {
+				t.Fatalf("power on: bank %d, want %d", got, tt.fe)
+			}
+
+			// the fetch that hits the latch still uses the old bank
+			m.ppuAddress(tt.address)
+			if got := m.ppuRead(tt.table); got != tt.fe {
+				t.Errorf("during $FD fetch: bank %d, want %d", got, tt.fe)
+			}
+			m.ppuAddress(0x2000)
+			if got := m.ppuRead(tt.table); got != tt.fd {
+				t.Errorf("after $FD fetch: bank %d, want %d", got, tt.fd)
+			}
+
+			m.ppuAddress(tt.address + 0x10)
+			m.ppuAddress(0x2000)
+			if got := m.ppuRead(tt.table); got != tt.fe {
+				t.Errorf("after $FE fetch: bank %d, want %d", got, tt.fe)
+			}
+		})
+	}
+}
+
+func TestMMC2_LowTableFirstRowOnly(t *testing.T) {
+	m := newTestMMC2(false)
+	m.cpuWrite(0xB000, 1)
+	m.cpuWrite(0xC000, 2)
+
+	m.ppuAddress(0x0FD9)
+	m.ppuAddress(0x2000)
+	if got := m.ppuRead(0x0000); got != 8 {
+		t.Errorf("$0FD9 switched the mmc2 latch, tag %d, want 8", got)
+	}
+}
@@ -0,0 +1,233 @@
+package nes
+
+// MMC3 (mapper 4) has 8K PRG banks, 1K/2K CHR banks, switchable mirroring and
+// a scanline counter that raises IRQs.
+//
+// Registers are selected by bits 13, 14 and 0 of the address:
+//
+//	$8000-$9FFE, even  Bank select
+//	$8001-$9FFF, odd   Bank data
+//	$A000-$BFFE, even  Mirroring
+//	$A001-$BFFF, odd   PRG RAM protect
+//	$C000-$DFFE, even  IRQ latch
+//	$C001-$DFFF, odd   IRQ reload
+//	$E000-$FFFE, even  IRQ disable
+//	$E001-$FFFF, odd   IRQ enable
+//
+// Bank select ($8000-$9FFE, even)
+//
+//	7  bit  0
+//	---- ----
+//	CPMx xRRR
+//	|||   |||
+//	|||   +++- Specify which bank register to update on next write to Bank Data register
+//	|||          000: R0: Select 2 KB CHR bank at PPU $0000-$07FF (or $1000-$17FF)
+//	|||          001: R1: Select 2 KB CHR bank at PPU $0800-$0FFF (or $1800-$1FFF)
+//	|||          010: R2: Select 1 KB CHR bank at PPU $1000-$13FF (or $0000-$03FF)
+//	|||          011: R3: Select 1 KB CHR bank at PPU $1400-$17FF (or $0400-$07FF)
+//	|||          100: R4: Select 1 KB CHR bank at PPU $1800-$1BFF (or $0800-$0BFF)
+//	|||          101: R5: Select 1 KB CHR bank at PPU $1C00-$1FFF (or $0C00-$0FFF)
+//	|||          110: R6: Select 8 KB PRG ROM bank at $8000-$9FFF (or $C000-$DFFF)
+//	|||          111: R7: Select 8 KB PRG ROM bank at $A000-$BFFF
+//	||+------- Nothing on the MMC3, see MMC6
+//	|+-------- PRG ROM bank mode (0: $8000-$9FFF swappable,
+//	|                                $C000-$DFFF fixed to second-last bank;
+//	|                             1: $C000-$DFFF swappable,
+//	|                                $8000-$9FFF fixed to second-last bank)
+//	+--------- CHR A12 inversion (0: two 2 KB banks at $0000-$0FFF,
+//	                                 four 1 KB banks at $1000-$1FFF;
+//	                              1: two 2 KB banks at $1000-$1FFF,
+//	                                 four 1 KB banks at $0000-$0FFF)
+//
+// PRG RAM protect ($A001-$BFFF, odd)
+//
+//	7  bit  0
+//	---- ----
+//	RWXX xxxx
+//	||||
+//	||++------ Nothing on the MMC3, see MMC6
+//	|+-------- Write protection (0: allow writes; 1: deny writes)
+//	+--------- PRG RAM chip enable (0: disable; 1: enable)
+//
+// The scanline counter is clocked on every rising edge of PPU A12, but only
+// after A12 has stayed low for a few CPU cycles. When rendering with the
+// background at $0000 and sprites at $1000 that happens exactly once per
+// scanline, during the sprite fetches.
+type mmc3 struct {
+	cart *cartridge
+
+	bankSelect byte
+	registers  [8]byte
+	mirroring  byte
+	prgRAMCtrl byte
+
+	prgOffsets [4]int
+	chrOffsets [8]int
+
+	irqLatch   byte
+	irqCounter byte
+	irqReload  bool
+	irqEnabled bool
+	irqPending bool
+
+	a12       bool
+	a12Cycles int // cpu cycles since A12 went low
+}
+
+func newMMC3(c *cartridge) Mapper {
+	m := &mmc3{
+		cart:       c,
+		prgRAMCtrl: 0x80,
+	}
+	m.updateOffsets()
+	return m
+}
+
+func (m *mmc3) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0x8000:
+		slot := (address - 0x8000) / 0x2000
+		return m.cart.prg[m.prgOffsets[slot]+int(address%0x2000)]
+	case address >= 0x6000:
+		if m.prgRAMCtrl&0x80 > 0 {
+			return m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)]
+		}
+	}
+
+	return 0
+}
+
+func (m *mmc3) cpuWrite(address uint16, value byte) {
+	switch {
+	case address >= 0x8000:
+		m.writeRegister(address, value)
+	case address >= 0x6000:
+		if m.prgRAMCtrl&0xC0 == 0x80 {
+			m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)] = value
+		}
+	}
+}
+
+func (m *mmc3) writeRegister(address uint16, value byte) {
+	even := address&1 == 0
+
+	switch address & 0xE000 {
+	case 0x8000:
+		if even {
+			m.bankSelect = value
+		} else {
+			m.registers[m.bankSelect&0x07] = value
+		}
+		m.updateOffsets()
+	case 0xA000:
+		if even {
+			m.mirroring = value & 0x01
+		} else {
+			m.prgRAMCtrl = value
+		}
+	case 0xC000:
+		if even {
+			m.irqLatch = value
+		} else {
+			m.irqCounter = 0
+			m.irqReload = true
+		}
+	case 0xE000:
+		if even {
+			m.irqEnabled = false
+			m.irqPending = false
+		} else {
+			m.irqEnabled = true
+		}
+	}
+}
+
+func (m *mmc3) updateOffsets() {
+	secondLast := bankOffset(m.cart.prg, -2, 0x2000)
+	r6 := bankOffset(m.cart.prg, int(m.registers[6]), 0x2000)
+
+	if m.bankSelect&0x40 == 0 {
+		m.prgOffsets[0] = r6
+		m.prgOffsets[2] = secondLast
+	} else {
+		m.prgOffsets[0] = secondLast
+		m.prgOffsets[2] = r6
+	}
+	m.prgOffsets[1] = bankOffset(m.cart.prg, int(m.registers[7]), 0x2000)
+	m.prgOffsets[3] = bankOffset(m.cart.prg, -1, 0x2000)
+
+	// with A12 inversion the 2K and 1K halves trade places
+	var invert int
+	if m.bankSelect&0x80 > 0 {
+		invert = 4
+	}
+
+	m.chrOffsets[0^invert] = bankOffset(m.cart.chr, int(m.registers[0]&^1), 0x0400)
+	m.chrOffsets[1^invert] = bankOffset(m.cart.chr, int(m.registers[0]|1), 0x0400)
+	m.chrOffsets[2^invert] = bankOffset(m.cart.chr, int(m.registers[1]&^1), 0x0400)
+	m.chrOffsets[3^invert] = bankOffset(m.cart.chr, int(m.registers[1]|1), 0x0400)
+	m.chrOffsets[4^invert] = bankOffset(m.cart.chr, int(m.registers[2]), 0x0400)
+	m.chrOffsets[5^invert] = bankOffset(m.cart.chr, int(m.registers[3]), 0x0400)
+	m.chrOffsets[6^invert] = bankOffset(m.cart.chr, int(m.registers[4]), 0x0400)
+	m.chrOffsets[7^invert] = bankOffset(m.cart.chr, int(m.registers[5]), 0x0400)
+}
+
+func (m *mmc3) ppuRead(address uint16) byte {
+	return m.cart.chr[m.chrOffsets[address/0x0400]+int(address%0x0400)]
+}
+
+func (m *mmc3) ppuWrite(address uint16, value byte) {
+	if m.cart.chrRAM {
+		m.cart.chr[m.chrOffsets[address/0x0400]+int(address%0x0400)] = value
+	}
+}
+
+func (m *mmc3) mirrorMode() mirrorMode {
+	if m.cart.fourScreen {
+		return quad
+	}
+
+	if m.mirroring == 0 {
+		return vertical
+	}
+	return horizontal
+}
+
+func (m *mmc3) irq() bool {
+	return m.irqPending
+}
+
+func (m *mmc3) ppuAddress(address uint16) {
+	a12 := address&0x1000 > 0
+
+	switch {
+	case a12 && !m.a12:
+		// short pulses, like the ones between sprite fetches, are filtered out
+		if m.a12Cycles > 3 {
+			m.clockCounter()
+		}
+	case !a12 && m.a12:
+		m.a12Cycles = 0
+	}
+
+	m.a12 = a12
+}
+
+func (m *mmc3) clockCounter() {
+	if m.irqCounter == 0 || m.irqReload {
+		m.irqCounter = m.irqLatch
+		m.irqReload = false
+	} else {
+		m.irqCounter--
+	}
+
+	if m.irqCounter == 0 && m.irqEnabled {
+		m.irqPending = true
+	}
+}
+
+func (m *mmc3) clock() {
+	if !m.a12 {
+		m.a12Cycles++
+	}
+}
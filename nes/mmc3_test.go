@@ -0,0 +1,208 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestMMC3() *mmc3 {
+	return newTestBoard(4, 0).mapper.(*mmc3)
+}
+
+// scanlineMMC3 simulates the A12 activity of a rendered scanline, with the
+// background at $0000 and sprites at $1000.
+func scanlineMMC3(m *mmc3) {
+	for i := 0; i < 85; i++ {
+		m.ppuAddress(0x0000)
+		m.clock()
+	}
+	for i := 0; i < 8; i++ {
+		m.ppuAddress(0x1000)
+		m.ppuAddress(0x2000)
+	}
+	m.clock()
+}
+
+func TestMMC3_Banking(t *testing.T) {
+	m := newTestMMC3()
+
+	for r, v := range []byte{2, 4, 0, 1, 6, 7, 3, 5} {
+		m.cpuWrite(0x8000, byte(r))
+		m.cpuWrite(0x8001, v)
+	}
+
+	prg := []struct {
+		mode byte
+		want [4]byte
+	}{
+		{0x00, [4]byte{3, 5, 30, 31}},
+		{0x40, [4]byte{30, 5, 3, 31}},
+	}
+	for _, tt := range prg {
+		m.cpuWrite(0x8000, tt.mode)
+		for slot, want := range tt.want {
+			addr := 0x8000 + uint16(slot)*0x2000
+			if got := m.cpuRead(addr); got != want {
+				t.Errorf("prg mode %02X: $%04X = %d, want %d", tt.mode, addr, got, want)
+			}
+		}
+	}
+
+	chr := []struct {
+		mode byte
+		want [8]byte
+	}{
+		{0x00, [8]byte{2, 3, 4, 5, 0, 1, 6, 7}},
+		{0x80, [8]byte{0, 1, 6, 7, 2, 3, 4, 5}},
+	}
+	for _, tt := range chr {
+		m.cpuWrite(0x8000, tt.mode)
+		for slot, want := range tt.want {
+			addr := uint16(slot) * 0x0400
+			if got := m.ppuRead(addr); got != want {
+				t.Errorf("chr mode %02X: $%04X = %d, want %d", tt.mode, addr, got, want)
+			}
+		}
+	}
+}
+
+func TestMMC3_PRGRAMProtect(t *testing.T) {
+	m := newTestMMC3()
+
+	m.cpuWrite(0x6000, 0x42)
+	m.cpuWrite(0xA001, 0xC0)
+	m.cpuWrite(0x6000, 0x24)
+	if got := m.cpuRead(0x6000); got != 0x42 {
+		t.Errorf("write protected: $6000 = %02X, want %02X", got, 0x42)
+	}
+
+	m.cpuWrite(0xA001, 0x00)
+	if got := m.cpuRead(0x6000); got != 0 {
+		t.Errorf("disabled: $6000 = %02X, want %02X", got, 0)
+	}
+}
+
+func TestMMC3_IRQ(t *testing.T) {
+	m := newTestMMC3()
+
+	m.cpuWrite(0xC000, 3)
+	m.cpuWrite(0xC001, 0)
+	m.cpuWrite(0xE001, 0)
+
+	// the first clock reloads the counter, then it takes 3 more
+	for line := 0; line < 4; line++ {
+		if m.irq() {
+			t.Fatalf("irq fired early, on line %d", line)
+		}
+		scanlineMMC3(m)
+	}
+	if !m.irq() {
+		t.Fatalf("irq did not fire")
+	}
+
+	m.cpuWrite(0xE000, 0)
+	if m.irq() {
+		t.Errorf("irq was not acknowledged")
+	}
+}
+
+func TestMMC3_Blargg(t *testing.T) {
+	roms := []string{
+		"1-clocking.nes",
+		"2-details.nes",
+		"3-A12_clocking.nes",
+		"4-scanline_timing.nes",
+		"5-MMC3.nes",
+	}
+
+	for _, rom := range roms {
+		t.Run(rom, func(t *testing.T) {
+			runBlargg(t, "../roms/mapper/mmc3_test/"+rom)
+		})
+	}
+}
+
+// testMMC3Rom returns an MMC3 rom that renders with the background at $0000
+// and sprites at $1000, with the IRQ latch set to latch. Its IRQ handler
+// acknowledges the IRQ and counts it at $00.
+func testMMC3Rom(latch byte) []byte {
+	rom := []byte{'N', 'E', 'S', 0x1a, 2, 1, 0x40, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	prg := make([]byte, 2*prgMul)
+
+	code := []byte{
+		0x78,       // SEI
+		0xD8,       // CLD
+		0xA2, 0xFF, // LDX #$FF
+		0x9A,             // TXS
+		0x2C, 0x02, 0x20, // BIT $2002
+		0x10, 0xFB, // BPL -5
+		0x2C, 0x02, 0x20, // BIT $2002
+		0x10, 0xFB, // BPL -5
+		0xA9, 0x08, // LDA #$08
+		0x8D, 0x00, 0x20, // STA $2000
+		0xA9, latch, // LDA #latch
+		0x8D, 0x00, 0xC0, // STA $C000
+		0x8D, 0x01, 0xC0, // STA $C001
+		0x8D, 0x01, 0xE0, // STA $E001
+		0xA9, 0x18, // LDA #$18
+		0x8D, 0x01, 0x20, // STA $2001
+		0x58,             // CLI
+		0x4C, 0x25, 0xE0, // JMP $E025
+	}
+	irq := []byte{
+		0x8D, 0x00, 0xE0, // STA $E000
+		0x8D, 0x01, 0xE0, // STA $E001
+		0xE6, 0x00, // INC $00
+		0x40, // RTI
+	}
+	copy(prg[0x6000:], code)
+	copy(prg[0x6100:], irq)
+	copy(prg[0x7FFA:], []byte{0x08, 0xE1, 0x00, 0xE0, 0x00, 0xE1}) // NMI on the RTI
+
+	rom = append(rom, prg...)
+	return append(rom, make([]byte, chrMul)...)
+}
+
+func TestMMC3_ScanlineIRQ(t *testing.T) {
+	const latch = 20
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.LoadRom(bytes.NewReader(testMMC3Rom(latch))); err != nil {
+		t.Fatalf("LoadRom() unexpected error %v", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-console.AudioChannel():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// the counter is reloaded on the pre-render line and every time it runs
+	// out, so the irq fires every latch+1 scanlines starting at latch-1
+	const irqs = 5
+	var lines []int
+	for console.ppu.frame < 4 && len(lines) < irqs {
+		if console.cpu.interrupt == irq {
+			lines = append(lines, console.ppu.scanline)
+		}
+		console.cpu.execute(console.bus)
+	}
+
+	if len(lines) != irqs {
+		t.Fatalf("irq fired %d times, want %d", len(lines), irqs)
+	}
+	for i, line := range lines {
+		if want := latch - 1 + i*(latch+1); line != want {
+			t.Errorf("irq %d fired on scanline %d, want %d", i, line, want)
+		}
+	}
+	if got := console.Read(0x0000); got != irqs-1 {
+		t.Errorf("irq handled %d times, want %d", got, irqs-1)
+	}
+}
@@ -0,0 +1,481 @@
+package nes
+
+// mmc5PRGRAMSize is the PRG-RAM given to MMC5 boards when the header can't
+// tell how much they have, the most any of them has.
+const mmc5PRGRAMSize = 64 * 1024
+
+// MMC5 (mapper 5, ExROM) is the most capable Nintendo board. Its registers
+// live in the expansion area:
+//
+//	$5100       PRG mode (0: 32K; 1: 16K+16K; 2: 16K+8K+8K; 3: 8K x4)
+//	$5101       CHR mode (0: 8K; 1: 4K; 2: 2K; 3: 1K)
+//	$5102-$5103 PRG-RAM protect, writes are allowed when they are 2 and 1
+//	$5104       ExRAM mode (0: nametable; 1: extended attributes;
+//	            2: CPU RAM; 3: CPU ROM)
+//	$5105       Nametable mapping, 2 bits per nametable (0: CIRAM page 0;
+//	            1: CIRAM page 1; 2: ExRAM; 3: fill mode)
+//	$5106-$5107 Fill mode tile and palette
+//	$5113       8K PRG-RAM bank at $6000
+//	$5114-$5117 PRG banks, bit 7 selects ROM over RAM ($5117 is always ROM)
+//	$5120-$5127 CHR banks for sprites (set A)
+//	$5128-$512B CHR banks for the background (set B)
+//	$5130       Upper CHR bank bits
+//	$5200-$5202 Vertical split control, scroll and CHR bank
+//	$5203       IRQ scanline
+//	$5204       IRQ enable (write); IRQ pending and in-frame (read)
+//	$5205-$5206 Unsigned 8x8 multiplier
+//	$5C00-$5FFF ExRAM
+//
+// The board has no access to the PPU state, it works everything out by
+// watching the bus. Three fetches of the same nametable address in a row only
+// happen at the end of a rendered scanline, so that's how it counts them, and
+// from there it knows which of the 170 fetches of the line are for sprites
+// and which ones are for the background. Rendering is assumed to have stopped
+// when the PPU goes 3 CPU cycles without fetching anything.
+//
+// With 8x16 sprites set A is used for sprites and set B for the background,
+// otherwise the last set written to is used for everything.
+type mmc5 struct {
+	cart *cartridge
+
+	prgMode          byte
+	chrMode          byte
+	prgRAMProtect    [2]byte
+	exRAMMode        byte
+	nametableMapping byte
+	fillTile         byte
+	fillAttr         byte
+	prgBanks         [5]byte // $5113-$5117
+	chrBanks         [12]int // $5120-$512B, with the upper bits from $5130
+	chrUpper         byte    // $5130
+	lastCHRSet       int     // 0: A, 1: B
+	exRAM            [1024]byte
+
+	splitCtrl   byte
+	splitScroll byte
+	splitBank   byte
+
+	irqTarget  byte
+	irqEnabled bool
+	irqPending bool
+
+	multiplicand byte
+	multiplier   byte
+
+	// snooped from $2000 and $2001
+	sprites8x16 bool
+	rendering   bool
+
+	lastAddress      uint16
+	nametableMatches int
+	inFrame          bool
+	scanline         int
+	fetches          int // ppu fetches since the start of the scanline
+	idleCycles       int // cpu cycles since the last ppu fetch
+
+	// the fetch in progress, worked out in ppuAddress
+	spriteFetch bool
+	bgPhase     int // 0: nametable; 1: attribute; 2, 3: pattern; -1: not a background fetch
+	exAttr      byte
+	inSplit     bool
+	splitY      int
+	splitTile   uint16
+	splitAttr   byte
+
+	prgOffsets [5]int // $6000, $8000, $A000, $C000, $E000
+	prgIsRAM   [5]bool
+	chrOffsets [2][8]int // set A, set B
+}
+
+func newMMC5(c *cartridge) Mapper {
+	m := &mmc5{
+		cart:     c,
+		prgMode:  3,
+		chrMode:  3,
+		prgBanks: [5]byte{0, 0xFF, 0xFF, 0xFF, 0xFF},
+		bgPhase:  -1,
+	}
+	m.updatePRG()
+	m.updateCHR()
+	return m
+}
+
+func (m *mmc5) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0x6000:
+		// fetching the NMI vector means vblank has started
+		if address == 0xFFFA || address == 0xFFFB {
+			m.inFrame = false
+		}
+
+		slot := (address - 0x6000) / 0x2000
+		offset := m.prgOffsets[slot] + int(address%0x2000)
+		if m.prgIsRAM[slot] {
+			return m.cart.prgRAM[offset%len(m.cart.prgRAM)]
+		}
+		return m.cart.prg[offset]
+
+	case address >= 0x5C00:
+		if m.exRAMMode >= 2 {
+			return m.exRAM[address-0x5C00]
+		}
+
+	case address == 0x5204:
+		var status byte
+		if m.irqPending {
+			status |= 0x80
+		}
+		if m.inFrame {
+			status |= 0x40
+		}
+		m.irqPending = false
+		return status
+
+	case address == 0x5205:
+		return byte(uint16(m.multiplicand) * uint16(m.multiplier))
+
+	case address == 0x5206:
+		return byte(uint16(m.multiplicand) * uint16(m.multiplier) >> 8)
+	}
+
+	return 0
+}
+
+func (m *mmc5) cpuWrite(address uint16, value byte) {
+	switch {
+	case address >= 0x6000:
+		slot := (address - 0x6000) / 0x2000
+		if m.prgIsRAM[slot] && m.prgRAMProtect == [2]byte{2, 1} {
+			offset := m.prgOffsets[slot] + int(address%0x2000)
+			m.cart.prgRAM[offset%len(m.cart.prgRAM)] = value
+		}
+
+	case address >= 0x5C00:
+		switch m.exRAMMode {
+		case 0, 1:
+			// only writable while rendering, zero is written otherwise
+			if !m.inFrame {
+				value = 0
+			}
+			m.exRAM[address-0x5C00] = value
+		case 2:
+			m.exRAM[address-0x5C00] = value
+		}
+
+	case address >= 0x5100:
+		m.writeRegister(address, value)
+	}
+}
+
+func (m *mmc5) writeRegister(address uint16, value byte) {
+	switch {
+	case address == 0x5100:
+		m.prgMode = value & 0x03
+		m.updatePRG()
+	case address == 0x5101:
+		m.chrMode = value & 0x03
+		m.updateCHR()
+	case address == 0x5102, address == 0x5103:
+		m.prgRAMProtect[address-0x5102] = value & 0x03
+	case address == 0x5104:
+		m.exRAMMode = value & 0x03
+	case address == 0x5105:
+		m.nametableMapping = value
+	case address == 0x5106:
+		m.fillTile = value
+	case address == 0x5107:
+		m.fillAttr = value & 0x03
+	case address >= 0x5113 && address <= 0x5117:
+		m.prgBanks[address-0x5113] = value
+		m.updatePRG()
+	case address >= 0x5120 && address <= 0x512B:
+		m.chrBanks[address-0x5120] = int(value) | int(m.chrUpper)<<8
+		m.lastCHRSet = 0
+		if address >= 0x5128 {
+			m.lastCHRSet = 1
+		}
+		m.updateCHR()
+	case address == 0x5130:
+		m.chrUpper = value & 0x03
+	case address == 0x5200:
+		m.splitCtrl = value
+	case address == 0x5201:
+		m.splitScroll = value
+	case address == 0x5202:
+		m.splitBank = value
+	case address == 0x5203:
+		m.irqTarget = value
+	case address == 0x5204:
+		m.irqEnabled = value&0x80 > 0
+	case address == 0x5205:
+		m.multiplicand = value
+	case address == 0x5206:
+		m.multiplier = value
+	}
+}
+
+func (m *mmc5) updatePRG() {
+	m.mapPRG(0, m.prgBanks[0], false)
+
+	b := m.prgBanks
+	switch m.prgMode {
+	case 0:
+		for i := byte(0); i < 4; i++ {
+			m.mapPRG(1+int(i), b[4]&0x7C|i, true)
+		}
+	case 1:
+		rom := b[2]&0x80 > 0
+		m.mapPRG(1, b[2]&^1, rom)
+		m.mapPRG(2, b[2]|1, rom)
+		m.mapPRG(3, b[4]&^1, true)
+		m.mapPRG(4, b[4]|1, true)
+	case 2:
+		rom := b[2]&0x80 > 0
+		m.mapPRG(1, b[2]&^1, rom)
+		m.mapPRG(2, b[2]|1, rom)
+		m.mapPRG(3, b[3], b[3]&0x80 > 0)
+		m.mapPRG(4, b[4], true)
+	case 3:
+		m.mapPRG(1, b[1], b[1]&0x80 > 0)
+		m.mapPRG(2, b[2], b[2]&0x80 > 0)
+		m.mapPRG(3, b[3], b[3]&0x80 > 0)
+		m.mapPRG(4, b[4], true)
+	}
+}
+
+func (m *mmc5) mapPRG(slot int, bank byte, rom bool) {
+	m.prgIsRAM[slot] = !rom
+	if rom {
+		m.prgOffsets[slot] = bankOffset(m.cart.prg, int(bank&0x7F), 0x2000)
+	} else {
+		m.prgOffsets[slot] = bankOffset(m.cart.prgRAM, int(bank&0x07), 0x2000)
+	}
+}
+
+func (m *mmc5) updateCHR() {
+	// set B only has 4 registers, they are repeated for $1000-$1FFF
+	sets := [2][8]int{}
+	copy(sets[0][:], m.chrBanks[:8])
+	copy(sets[1][:4], m.chrBanks[8:])
+	copy(sets[1][4:], m.chrBanks[8:])
+
+	for set, regs := range sets {
+		for slot := 0; slot < 8; slot++ {
+			// bank in 1K units
+			var bank int
+			switch m.chrMode {
+			case 0:
+				bank = regs[7]*8 + slot
+			case 1:
+				bank = regs[slot/4*4+3]*4 + slot%4
+			case 2:
+				bank = regs[slot/2*2+1]*2 + slot%2
+			case 3:
+				bank = regs[slot]
+			}
+			m.chrOffsets[set][slot] = bankOffset(m.cart.chr, bank, 0x0400)
+		}
+	}
+}
+
+// chrSet returns the CHR bank set in use for the current fetch.
+func (m *mmc5) chrSet() int {
+	if m.sprites8x16 && m.inFrame {
+		if m.spriteFetch {
+			return 0
+		}
+		return 1
+	}
+
+	return m.lastCHRSet
+}
+
+func (m *mmc5) ppuRead(address uint16) byte {
+	if m.bgPhase >= 2 {
+		switch {
+		case m.inSplit:
+			offset := bankOffset(m.cart.chr, int(m.splitBank), 0x1000)
+			return m.cart.chr[offset+int(address&0x0FF8)+m.splitY%8]
+		case m.exRAMMode == 1:
+			bank := int(m.exAttr&0x3F) | int(m.chrUpper)<<6
+			return m.cart.chr[bankOffset(m.cart.chr, bank, 0x1000)+int(address%0x1000)]
+		}
+	}
+
+	return m.cart.chr[m.chrOffsets[m.chrSet()][address/0x0400]+int(address%0x0400)]
+}
+
+func (m *mmc5) ppuWrite(address uint16, value byte) {
+	if m.cart.chrRAM {
+		m.cart.chr[m.chrOffsets[m.chrSet()][address/0x0400]+int(address%0x0400)] = value
+	}
+}
+
+// attributeByte repeats a 2 bit palette in the 4 quadrants, so that it comes
+// out the same no matter which one the PPU picks.
+func attributeByte(palette byte) byte {
+	return palette * 0x55
+}
+
+func (m *mmc5) readNametable(address uint16, ciram [2]*[1024]byte) byte {
+	switch {
+	case m.bgPhase == 0 && m.inSplit:
+		return m.exRAM[m.splitTile]
+	case m.bgPhase == 1 && m.inSplit:
+		return attributeByte(m.splitAttr)
+	case m.bgPhase == 1 && m.exRAMMode == 1:
+		return attributeByte(m.exAttr >> 6)
+	}
+
+	offset := address % 0x0400
+	switch m.nametableMapping >> ((address - 0x2000) / 0x0400 % 4 * 2) & 0x03 {
+	case 0:
+		return ciram[0][offset]
+	case 1:
+		return ciram[1][offset]
+	case 2:
+		if m.exRAMMode < 2 {
+			return m.exRAM[offset]
+		}
+		return 0
+	default:
+		if offset >= 0x03C0 {
+			return attributeByte(m.fillAttr)
+		}
+		return m.fillTile
+	}
+}
+
+func (m *mmc5) writeNametable(address uint16, value byte, ciram [2]*[1024]byte) {
+	offset := address % 0x0400
+	switch m.nametableMapping >> ((address - 0x2000) / 0x0400 % 4 * 2) & 0x03 {
+	case 0:
+		ciram[0][offset] = value
+	case 1:
+		ciram[1][offset] = value
+	case 2:
+		if m.exRAMMode < 2 {
+			m.exRAM[offset] = value
+		}
+	}
+}
+
+// mirrorMode reports the arrangement closest to $5105, the PPU goes through
+// readNametable instead.
+func (m *mmc5) mirrorMode() mirrorMode {
+	switch m.nametableMapping {
+	case 0x44:
+		return vertical
+	case 0x50:
+		return horizontal
+	case 0x00:
+		return singleScreenLow
+	case 0x55:
+		return singleScreenHigh
+	default:
+		return quad
+	}
+}
+
+func (m *mmc5) irq() bool {
+	return m.irqPending && m.irqEnabled
+}
+
+func (m *mmc5) ppuRegisterWrite(address uint16, value byte) {
+	switch address % 8 {
+	case 0:
+		m.sprites8x16 = value&0x20 > 0
+	case 1:
+		m.rendering = value&0x18 > 0
+		if !m.rendering {
+			m.inFrame = false
+		}
+	}
+}
+
+func (m *mmc5) ppuAddress(address uint16) {
+	m.idleCycles = 0
+
+	if address >= 0x2000 && address < 0x3000 && address == m.lastAddress {
+		m.nametableMatches++
+		if m.nametableMatches == 2 {
+			m.startScanline()
+		}
+	} else {
+		m.nametableMatches = 0
+	}
+	m.lastAddress = address
+
+	n := m.fetches
+	m.fetches++
+
+	// 32 background tiles, 8 sprites, the first 2 tiles of the next line
+	// and 2 unused nametable fetches, 4 fetches each but for the last ones
+	m.spriteFetch = n >= 128 && n < 160
+	m.bgPhase = -1
+	if !m.inFrame || m.spriteFetch || n >= 168 {
+		return
+	}
+
+	m.bgPhase = n % 4
+	if m.bgPhase == 0 {
+		tile, line := n/4+2, m.scanline
+		if n >= 160 {
+			tile, line = (n-160)/4, m.scanline+1
+		}
+		m.fetchTile(tile, line, address)
+	}
+}
+
+func (m *mmc5) startScanline() {
+	m.fetches = 0
+
+	if !m.inFrame {
+		m.inFrame = true
+		m.scanline = 0
+		m.irqPending = false
+		return
+	}
+
+	m.scanline++
+	if m.scanline == int(m.irqTarget) {
+		m.irqPending = true
+	}
+}
+
+// fetchTile is called on the nametable fetch of every background tile, tile
+// is the column on the screen and line the scanline it will be drawn on.
+func (m *mmc5) fetchTile(tile, line int, address uint16) {
+	m.exAttr = m.exRAM[address%0x0400]
+
+	m.inSplit = false
+	if m.splitCtrl&0x80 == 0 || m.exRAMMode >= 2 {
+		return
+	}
+
+	limit := int(m.splitCtrl & 0x1F)
+	if m.splitCtrl&0x40 > 0 {
+		m.inSplit = tile >= limit
+	} else {
+		m.inSplit = tile < limit
+	}
+	if !m.inSplit {
+		return
+	}
+
+	y := (int(m.splitScroll) + line) % 240
+	col := tile % 32
+	m.splitY = y
+	m.splitTile = uint16(y/8*32 + col)
+
+	attr := m.exRAM[0x03C0+y/32*8+col/4]
+	shift := uint(y/16%2*4 + col/2%2*2)
+	m.splitAttr = attr >> shift & 0x03
+}
+
+func (m *mmc5) clock() {
+	m.idleCycles++
+	if m.idleCycles >= 3 {
+		m.inFrame = false
+	}
+}
@@ -0,0 +1,250 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestMMC5() *mmc5 {
+	return newTestBoard(5, 0).mapper.(*mmc5)
+}
+
+// scanlineMMC5 simulates the fetches of a rendered scanline: 32 background
+// tiles, 8 sprites, the first 2 tiles of the next line and the 2 unused
+// nametable fetches.
+func scanlineMMC5(m *mmc5) {
+	tile := func(nt uint16) {
+		m.ppuAddress(nt)
+		m.ppuAddress(0x23C0)
+		m.ppuAddress(0x0000)
+		m.ppuAddress(0x0008)
+		m.clock()
+	}
+
+	for i := uint16(2); i < 34; i++ {
+		tile(0x2000 + i%32)
+	}
+	for i := 0; i < 8; i++ {
+		m.ppuAddress(0x2000)
+		m.ppuAddress(0x2000)
+		m.ppuAddress(0x1000)
+		m.ppuAddress(0x1008)
+		m.clock()
+	}
+	tile(0x2000)
+	tile(0x2001)
+	m.ppuAddress(0x2002)
+	m.ppuAddress(0x2002)
+	m.clock()
+}
+
+func TestMMC5_PRGBanking(t *testing.T) {
+	tests := []struct {
+		mode byte
+		want [4]byte
+	}{
+		{0, [4]byte{12, 13, 14, 15}},
+		{1, [4]byte{4, 5, 14, 15}},
+		{2, [4]byte{4, 5, 6, 15}},
+		{3, [4]byte{3, 5, 6, 15}},
+	}
+
+	for _, tt := range tests {
+		m := newTestMMC5()
+		m.cpuWrite(0x5100, tt.mode)
+		m.cpuWrite(0x5114, 0x83)
+		m.cpuWrite(0x5115, 0x85)
+		m.cpuWrite(0x5116, 0x86)
+		m.cpuWrite(0x5117, 0x0F)
+
+		for slot, want := range tt.want {
+			addr := 0x8000 + uint16(slot)*0x2000
+			if got := m.cpuRead(addr); got != want {
+				t.Errorf("prg mode %d: $%04X = %d, want %d", tt.mode, addr, got, want)
+			}
+		}
+	}
+}
+
+func TestMMC5_PRGRAM(t *testing.T) {
+	m := newTestMMC5()
+	m.cpuWrite(0x5100, 3)
+	m.cpuWrite(0x5113, 1)
+	m.cpuWrite(0x5114, 0x02) // RAM bank 2 at $8000
+
+	m.cpuWrite(0x6000, 0xAA)
+	if got := m.cpuRead(0x6000); got != 0 {
+		t.Errorf("write protected: $6000 = %02X, want 00", got)
+	}
+
+	m.cpuWrite(0x5102, 2)
+	m.cpuWrite(0x5103, 1)
+	m.cpuWrite(0x6000, 0xAA)
+	m.cpuWrite(0x8000, 0xBB)
+	if got := m.cart.prgRAM[0x2000]; got != 0xAA {
+		t.Errorf("prg ram bank 1 = %02X, want AA", got)
+	}
+	if got := m.cart.prgRAM[0x4000]; got != 0xBB {
+		t.Errorf("prg ram bank 2 = %02X, want BB", got)
+	}
+}
+
+func TestMMC5_CHRSets(t *testing.T) {
+	m := newTestMMC5()
+	m.cpuWrite(0x5101, 3)
+	for i := uint16(0); i < 8; i++ {
+		m.cpuWrite(0x5120+i, byte(10+i))
+	}
+	for i := uint16(0); i < 4; i++ {
+		m.cpuWrite(0x5128+i, byte(20+i))
+	}
+
+	// with 8x8 sprites the last written set is used everywhere
+	for slot := uint16(0); slot < 8; slot++ {
+		if got := m.ppuRead(slot * 0x0400); got != byte(20+slot%4) {
+			t.Errorf("8x8: $%04X = %d, want %d", slot*0x0400, got, 20+slot%4)
+		}
+	}
+
+	m.ppuRegisterWrite(0x2000, 0x20)
+	m.inFrame = true
+
+	m.spriteFetch = true
+	for slot := uint16(0); slot < 8; slot++ {
+		if got := m.ppuRead(slot * 0x0400); got != byte(10+slot) {
+			t.Errorf("8x16 sprites: $%04X = %d, want %d", slot*0x0400, got, 10+slot)
+		}
+	}
+}
+
+func TestMMC5_Nametables(t *testing.T) {
+	m := newTestMMC5()
+	var a, b [1024]byte
+	ciram := [2]*[1024]byte{&a, &b}
+
+	m.cpuWrite(0x5104, 0x02) // ExRAM as CPU RAM
+	m.cpuWrite(0x5C10, 0x77)
+	if got := m.cpuRead(0x5C10); got != 0x77 {
+		t.Errorf("exram = %02X, want 77", got)
+	}
+
+	m.cpuWrite(0x5104, 0x00)
+	m.cpuWrite(0x5105, 0xE4) // CIRAM 0, CIRAM 1, ExRAM, fill
+	m.cpuWrite(0x5106, 0x42)
+	m.cpuWrite(0x5107, 0x02)
+
+	m.writeNametable(0x2000, 1, ciram)
+	m.writeNametable(0x2400, 2, ciram)
+	if a[0] != 1 || b[0] != 2 {
+		t.Errorf("ciram = %d, %d, want 1, 2", a[0], b[0])
+	}
+	if got := m.readNametable(0x2810, ciram); got != 0x77 {
+		t.Errorf("exram nametable = %02X, want 77", got)
+	}
+	if got := m.readNametable(0x2C00, ciram); got != 0x42 {
+		t.Errorf("fill tile = %02X, want 42", got)
+	}
+	if got := m.readNametable(0x2FC0, ciram); got != 0xAA {
+		t.Errorf("fill attribute = %02X, want AA", got)
+	}
+
+	// outside of rendering the nametable modes can only write zeroes
+	m.cpuWrite(0x5C10, 0x55)
+	if m.exRAM[0x10] != 0 {
+		t.Errorf("exram = %02X, want 00", m.exRAM[0x10])
+	}
+}
+
+func TestMMC5_ScanlineIRQ(t *testing.T) {
+	m := newTestMMC5()
+	m.cpuWrite(0x5203, 3)
+	m.cpuWrite(0x5204, 0x80)
+
+	scanlineMMC5(m) // pre-render line
+	if m.inFrame {
+		t.Fatalf("in frame before the first scanline")
+	}
+
+	for line := 0; line < 3; line++ {
+		scanlineMMC5(m)
+		if !m.inFrame {
+			t.Fatalf("line %d: not in frame", line)
+		}
+		if m.irq() {
+			t.Fatalf("line %d: unexpected irq", line)
+		}
+	}
+
+	scanlineMMC5(m)
+	if !m.irq() {
+		t.Fatalf("line 3: expected irq")
+	}
+	if got := m.cpuRead(0x5204); got != 0xC0 {
+		t.Errorf("$5204 = %02X, want C0", got)
+	}
+	if m.irq() {
+		t.Errorf("reading $5204 didn't acknowledge the irq")
+	}
+
+	for i := 0; i < 3; i++ {
+		m.clock()
+	}
+	if m.inFrame {
+		t.Errorf("still in frame after the ppu stopped fetching")
+	}
+}
+
+func TestMMC5_ExtendedAttributes(t *testing.T) {
+	m := newTestMMC5()
+	var a, b [1024]byte
+	ciram := [2]*[1024]byte{&a, &b}
+
+	m.cpuWrite(0x5104, 0x01)
+	scanlineMMC5(m)
+	scanlineMMC5(m)
+	m.exRAM[2] = 0xC5 // palette 3, 4K bank 5
+
+	m.ppuAddress(0x2002)
+	m.ppuAddress(0x23C0)
+	if got := m.readNametable(0x23C0, ciram); got != 0xFF {
+		t.Errorf("attribute = %02X, want FF", got)
+	}
+	m.ppuAddress(0x0000)
+	if got := m.ppuRead(0x0000); got != 20 {
+		t.Errorf("pattern from 1K bank %d, want 20", got)
+	}
+}
+
+func TestMMC5_Multiplier(t *testing.T) {
+	m := newTestMMC5()
+	m.cpuWrite(0x5205, 200)
+	m.cpuWrite(0x5206, 100)
+
+	if got := uint16(m.cpuRead(0x5206))<<8 | uint16(m.cpuRead(0x5205)); got != 20000 {
+		t.Errorf("200 * 100 = %d", got)
+	}
+}
+
+func TestLoadRom_MMC5PRGRAM(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   int
+	}{
+		{"iNES", []byte{'N', 'E', 'S', 0x1a, 2, 1, 0x50, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}, mmc5PRGRAMSize},
+		{"NES 2.0 8K", []byte{'N', 'E', 'S', 0x1a, 2, 1, 0x50, 0x08, 0, 0, 0x07, 0, 0, 0, 0, 0}, 8 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rom := append(tt.header, make([]byte, 2*prgMul+chrMul)...)
+			c, err := loadRom(bytes.NewReader(rom))
+			if err != nil {
+				t.Fatalf("loadRom() unexpected error %v", err)
+			}
+			if got := len(c.prgRAM); got != tt.want {
+				t.Errorf("PRG-RAM is %d bytes, want %d", got, tt.want)
+			}
+		})
+	}
+}
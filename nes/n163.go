@@ -0,0 +1,284 @@
+package nes
+
+// N163 (mapper 19) is a Namco board with three switchable 8K PRG banks, eight
+// 1K CHR banks, CHR-ROM nametables, a CPU cycle IRQ counter and up to eight
+// wavetable sound channels.
+//
+//	$4800-$4FFF Sound RAM data port
+//	$5000-$57FF IRQ counter low 8 bits
+//	$5800-$5FFF IRQ counter high 7 bits and enable (bit 7)
+//	$8000-$BFFF CHR banks 0-7, one every $800
+//	$C000-$DFFF Nametable banks 0-3, one every $800, $E0-$FF picks the
+//	            console VRAM instead of CHR-ROM
+//	$E000-$E7FF 8K PRG bank at $8000, bit 6 disables the sound
+//	$E800-$EFFF 8K PRG bank at $A000
+//	$F000-$F7FF 8K PRG bank at $C000
+//	$F800-$FFFF Sound RAM address (bits 0-6) and auto increment (bit 7), also
+//	            the PRG-RAM write protection
+//
+// The last bank is fixed at $E000. CHR banks $E0-$FF are meant to map the
+// console VRAM into the pattern tables, no game relies on it and they read
+// from CHR like any other bank.
+type n163 struct {
+	cart *cartridge
+
+	prgBanks [3]byte
+	chrBanks [8]byte
+	ntBanks  [4]byte
+
+	writeProtect byte // $F800, writes need 0100 in the high nibble
+
+	irqCounter uint16
+	irqEnabled bool
+	irqPending bool
+
+	audio n163Audio
+
+	prgOffsets [4]int
+	chrOffsets [8]int
+}
+
+func newN163(c *cartridge) Mapper {
+	m := &n163{cart: c}
+	m.updateOffsets()
+	return m
+}
+
+func (m *n163) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0x8000:
+		slot := (address - 0x8000) / 0x2000
+		return m.cart.prg[m.prgOffsets[slot]+int(address%0x2000)]
+	case address >= 0x6000:
+		return m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)]
+	case address >= 0x5800:
+		value := byte(m.irqCounter >> 8)
+		if m.irqEnabled {
+			value |= 0x80
+		}
+		return value
+	case address >= 0x5000:
+		return byte(m.irqCounter)
+	case address >= 0x4800:
+		return m.audio.readData()
+	}
+
+	return 0
+}
+
+func (m *n163) cpuWrite(address uint16, value byte) {
+	switch {
+	case address >= 0xF800:
+		m.writeProtect = value
+		m.audio.writeAddress(value)
+	case address >= 0xE000:
+		bank := (address - 0xE000) / 0x0800
+		m.prgBanks[bank] = value & 0x3F
+		if bank == 0 {
+			m.audio.disabled = value&0x40 > 0
+		}
+	case address >= 0xC000:
+		m.ntBanks[(address-0xC000)/0x0800] = value
+	case address >= 0x8000:
+		m.chrBanks[(address-0x8000)/0x0800] = value
+	case address >= 0x6000:
+		if m.writeProtect&0xF0 != 0x40 {
+			return
+		}
+		if m.writeProtect>>((address-0x6000)/0x0800)&1 > 0 {
+			return
+		}
+		m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)] = value
+		return
+	case address >= 0x5800:
+		m.irqCounter = m.irqCounter&0x00FF | uint16(value&0x7F)<<8
+		m.irqEnabled = value&0x80 > 0
+		m.irqPending = false
+		return
+	case address >= 0x5000:
+		m.irqCounter = m.irqCounter&0x7F00 | uint16(value)
+		m.irqPending = false
+		return
+	case address >= 0x4800:
+		m.audio.writeData(value)
+		return
+	}
+
+	m.updateOffsets()
+}
+
+func (m *n163) updateOffsets() {
+	for i, bank := range m.prgBanks {
+		m.prgOffsets[i] = bankOffset(m.cart.prg, int(bank), 0x2000)
+	}
+	m.prgOffsets[3] = bankOffset(m.cart.prg, -1, 0x2000)
+
+	for i, bank := range m.chrBanks {
+		m.chrOffsets[i] = bankOffset(m.cart.chr, int(bank), 0x0400)
+	}
+}
+
+func (m *n163) ppuRead(address uint16) byte {
+	return m.cart.chr[m.chrOffsets[address/0x0400]+int(address%0x0400)]
+}
+
+func (m *n163) ppuWrite(address uint16, value byte) {
+	if m.cart.chrRAM {
+		m.cart.chr[m.chrOffsets[address/0x0400]+int(address%0x0400)] = value
+	}
+}
+
+func (m *n163) readNametable(address uint16, ciram [2]*[1024]byte) byte {
+	bank := m.ntBanks[(address-0x2000)/0x0400%4]
+	offset := int(address % 0x0400)
+	if bank >= 0xE0 {
+		return ciram[bank&1][offset]
+	}
+	return m.cart.chr[bankOffset(m.cart.chr, int(bank), 0x0400)+offset]
+}
+
+func (m *n163) writeNametable(address uint16, value byte, ciram [2]*[1024]byte) {
+	bank := m.ntBanks[(address-0x2000)/0x0400%4]
+	offset := int(address % 0x0400)
+	if bank >= 0xE0 {
+		ciram[bank&1][offset] = value
+		return
+	}
+	if m.cart.chrRAM {
+		m.cart.chr[bankOffset(m.cart.chr, int(bank), 0x0400)+offset] = value
+	}
+}
+
+func (m *n163) mirrorMode() mirrorMode    { return m.cart.mirrorMode }
+func (m *n163) irq() bool                 { return m.irqPending }
+func (m *n163) ppuAddress(address uint16) {}
+
+func (m *n163) clock() {
+	if m.irqEnabled && m.irqCounter < 0x7FFF {
+		m.irqCounter++
+		if m.irqCounter == 0x7FFF {
+			m.irqPending = true
+		}
+	}
+
+	m.audio.clock()
+}
+
+func (m *n163) audioChannels() []string { return n163Channels }
+func (m *n163) sample(out []float32)    { m.audio.sample(out) }
+
+// n163Volume scales the N163 output to the APU's. The chip is loud, a single
+// channel at full volume is about twice as loud as a VRC6 pulse.
+const n163Volume = 0.00094
+
+// n163Audio is the sound hardware of the N163. The channels play 4 bit
+// samples stored in the 128 bytes of internal RAM, two per byte with the low
+// nibble first, and keep their registers in the top of it:
+//
+//	$x0  FFFF FFFF  frequency low
+//	$x1  PPPP PPPP  phase low
+//	$x2  FFFF FFFF  frequency mid
+//	$x3  PPPP PPPP  phase mid
+//	$x4  LLLL LLFF  length (256 - L*4 samples), frequency high
+//	$x5  PPPP PPPP  phase high
+//	$x6  AAAA AAAA  wave address, in samples
+//	$x7  .CCC VVVV  enabled channels - 1 (only in $7F), volume
+//
+// Channel 7 lives at $78, channel 6 at $70 and so on, and only the last
+// C+1 of them are enabled. The chip updates one channel every 15 CPU cycles
+// and outputs only that one until the next, a round robin that gets faster
+// the fewer channels are enabled. After the console filters, what comes out
+// is the mean of the channels, which is what sample returns.
+type n163Audio struct {
+	ram      [128]byte
+	address  byte
+	autoInc  bool
+	disabled bool
+
+	timer   int
+	current int // channel being updated
+	outputs [8]int
+}
+
+func (a *n163Audio) writeAddress(value byte) {
+	a.address = value & 0x7F
+	a.autoInc = value&0x80 > 0
+}
+
+func (a *n163Audio) readData() byte {
+	value := a.ram[a.address]
+	if a.autoInc {
+		a.address = (a.address + 1) & 0x7F
+	}
+	return value
+}
+
+func (a *n163Audio) writeData(value byte) {
+	a.ram[a.address] = value
+	if a.autoInc {
+		a.address = (a.address + 1) & 0x7F
+	}
+}
+
+// channels returns how many channels are enabled.
+func (a *n163Audio) channels() int {
+	return int(a.ram[0x7F]>>4&0x07) + 1
+}
+
+func (a *n163Audio) clock() {
+	if a.disabled {
+		return
+	}
+
+	a.timer++
+	if a.timer < 15 {
+		return
+	}
+	a.timer = 0
+
+	first := 8 - a.channels()
+	if a.current < first {
+		a.current = first
+	}
+	a.updateChannel(a.current)
+
+	a.current++
+	if a.current > 7 {
+		a.current = first
+	}
+}
+
+func (a *n163Audio) updateChannel(ch int) {
+	regs := a.ram[0x40+ch*8:]
+
+	freq := uint32(regs[4]&0x03)<<16 | uint32(regs[2])<<8 | uint32(regs[0])
+	phase := uint32(regs[5])<<16 | uint32(regs[3])<<8 | uint32(regs[1])
+	length := (256 - uint32(regs[4]&0xFC)) << 16
+
+	phase = (phase + freq) % length
+	regs[5], regs[3], regs[1] = byte(phase>>16), byte(phase>>8), byte(phase)
+
+	pos := byte(phase>>16) + regs[6]
+	wave := a.ram[pos/2]
+	if pos&1 > 0 {
+		wave >>= 4
+	}
+
+	a.outputs[ch] = (int(wave&0x0F) - 8) * int(regs[7]&0x0F)
+}
+
+// n163Channels names the N163 channels, in the order sample writes them. Only
+// the last ones are enabled, see channels.
+var n163Channels = []string{"n163_0", "n163_1", "n163_2", "n163_3", "n163_4", "n163_5", "n163_6", "n163_7"}
+
+// sample writes the output of every channel, each enabled one is heard 1/n of
+// the time.
+func (a *n163Audio) sample(out []float32) {
+	n := a.channels()
+	for i, v := range a.outputs {
+		out[i] = 0
+		if !a.disabled && i >= len(a.outputs)-n {
+			out[i] = float32(v) / float32(n) * n163Volume
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package nes
+
+import "testing"
+
+func TestN163_Banking(t *testing.T) {
+	c := newTestBoard(19, 0)
+	c.mapper.cpuWrite(0xE000, 3)
+	c.mapper.cpuWrite(0xE800, 4)
+	c.mapper.cpuWrite(0xF000, 5)
+	c.mapper.cpuWrite(0x8800, 17)
+	c.mapper.cpuWrite(0xB800, 21)
+
+	for slot, want := range [4]byte{3, 4, 5, 31} {
+		addr := 0x8000 + uint16(slot)*0x2000
+		if got := c.mapper.cpuRead(addr); got != want {
+			t.Errorf("$%04X bank = %d, want %d", addr, got, want)
+		}
+	}
+	if got := c.mapper.ppuRead(0x0400); got != 17 {
+		t.Errorf("$0400 bank = %d, want 17", got)
+	}
+	if got := c.mapper.ppuRead(0x1C00); got != 21 {
+		t.Errorf("$1C00 bank = %d, want 21", got)
+	}
+}
+
+func TestN163_Nametables(t *testing.T) {
+	c := newTestBoard(19, 0)
+	m := c.mapper.(*n163)
+	var a, b [1024]byte
+	ciram := [2]*[1024]byte{&a, &b}
+
+	m.cpuWrite(0xC000, 0xE1)
+	m.cpuWrite(0xC800, 0xE0)
+	m.cpuWrite(0xD000, 9)
+
+	m.writeNametable(0x2000, 1, ciram)
+	m.writeNametable(0x2400, 2, ciram)
+	if a[0] != 2 || b[0] != 1 {
+		t.Errorf("ciram = %d, %d, want 2, 1", a[0], b[0])
+	}
+	if got := m.readNametable(0x2800, ciram); got != 9 {
+		t.Errorf("chr nametable = %d, want 9", got)
+	}
+
+	// CHR-ROM can't be written
+	m.writeNametable(0x2800, 0x42, ciram)
+	if got := m.readNametable(0x2800, ciram); got != 9 {
+		t.Errorf("chr nametable after write = %d, want 9", got)
+	}
+}
+
+func TestN163_PRGRAMProtection(t *testing.T) {
+	c := newTestBoard(19, 0)
+
+	c.mapper.cpuWrite(0x6000, 0x11)
+	if got := c.mapper.cpuRead(0x6000); got != 0 {
+		t.Errorf("protected: $6000 = %02X, want 00", got)
+	}
+
+	c.mapper.cpuWrite(0xF800, 0x41) // only $6000-$67FF protected
+	c.mapper.cpuWrite(0x6000, 0x11)
+	c.mapper.cpuWrite(0x6800, 0x22)
+	if got := c.mapper.cpuRead(0x6000); got != 0 {
+		t.Errorf("$6000 = %02X, want 00", got)
+	}
+	if got := c.mapper.cpuRead(0x6800); got != 0x22 {
+		t.Errorf("$6800 = %02X, want 22", got)
+	}
+}
+
+func TestN163_IRQ(t *testing.T) {
+	c := newTestBoard(19, 0)
+	c.mapper.cpuWrite(0x5000, 0xFD)
+	c.mapper.cpuWrite(0x5800, 0xFF)
+
+	c.mapper.clock()
+	if c.mapper.irq() {
+		t.Fatalf("irq fired early")
+	}
+	c.mapper.clock()
+	if !c.mapper.irq() {
+		t.Fatalf("irq didn't fire at $7FFF")
+	}
+
+	// the counter stops there
+	c.mapper.clock()
+	if got := c.mapper.cpuRead(0x5000); got != 0xFF {
+		t.Errorf("counter low = %02X, want FF", got)
+	}
+
+	c.mapper.cpuWrite(0x5800, 0x00)
+	if c.mapper.irq() {
+		t.Errorf("writing $5800 didn't acknowledge the irq")
+	}
+}
+
+func TestN163_SoundRAM(t *testing.T) {
+	c := newTestBoard(19, 0)
+	c.mapper.cpuWrite(0xF800, 0xFE) // $7E, auto increment
+	c.mapper.cpuWrite(0x4800, 0x11)
+	c.mapper.cpuWrite(0x4800, 0x22)
+	c.mapper.cpuWrite(0x4800, 0x33)
+
+	c.mapper.cpuWrite(0xF800, 0x7E)
+	for _, want := range []byte{0x11, 0x11} {
+		if got := c.mapper.cpuRead(0x4800); got != want {
+			t.Errorf("$7E = %02X, want %02X", got, want)
+		}
+	}
+	c.mapper.cpuWrite(0xF800, 0x00)
+	if got := c.mapper.cpuRead(0x4800); got != 0x33 {
+		t.Errorf("address didn't wrap: $00 = %02X, want 33", got)
+	}
+}
+
+func TestN163_Wave(t *testing.T) {
+	var a n163Audio
+
+	// a 4 sample wave, 0 F 0 F, played one sample per update by channel 7
+	a.ram[0x00] = 0xF0
+	a.ram[0x01] = 0xF0
+	a.ram[0x78] = 0x00
+	a.ram[0x7A] = 0x00
+	a.ram[0x7C] = 0xFC | 0x01 // length 4, frequency $10000
+	a.ram[0x7E] = 0x00
+	a.ram[0x7F] = 0x0A // one channel, volume 10
+
+	want := []int{70, -80, 70, -80}
+	for i, want := range want {
+		for j := 0; j < 15; j++ {
+			a.clock()
+		}
+		if got := a.outputs[7]; got != want {
+			t.Errorf("update %d: output %d, want %d", i, got, want)
+		}
+	}
+
+	// with two channels, each one is heard half of the time
+	a.ram[0x7F] = 0x1A
+	got := make([]float32, len(n163Channels))
+	a.sample(got)
+	if want := float32(-80) / 2 * n163Volume; got[7] != want || got[6] != 0 {
+		t.Errorf("sample = %v, want %f on the last channel", got, want)
+	}
+}
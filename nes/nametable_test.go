@@ -0,0 +1,56 @@
+package nes
+
+import "testing"
+
+func TestPPU_NametableMirroring(t *testing.T) {
+	tests := []struct {
+		mode mirrorMode
+		want [4]byte
+	}{
+		{horizontal, [4]byte{2, 2, 4, 4}},
+		{vertical, [4]byte{3, 4, 3, 4}},
+		{quad, [4]byte{1, 2, 3, 4}},
+		{singleScreenLow, [4]byte{4, 4, 4, 4}},
+		{singleScreenHigh, [4]byte{4, 4, 4, 4}},
+	}
+
+	for _, tt := range tests {
+		c := &cartridge{mirrorMode: tt.mode}
+		c.mapper = newNROM(c)
+		p := newPpu()
+		p.cartridge = c
+
+		for i := uint16(0); i < 4; i++ {
+			p.writeNametable(0x2000+i*0x400, byte(i+1))
+		}
+
+		for i := uint16(0); i < 4; i++ {
+			if got := p.readNametable(0x2000 + i*0x400); got != tt.want[i] {
+				t.Errorf("mode %d: $%04X = %d, want %d", tt.mode, 0x2000+i*0x400, got, tt.want[i])
+			}
+			if got := p.readNametable(0x3000 + i*0x400); i < 3 && got != tt.want[i] {
+				t.Errorf("mode %d: $%04X = %d, want %d", tt.mode, 0x3000+i*0x400, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestPPU_NametableSingleScreenSwitch(t *testing.T) {
+	c := &cartridge{prg: make([]byte, prgMul*2), chr: make([]byte, chrMul)}
+	c.mapper = newAxROM(c)
+	p := newPpu()
+	p.cartridge = c
+
+	p.writeNametable(0x2000, 1)
+	c.mapper.cpuWrite(0x8000, 0x10)
+	p.writeNametable(0x2C00, 2)
+
+	if got := p.readNametable(0x2400); got != 2 {
+		t.Errorf("single screen high: $2400 = %d, want %d", got, 2)
+	}
+
+	c.mapper.cpuWrite(0x8000, 0x00)
+	if got := p.readNametable(0x2800); got != 1 {
+		t.Errorf("single screen low: $2800 = %d, want %d", got, 1)
+	}
+}
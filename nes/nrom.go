@@ -0,0 +1,47 @@
+package nes
+
+// NROM (mapper 0) has no bank switching at all. 16K of PRG is mirrored into
+// both halves of $8000-$FFFF and the 8K of CHR is mapped directly. A few
+// boards, like the one in Family Basic, also have PRG-RAM at $6000-$7FFF.
+type nrom struct {
+	cart *cartridge
+}
+
+func newNROM(c *cartridge) Mapper {
+	return &nrom{cart: c}
+}
+
+func (m *nrom) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0x8000:
+		return m.cart.prg[int(address-0x8000)%len(m.cart.prg)]
+	case address >= 0x6000:
+		return m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)]
+	}
+
+	return 0
+}
+
+func (m *nrom) cpuWrite(address uint16, value byte) {
+	if address >= 0x6000 && address < 0x8000 {
+		m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)] = value
+	}
+}
+
+func (m *nrom) ppuRead(address uint16) byte {
+	return m.cart.chr[address]
+}
+
+func (m *nrom) ppuWrite(address uint16, value byte) {
+	if m.cart.chrRAM {
+		m.cart.chr[address] = value
+	}
+}
+
+func (m *nrom) mirrorMode() mirrorMode {
+	return m.cart.mirrorMode
+}
+
+func (m *nrom) irq() bool                 { return false }
+func (m *nrom) ppuAddress(address uint16) {}
+func (m *nrom) clock()                    {}
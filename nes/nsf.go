@@ -0,0 +1,603 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	nsfHeaderLen = 0x80
+
+	// nsfDriverAddr is where the driver program lives, a part of the
+	// expansion area no sound chip uses.
+	nsfDriverAddr = 0x4100
+	// nsfTimerAddr has bit 7 set when it's time to call the play routine,
+	// reading it acknowledges the timer IRQ.
+	nsfTimerAddr = 0x40F0
+
+	// nsfDefaultSpeed is the play period, in microseconds, of files that
+	// don't set one, the NTSC frame rate.
+	nsfDefaultSpeed = 16639
+)
+
+// The expansion sound chips a tune can use, bits of nsfHeader.Chips.
+const (
+	nsfVRC6 = 1 << iota
+	nsfVRC7
+	nsfFDS
+	nsfMMC5
+	nsfN163
+	nsf5B
+)
+
+var (
+	nsfMagic = []byte{'N', 'E', 'S', 'M', 0x1A}
+
+	errNSFNoData = errors.New("nes: nsf: no music data")
+	errNSFTracks = errors.New("nes: nsf: no tracks")
+)
+
+type nsfHeader struct {
+	Magic     [5]byte
+	Version   byte
+	Songs     byte
+	StartSong byte // 1 based
+
+	LoadAddr uint16
+	InitAddr uint16
+	PlayAddr uint16
+
+	Title     [32]byte
+	Artist    [32]byte
+	Copyright [32]byte
+
+	// NTSCSpeed and PALSpeed are the play periods in microseconds.
+	NTSCSpeed uint16
+
+	// Banks are the initial 4K banks at $8000-$FFFF, all zero if the tune
+	// doesn't bankswitch.
+	Banks [8]byte
+
+	PALSpeed uint16
+
+	// 76543210
+	// ||||||||
+	// |||||||+- 1: PAL, 0: NTSC
+	// ||||||+-- 1: both
+	Region byte
+
+	// The expansion sound chips, see nsfVRC6 and the rest.
+	Chips byte
+
+	// NSF2 only, the flags and the length of the music data.
+	Flags   byte
+	DataLen [3]byte
+}
+
+// NSFInfo describes an NSF file.
+type NSFInfo struct {
+	Title     string
+	Artist    string
+	Copyright string
+
+	// Tracks is the number of tracks, StartTrack the one to play first, 0
+	// based.
+	Tracks     int
+	StartTrack int
+
+	// TrackInfo describes every track, Playlist is the order to play them
+	// in. Files without one get every track in order.
+	TrackInfo []NSFTrack
+	Playlist  []int
+
+	// ExpansionChips names the sound chips used besides the APU. The VRC7
+	// and MMC5 ones are not emulated and stay silent.
+	ExpansionChips []string
+}
+
+// NSFTrack describes a track of an NSF file, NSFe and NSF2 files can have
+// labels and lengths for them.
+type NSFTrack struct {
+	Label string
+
+	// Length is how long the track plays before fading out, 0 if it's not
+	// known and the track plays until stopped. Fade is how long the fade
+	// out takes.
+	Length time.Duration
+	Fade   time.Duration
+}
+
+// isNSF reports whether rom is an NSF file.
+func isNSF(rom []byte) bool {
+	return bytes.HasPrefix(rom, nsfMagic) || bytes.HasPrefix(rom, nsfeMagic)
+}
+
+// loadNSF builds the cartridge for an NSF, NSF2 or NSFe file.
+func loadNSF(rom []byte) (*cartridge, error) {
+	if bytes.HasPrefix(rom, nsfeMagic) {
+		return loadNSFe(rom)
+	}
+
+	var h nsfHeader
+	if err := binary.Read(bytes.NewReader(rom), binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("nes: nsf: unable to read header: %s", err)
+	}
+	if !bytes.Equal(h.Magic[:], nsfMagic) {
+		return nil, errNoMagic
+	}
+
+	info := NSFInfo{
+		Title:      cString(h.Title[:]),
+		Artist:     cString(h.Artist[:]),
+		Copyright:  cString(h.Copyright[:]),
+		Tracks:     int(h.Songs),
+		StartTrack: int(h.StartSong) - 1,
+	}
+
+	// NSF2 files can say how long the music data is and follow it with
+	// NSFe chunks
+	data := rom[nsfHeaderLen:]
+	dataLen := int(h.DataLen[0]) | int(h.DataLen[1])<<8 | int(h.DataLen[2])<<16
+	if h.Version >= 2 && dataLen > 0 {
+		if dataLen > len(data) {
+			return nil, errNSFNoData
+		}
+		chunks, err := readNSFeChunks(data[dataLen:])
+		if err != nil {
+			return nil, err
+		}
+		data = data[:dataLen]
+		chunks.apply(&info)
+	}
+
+	return newNSF(h, info, data)
+}
+
+// newNSF builds the cartridge for an NSF file: the music data laid out in 4K
+// banks, 8K of PRG-RAM and a driver program that runs the tune. The header
+// has the addresses, speeds, banks and chips of the tune and info the rest.
+func newNSF(h nsfHeader, info NSFInfo, data []byte) (*cartridge, error) {
+	if info.Tracks == 0 {
+		return nil, errNSFTracks
+	}
+	if len(data) == 0 {
+		return nil, errNSFNoData
+	}
+
+	m := &nsf{
+		info:     info,
+		data:     data,
+		initAddr: h.InitAddr,
+		playAddr: h.PlayAddr,
+		speed:    h.NTSCSpeed,
+		chips:    h.Chips,
+		fds:      h.Chips&nsfFDS > 0,
+	}
+	if m.info.StartTrack < 0 || m.info.StartTrack >= m.info.Tracks {
+		m.info.StartTrack = 0
+	}
+	if len(m.info.TrackInfo) != m.info.Tracks {
+		tracks := make([]NSFTrack, m.info.Tracks)
+		copy(tracks, m.info.TrackInfo)
+		m.info.TrackInfo = tracks
+	}
+	if len(m.info.Playlist) == 0 {
+		for i := 0; i < m.info.Tracks; i++ {
+			m.info.Playlist = append(m.info.Playlist, i)
+		}
+	}
+	for i, name := range []string{"VRC6", "VRC7", "FDS", "MMC5", "N163", "5B"} {
+		if h.Chips>>uint(i)&1 > 0 {
+			m.info.ExpansionChips = append(m.info.ExpansionChips, name)
+		}
+	}
+
+	// tunes made only for PAL are told so and played at their rate, the
+	// rest get the NTSC one
+	if h.Region&0x03 == 0x01 {
+		m.region = 1
+		m.speed = h.PALSpeed
+	}
+	if m.speed == 0 {
+		m.speed = nsfDefaultSpeed
+	}
+
+	for _, b := range h.Banks {
+		if b != 0 {
+			m.bankswitched = true
+		}
+	}
+
+	// Bankswitched tunes are split in 4K banks from the start of the page
+	// of the load address. The rest are laid out in $6000-$FFFF, only the
+	// FDS can load below $8000.
+	var image []byte
+	if m.bankswitched {
+		m.initBanks = h.Banks
+		image = append(make([]byte, h.LoadAddr&0x0FFF), data...)
+		if pad := len(image) % 0x1000; pad > 0 {
+			image = append(image, make([]byte, 0x1000-pad)...)
+		}
+	} else {
+		min := uint16(0x8000)
+		if m.fds {
+			min = 0x6000
+		}
+		if h.LoadAddr < min {
+			return nil, fmt.Errorf("nes: nsf: invalid load address $%04X", h.LoadAddr)
+		}
+
+		image = make([]byte, 0xA000)
+		copy(image[h.LoadAddr-0x6000:], data)
+	}
+
+	c := &cartridge{
+		info: CartridgeInfo{
+			Format:     NSF,
+			Title:      m.info.Title,
+			PRGROMSize: len(data),
+			PRGRAMSize: sramSize,
+			CHRRAMSize: chrMul,
+		},
+		mirrorMode: horizontal,
+		prg:        image,
+		chr:        make([]byte, chrMul),
+		chrRAM:     true,
+		prgRAM:     make([]byte, sramSize),
+	}
+
+	m.cart = c
+	m.startTrack(m.info.StartTrack)
+	c.mapper = m
+	c.audio = m
+	return c, nil
+}
+
+// nsf is the board of an NSF file. A driver program at nsfDriverAddr clears
+// the RAM, sets up the APU and calls the init routine of the tune with the
+// track number in A and the region in X, 0 for NTSC and 1 for PAL. From then
+// on a timer raises an IRQ at the rate of the tune and the driver calls the
+// play routine.
+//
+//	$40F0       Timer flag (bit 7), reading acknowledges the IRQ
+//	$4100-$41xx Driver program
+//	$5FF6-$5FF7 4K bank at $6000 and $7000, FDS tunes only
+//	$5FF8-$5FFF 4K banks at $8000-$FFFF
+//	$FFFA-$FFFF Vectors into the driver
+//
+// FDS tunes get RAM in place of the ROM, and the registers of the expansion
+// sound chips are where the boards that have them put them.
+type nsf struct {
+	cart *cartridge
+	info NSFInfo
+	data []byte
+
+	initAddr uint16
+	playAddr uint16
+	speed    uint16 // play period in microseconds
+	region   byte
+	chips    byte
+	fds      bool
+
+	bankswitched bool
+	initBanks    [8]byte
+	mem          []byte // the image as modified by FDS tunes
+	offsets      [10]int
+
+	track   int
+	driver  []byte
+	vectors [3]uint16 // nmi, reset and irq
+
+	timer      int64
+	timerFired bool
+	cycles     int64 // since the track started
+
+	vrc6Audio vrc6Audio
+	fdsAudio  fdsAudio
+	n163Audio n163Audio
+	s5bAudio  sunsoft5B
+
+	// MMC5 RAM and multiplier, some tunes use them even though its sound
+	// is not emulated
+	exRAM        [1024]byte
+	multiplicand byte
+	multiplier   byte
+}
+
+// startTrack puts everything back the way it is on power up and sets the
+// driver up to play track.
+func (m *nsf) startTrack(track int) {
+	m.track = track
+	m.mem = append(m.mem[:0], m.cart.prg...)
+	for i := range m.cart.prgRAM {
+		m.cart.prgRAM[i] = 0
+	}
+
+	if m.bankswitched {
+		for i, bank := range m.initBanks {
+			m.setBank(i+2, bank)
+		}
+		m.setBank(0, m.initBanks[6])
+		m.setBank(1, m.initBanks[7])
+	} else {
+		for i := range m.offsets {
+			m.setBank(i, byte(i))
+		}
+	}
+
+	m.timer = 0
+	m.timerFired = false
+	m.cycles = 0
+	m.vrc6Audio = vrc6Audio{}
+	m.fdsAudio = fdsAudio{}
+	m.n163Audio = n163Audio{}
+	m.s5bAudio = sunsoft5B{}
+	m.s5bAudio.noise.lfsr = 1
+	m.exRAM = [1024]byte{}
+
+	m.buildDriver()
+}
+
+// setBank maps the 4K bank at $6000 + slot * $1000.
+func (m *nsf) setBank(slot int, bank byte) {
+	m.offsets[slot] = bankOffset(m.mem, int(bank), 0x1000)
+}
+
+func (m *nsf) buildDriver() {
+	var d []byte
+	emit := func(b ...byte) { d = append(d, b...) }
+	pc := func() uint16 { return nsfDriverAddr + uint16(len(d)) }
+	// rel returns the offset of a branch at pc to target
+	rel := func(target uint16) byte { return byte(int(target) - int(pc()+2)) }
+
+	reset := pc()
+	emit(0x78)       // SEI
+	emit(0xD8)       // CLD
+	emit(0xA2, 0xFF) // LDX #$FF
+	emit(0x9A)       // TXS
+	emit(0xA9, 0x00) // LDA #$00
+	emit(0xAA)       // TAX
+	clearRAM := pc()
+	emit(0x95, 0x00) // STA $00,X
+	for page := byte(1); page < 8; page++ {
+		emit(0x9D, 0x00, page) // STA $xx00,X
+	}
+	emit(0xE8)                // INX
+	emit(0xD0, rel(clearRAM)) // BNE clearRAM
+
+	emit(0xA2, 0x13) // LDX #$13
+	clearAPU := pc()
+	emit(0x9D, 0x00, 0x40)    // STA $4000,X
+	emit(0xCA)                // DEX
+	emit(0x10, rel(clearAPU)) // BPL clearAPU
+	emit(0x8D, 0x15, 0x40)    // STA $4015
+	emit(0xA9, 0x0F)          // LDA #$0F
+	emit(0x8D, 0x15, 0x40)    // STA $4015
+	emit(0xA9, 0x40)          // LDA #$40
+	emit(0x8D, 0x17, 0x40)    // STA $4017, no frame IRQ
+
+	emit(0xA9, byte(m.track))                         // LDA #track
+	emit(0xA2, m.region)                              // LDX #region
+	emit(0x20, byte(m.initAddr), byte(m.initAddr>>8)) // JSR init
+	emit(0x58)                                        // CLI
+	loop := pc()
+	emit(0x4C, byte(loop), byte(loop>>8)) // JMP loop
+
+	irq := pc()
+	emit(0x2C, byte(nsfTimerAddr&0xFF), byte(nsfTimerAddr>>8)) // BIT timer
+	emit(0x10, 0x03)                                           // BPL rti
+	emit(0x20, byte(m.playAddr), byte(m.playAddr>>8))          // JSR play
+	rti := pc()
+	emit(0x40) // RTI
+
+	m.driver = d
+	m.vectors = [3]uint16{rti, reset, irq}
+}
+
+func (m *nsf) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0xFFFA:
+		v := m.vectors[(address-0xFFFA)/2]
+		if address&1 == 0 {
+			return byte(v)
+		}
+		return byte(v >> 8)
+	case address >= 0x8000 || address >= 0x6000 && m.fds:
+		return m.mem[m.offsets[(address-0x6000)/0x1000]+int(address&0x0FFF)]
+	case address >= 0x6000:
+		return m.cart.prgRAM[address-0x6000]
+	case address >= 0x5C00 && address < 0x5FF6 && m.chips&nsfMMC5 > 0:
+		return m.exRAM[address-0x5C00]
+	case address == 0x5205 && m.chips&nsfMMC5 > 0:
+		return byte(uint16(m.multiplicand) * uint16(m.multiplier))
+	case address == 0x5206 && m.chips&nsfMMC5 > 0:
+		return byte(uint16(m.multiplicand) * uint16(m.multiplier) >> 8)
+	case address >= 0x4800 && address < 0x5000 && m.chips&nsfN163 > 0:
+		return m.n163Audio.readData()
+	case address >= nsfDriverAddr && int(address) < nsfDriverAddr+len(m.driver):
+		return m.driver[address-nsfDriverAddr]
+	case address == nsfTimerAddr:
+		var v byte
+		if m.timerFired {
+			v = 0x80
+		}
+		m.timerFired = false
+		return v
+	case address >= 0x4040 && address <= 0x4092 && m.fds:
+		return m.fdsAudio.read(address)
+	}
+
+	return 0
+}
+
+func (m *nsf) cpuWrite(address uint16, value byte) {
+	switch {
+	case address >= 0x8000:
+		m.writeExpansion(address, value)
+		if m.fds {
+			m.mem[m.offsets[(address-0x6000)/0x1000]+int(address&0x0FFF)] = value
+		}
+	case address >= 0x6000:
+		if m.fds {
+			m.mem[m.offsets[(address-0x6000)/0x1000]+int(address&0x0FFF)] = value
+			return
+		}
+		m.cart.prgRAM[address-0x6000] = value
+	case address >= 0x5FF8:
+		if m.bankswitched {
+			m.setBank(int(address-0x5FF8)+2, value)
+		}
+	case address >= 0x5FF6:
+		if m.bankswitched && m.fds {
+			m.setBank(int(address-0x5FF6), value)
+		}
+	default:
+		m.writeExpansion(address, value)
+	}
+}
+
+// writeExpansion forwards writes to the registers of the expansion sound
+// chips the tune uses.
+func (m *nsf) writeExpansion(address uint16, value byte) {
+	if m.chips&nsfVRC6 > 0 {
+		switch address & 0xF000 {
+		case 0x9000, 0xA000, 0xB000:
+			if address&0x0FFF <= 0x03 {
+				m.vrc6Audio.writeRegister(address, value)
+			}
+		}
+	}
+
+	if m.chips&nsf5B > 0 {
+		switch address & 0xE000 {
+		case 0xC000:
+			m.s5bAudio.selectRegister(value)
+		case 0xE000:
+			m.s5bAudio.writeRegister(value)
+		}
+	}
+
+	if m.chips&nsfN163 > 0 {
+		switch {
+		case address >= 0xF800:
+			m.n163Audio.writeAddress(value)
+		case address >= 0x4800 && address < 0x5000:
+			m.n163Audio.writeData(value)
+		}
+	}
+
+	if m.chips&nsfMMC5 > 0 {
+		switch {
+		case address >= 0x5C00 && address < 0x5FF6:
+			m.exRAM[address-0x5C00] = value
+		case address == 0x5205:
+			m.multiplicand = value
+		case address == 0x5206:
+			m.multiplier = value
+		}
+	}
+
+	if m.fds && address >= 0x4040 && address <= 0x408A {
+		m.fdsAudio.write(address, value)
+	}
+}
+
+func (m *nsf) ppuRead(address uint16) byte {
+	return m.cart.chr[address]
+}
+
+func (m *nsf) ppuWrite(address uint16, value byte) {
+	m.cart.chr[address] = value
+}
+
+func (m *nsf) mirrorMode() mirrorMode    { return m.cart.mirrorMode }
+func (m *nsf) irq() bool                 { return m.timerFired }
+func (m *nsf) ppuAddress(address uint16) {}
+
+// elapsed returns how long the track has been playing.
+func (m *nsf) elapsed() time.Duration {
+	return time.Duration(float64(m.cycles) / cpuFreq * float64(time.Second))
+}
+
+// volume returns the volume of the track, from 1 down to 0 while it fades
+// out.
+func (m *nsf) volume() float32 {
+	t := m.info.TrackInfo[m.track]
+	elapsed := m.elapsed()
+	switch {
+	case t.Length == 0 || elapsed < t.Length:
+		return 1
+	case elapsed >= t.Length+t.Fade:
+		return 0
+	default:
+		return 1 - float32(elapsed-t.Length)/float32(t.Fade)
+	}
+}
+
+// ended reports whether the track played for as long as it lasts.
+func (m *nsf) ended() bool {
+	t := m.info.TrackInfo[m.track]
+	return t.Length > 0 && m.elapsed() >= t.Length+t.Fade
+}
+
+func (m *nsf) clock() {
+	m.cycles++
+	m.timer += 1000000
+	if period := int64(m.speed) * int64(cpuFreq); m.timer >= period {
+		m.timer -= period
+		m.timerFired = true
+	}
+
+	if m.chips&nsfVRC6 > 0 {
+		m.vrc6Audio.clock()
+	}
+	if m.fds {
+		m.fdsAudio.clock()
+	}
+	if m.chips&nsfN163 > 0 {
+		m.n163Audio.clock()
+	}
+	if m.chips&nsf5B > 0 {
+		m.s5bAudio.clock()
+	}
+}
+
+// audioChannels names the channels of the chips the tune uses, in the order
+// sample writes them.
+func (m *nsf) audioChannels() []string {
+	var names []string
+	if m.chips&nsfVRC6 > 0 {
+		names = append(names, vrc6Channels...)
+	}
+	if m.fds {
+		names = append(names, fdsChannels...)
+	}
+	if m.chips&nsfN163 > 0 {
+		names = append(names, n163Channels...)
+	}
+	if m.chips&nsf5B > 0 {
+		names = append(names, sunsoft5BChannels...)
+	}
+	return names
+}
+
+func (m *nsf) sample(out []float32) {
+	if m.chips&nsfVRC6 > 0 {
+		m.vrc6Audio.sample(out)
+		out = out[len(vrc6Channels):]
+	}
+	if m.fds {
+		m.fdsAudio.sample(out)
+		out = out[len(fdsChannels):]
+	}
+	if m.chips&nsfN163 > 0 {
+		m.n163Audio.sample(out)
+		out = out[len(n163Channels):]
+	}
+	if m.chips&nsf5B > 0 {
+		m.s5bAudio.sample(out)
+	}
+}
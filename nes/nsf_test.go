@@ -0,0 +1,143 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testNSF returns an NSF file with 3 tracks that loads prg at $8000. Its
+// init routine stores the track and the region at $00 and $01, and its play
+// routine counts the calls at $02.
+func testNSF(banks [8]byte, prg []byte) []byte {
+	h := nsfHeader{
+		Songs:     3,
+		StartSong: 2,
+		LoadAddr:  0x8000,
+		InitAddr:  0x8000,
+		PlayAddr:  0x8010,
+		Banks:     banks,
+	}
+	copy(h.Magic[:], nsfMagic)
+	copy(h.Title[:], "Title")
+	copy(h.Artist[:], "Artist")
+
+	code := []byte{
+		0x85, 0x00, // STA $00
+		0x86, 0x01, // STX $01
+		0x60, // RTS
+	}
+	copy(prg, code)
+	copy(prg[0x10:], []byte{
+		0xE6, 0x02, // INC $02
+		0x60, // RTS
+	})
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, h)
+	buf.Write(prg)
+	return buf.Bytes()
+}
+
+func TestConsole_NSF(t *testing.T) {
+	console := NewConsole(44100, 0, nil)
+	if err := console.PlayTrack(0); err == nil {
+		t.Errorf("PlayTrack() expected an error without an NSF")
+	}
+	if err := console.LoadRom(bytes.NewReader(testNSF([8]byte{}, make([]byte, 0x100)))); err != nil {
+		t.Fatalf("LoadRom() unexpected error %v", err)
+	}
+
+	info, ok := console.NSF()
+	if !ok || info.Title != "Title" || info.Artist != "Artist" || info.Tracks != 3 {
+		t.Fatalf("NSF() = %+v, %v, want the header", info, ok)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-console.AudioChannel():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	const frames = 10
+	for i := 0; i < frames; i++ {
+		console.StepFrame()
+	}
+	if got := console.Read(0x0000); got != 1 || console.Track() != 1 {
+		t.Errorf("init got track %d, want the start track", got)
+	}
+	if got := console.Read(0x0002); got < frames-1 || got > frames+1 {
+		t.Errorf("play called %d times in %d frames", got, frames)
+	}
+
+	if err := console.PlayTrack(3); err == nil {
+		t.Errorf("PlayTrack() expected an error for a missing track")
+	}
+	if err := console.PlayTrack(2); err != nil {
+		t.Fatalf("PlayTrack() unexpected error %v", err)
+	}
+	console.StepFrame()
+	if got := console.Read(0x0000); got != 2 {
+		t.Errorf("init got track %d, want 2", got)
+	}
+	if got := console.Read(0x0002); got > 2 {
+		t.Errorf("play called %d times, want the RAM cleared", got)
+	}
+}
+
+func TestNSF_Bankswitching(t *testing.T) {
+	prg := make([]byte, 3*0x1000)
+	for i := range prg {
+		prg[i] = byte(i / 0x1000)
+	}
+	c, err := loadNSF(testNSF([8]byte{0, 1, 2}, prg))
+	if err != nil {
+		t.Fatalf("loadNSF() unexpected error %v", err)
+	}
+	m := c.mapper.(*nsf)
+
+	if got := m.cpuRead(0x9000); got != 1 {
+		t.Errorf("$9000 = bank %d, want 1", got)
+	}
+	if got := m.cpuRead(0xA000); got != 2 {
+		t.Errorf("$A000 = bank %d, want 2", got)
+	}
+	m.cpuWrite(0x5FF9, 2)
+	if got := m.cpuRead(0x9000); got != 2 {
+		t.Errorf("$9000 = bank %d, want 2", got)
+	}
+	m.cpuWrite(0x5FF9, 7)
+	if got := m.cpuRead(0x9000); got != 1 {
+		t.Errorf("$9000 = bank %d, want the banks to wrap", got)
+	}
+
+	m.cpuWrite(0x6000, 0x42)
+	if got := m.cpuRead(0x6000); got != 0x42 {
+		t.Errorf("$6000 = %02X, want RAM", got)
+	}
+	if got := uint16(m.cpuRead(0xFFFC)) | uint16(m.cpuRead(0xFFFD))<<8; got != nsfDriverAddr {
+		t.Errorf("reset vector = $%04X, want the driver at $%04X", got, nsfDriverAddr)
+	}
+}
+
+func TestLoadNSF_Errors(t *testing.T) {
+	rom := testNSF([8]byte{}, make([]byte, 0x100))
+
+	noTracks := append([]byte(nil), rom...)
+	noTracks[6] = 0
+	if _, err := loadNSF(noTracks); err != errNSFTracks {
+		t.Errorf("loadNSF() = %v, want %v", err, errNSFTracks)
+	}
+	if _, err := loadNSF(rom[:nsfHeaderLen]); err != errNSFNoData {
+		t.Errorf("loadNSF() = %v, want %v", err, errNSFNoData)
+	}
+	if _, err := loadNSF(rom[:0x40]); err == nil {
+		t.Errorf("loadNSF() expected an error for a short header")
+	}
+}
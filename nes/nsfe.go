@@ -0,0 +1,206 @@
+package nes
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// NSFe files hold the same tune as an NSF in a sequence of chunks, each one a
+// little endian 32 bit length, a 4 byte ID and the data. Chunks whose ID
+// starts with an uppercase letter must be understood to play the file, the
+// rest can be skipped. NSF2 files can have the metadata chunks after the music
+// data.
+//
+//	INFO  load, init and play addresses, region, chips, tracks and start track
+//	DATA  the music data
+//	BANK  the initial banks
+//	RATE  the NTSC, PAL and Dendy play periods
+//	NSF2  the NSF2 flags
+//	VRC7  the VRC7 variant and patches, the tune uses a VRC7
+//	auth  title, artist, copyright and ripper, null terminated
+//	time  the length of every track, in milliseconds, -1 if not known
+//	fade  the fade out of every track, in milliseconds, -1 if not known
+//	tlbl  the label of every track, null terminated
+//	plst  the order to play the tracks in
+//	NEND  the end of the file
+
+// nsfDefaultFade is the fade out of tracks that have a length but no fade.
+const nsfDefaultFade = 5 * time.Second
+
+var (
+	nsfeMagic = []byte{'N', 'S', 'F', 'E'}
+
+	errNSFeInfo = errors.New("nes: nsfe: no INFO chunk")
+)
+
+// nsfeChunks are the chunks of an NSFe file or of the metadata of an NSF2
+// file.
+type nsfeChunks struct {
+	info     []byte
+	data     []byte
+	banks    []byte
+	rate     []byte
+	nsf2     []byte
+	vrc7     bool
+	auth     []string
+	times    []int32
+	fades    []int32
+	labels   []string
+	playlist []byte
+}
+
+func readNSFeChunks(b []byte) (nsfeChunks, error) {
+	var c nsfeChunks
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return c, errors.New("nes: nsfe: truncated chunk header")
+		}
+		size := binary.LittleEndian.Uint32(b)
+		id := string(b[4:8])
+		b = b[8:]
+		if uint32(len(b)) < size {
+			return c, fmt.Errorf("nes: nsfe: truncated %s chunk", id)
+		}
+		data := b[:size]
+		b = b[size:]
+
+		switch id {
+		case "INFO":
+			c.info = data
+		case "DATA":
+			c.data = data
+		case "BANK":
+			c.banks = data
+		case "RATE":
+			c.rate = data
+		case "NSF2":
+			c.nsf2 = data
+		case "VRC7":
+			// the VRC7 is not emulated, so neither are its variants and
+			// custom patches
+			c.vrc7 = true
+		case "auth":
+			c.auth = cStrings(data)
+		case "time":
+			c.times = int32s(data)
+		case "fade":
+			c.fades = int32s(data)
+		case "tlbl":
+			c.labels = cStrings(data)
+		case "plst":
+			c.playlist = data
+		case "NEND":
+			return c, nil
+		default:
+			if id[0] >= 'A' && id[0] <= 'Z' {
+				return c, fmt.Errorf("nes: nsfe: unsupported chunk %q", id)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// apply fills info with the metadata of the chunks.
+func (c nsfeChunks) apply(info *NSFInfo) {
+	for i, s := range c.auth {
+		switch i {
+		case 0:
+			info.Title = s
+		case 1:
+			info.Artist = s
+		case 2:
+			info.Copyright = s
+		}
+	}
+
+	if len(c.times) > 0 || len(c.fades) > 0 || len(c.labels) > 0 {
+		info.TrackInfo = make([]NSFTrack, info.Tracks)
+	}
+	for i := range info.TrackInfo {
+		t := &info.TrackInfo[i]
+		if i < len(c.labels) {
+			t.Label = c.labels[i]
+		}
+		if i < len(c.times) && c.times[i] >= 0 {
+			t.Length = time.Duration(c.times[i]) * time.Millisecond
+			t.Fade = nsfDefaultFade
+		}
+		if i < len(c.fades) && c.fades[i] >= 0 {
+			t.Fade = time.Duration(c.fades[i]) * time.Millisecond
+		}
+	}
+
+	for _, track := range c.playlist {
+		if int(track) < info.Tracks {
+			info.Playlist = append(info.Playlist, int(track))
+		}
+	}
+}
+
+// loadNSFe builds the cartridge for an NSFe file.
+func loadNSFe(rom []byte) (*cartridge, error) {
+	c, err := readNSFeChunks(rom[len(nsfeMagic):])
+	if err != nil {
+		return nil, err
+	}
+	if len(c.info) < 8 {
+		return nil, errNSFeInfo
+	}
+
+	var h nsfHeader
+	h.LoadAddr = binary.LittleEndian.Uint16(c.info[0:])
+	h.InitAddr = binary.LittleEndian.Uint16(c.info[2:])
+	h.PlayAddr = binary.LittleEndian.Uint16(c.info[4:])
+	h.Region = c.info[6]
+	h.Chips = c.info[7]
+	copy(h.Banks[:], c.banks)
+	if len(c.nsf2) > 0 {
+		h.Flags = c.nsf2[0]
+	}
+	if c.vrc7 {
+		h.Chips |= nsfVRC7
+	}
+	if len(c.rate) >= 2 {
+		h.NTSCSpeed = binary.LittleEndian.Uint16(c.rate[0:])
+	}
+	if len(c.rate) >= 4 {
+		h.PALSpeed = binary.LittleEndian.Uint16(c.rate[2:])
+	}
+
+	info := NSFInfo{Tracks: 1}
+	if len(c.info) > 8 {
+		info.Tracks = int(c.info[8])
+	}
+	if len(c.info) > 9 {
+		info.StartTrack = int(c.info[9])
+	}
+	c.apply(&info)
+
+	return newNSF(h, info, c.data)
+}
+
+// cStrings splits b in null terminated strings.
+func cStrings(b []byte) []string {
+	var s []string
+	for len(b) > 0 {
+		str := cString(b)
+		s = append(s, str)
+		if len(str) >= len(b) {
+			break
+		}
+		b = b[len(str)+1:]
+	}
+	return s
+}
+
+// int32s reads b as little endian 32 bit integers.
+func int32s(b []byte) []int32 {
+	v := make([]int32, len(b)/4)
+	for i := range v {
+		v[i] = int32(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return v
+}
@@ -0,0 +1,176 @@
+package nes
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func nsfeChunk(id string, data ...byte) []byte {
+	b := make([]byte, 8, 8+len(data))
+	binary.LittleEndian.PutUint32(b, uint32(len(data)))
+	copy(b[4:], id)
+	return append(b, data...)
+}
+
+func int32Bytes(v ...int32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[i*4:], uint32(x))
+	}
+	return b
+}
+
+func TestLoadNSFe(t *testing.T) {
+	var rom []byte
+	rom = append(rom, nsfeMagic...)
+	rom = append(rom, nsfeChunk("INFO", 0x00, 0x80, 0x00, 0x80, 0x10, 0x80, 0, 0, 3, 1)...)
+	rom = append(rom, nsfeChunk("DATA", 0x60)...)
+	rom = append(rom, nsfeChunk("auth", []byte("Game\x00Artist\x00Copyright\x00Ripper\x00")...)...)
+	rom = append(rom, nsfeChunk("time", int32Bytes(1000, -1, 2000)...)...)
+	rom = append(rom, nsfeChunk("fade", int32Bytes(500, -1)...)...)
+	rom = append(rom, nsfeChunk("tlbl", []byte("One\x00Two\x00Three\x00")...)...)
+	rom = append(rom, nsfeChunk("plst", 2, 0, 7)...)
+	rom = append(rom, nsfeChunk("xtra", 1, 2, 3)...)
+	rom = append(rom, nsfeChunk("NEND")...)
+
+	c, err := loadNSF(rom)
+	if err != nil {
+		t.Fatalf("loadNSF() unexpected error %v", err)
+	}
+	m := c.mapper.(*nsf)
+
+	want := NSFInfo{
+		Title:      "Game",
+		Artist:     "Artist",
+		Copyright:  "Copyright",
+		Tracks:     3,
+		StartTrack: 1,
+		TrackInfo: []NSFTrack{
+			{Label: "One", Length: time.Second, Fade: 500 * time.Millisecond},
+			{Label: "Two"},
+			{Label: "Three", Length: 2 * time.Second, Fade: nsfDefaultFade},
+		},
+		Playlist: []int{2, 0},
+	}
+	if !reflect.DeepEqual(m.info, want) {
+		t.Errorf("info = %+v, want %+v", m.info, want)
+	}
+	if m.initAddr != 0x8000 || m.playAddr != 0x8010 || m.cpuRead(0x8000) != 0x60 {
+		t.Errorf("init $%04X, play $%04X, want the INFO and DATA chunks", m.initAddr, m.playAddr)
+	}
+}
+
+func TestLoadNSFe_NSF2VRC7(t *testing.T) {
+	var rom []byte
+	rom = append(rom, nsfeMagic...)
+	rom = append(rom, nsfeChunk("INFO", 0x00, 0x80, 0x00, 0x80, 0x10, 0x80, 0, 0, 1, 0)...)
+	rom = append(rom, nsfeChunk("DATA", 0x60)...)
+	rom = append(rom, nsfeChunk("NSF2", 0x20)...)
+	rom = append(rom, nsfeChunk("VRC7", 0)...)
+	rom = append(rom, nsfeChunk("NEND")...)
+
+	c, err := loadNSF(rom)
+	if err != nil {
+		t.Fatalf("loadNSF() unexpected error %v", err)
+	}
+	m := c.mapper.(*nsf)
+
+	if m.chips&nsfVRC7 == 0 || !reflect.DeepEqual(m.info.ExpansionChips, []string{"VRC7"}) {
+		t.Errorf("chips = %v, want the VRC7", m.info.ExpansionChips)
+	}
+}
+
+func TestLoadNSFe_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks [][]byte
+	}{
+		{"no info", [][]byte{nsfeChunk("DATA", 0x60)}},
+		{"no data", [][]byte{nsfeChunk("INFO", 0, 0x80, 0, 0x80, 0, 0x80, 0, 0)}},
+		{"mandatory chunk", [][]byte{nsfeChunk("INFO", 0, 0x80, 0, 0x80, 0, 0x80, 0, 0), nsfeChunk("DATA", 0x60), nsfeChunk("WHAT")}},
+		{"truncated", [][]byte{nsfeChunk("INFO", 0, 0x80, 0, 0x80, 0, 0x80, 0, 0)[:12]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rom := append([]byte(nil), nsfeMagic...)
+			for _, c := range tt.chunks {
+				rom = append(rom, c...)
+			}
+			if _, err := loadNSF(rom); err == nil {
+				t.Errorf("loadNSF() expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadNSF2_Metadata(t *testing.T) {
+	rom := testNSF([8]byte{}, make([]byte, 0x100))
+	rom[5] = 2
+	rom[0x7D] = 0x00
+	rom[0x7E] = 0x01
+	rom = append(rom, nsfeChunk("tlbl", []byte("a\x00b\x00c")...)...)
+	rom = append(rom, nsfeChunk("time", int32Bytes(-1, 3000)...)...)
+
+	c, err := loadNSF(rom)
+	if err != nil {
+		t.Fatalf("loadNSF() unexpected error %v", err)
+	}
+	m := c.mapper.(*nsf)
+
+	if got := m.info.TrackInfo[2].Label; got != "c" {
+		t.Errorf("label = %q, want %q", got, "c")
+	}
+	if got := m.info.TrackInfo[1].Length; got != 3*time.Second {
+		t.Errorf("length = %v, want 3s", got)
+	}
+	if got := len(m.data); got != 0x100 {
+		t.Errorf("data is %d bytes, want the length in the header", got)
+	}
+}
+
+func TestNSF_Fade(t *testing.T) {
+	c, err := loadNSF(testNSF([8]byte{}, make([]byte, 0x100)))
+	if err != nil {
+		t.Fatalf("loadNSF() unexpected error %v", err)
+	}
+	m := c.mapper.(*nsf)
+	m.info.TrackInfo[m.track] = NSFTrack{Length: time.Second, Fade: time.Second}
+
+	tests := []struct {
+		at     time.Duration
+		volume float32
+		ended  bool
+	}{
+		{0, 1, false},
+		{time.Second, 1, false},
+		{1500 * time.Millisecond, 0.5, false},
+		{2 * time.Second, 0, true},
+	}
+	for _, tt := range tests {
+		m.cycles = int64(tt.at.Seconds() * cpuFreq)
+		if got := m.volume(); got < tt.volume-0.01 || got > tt.volume+0.01 {
+			t.Errorf("volume at %v = %v, want %v", tt.at, got, tt.volume)
+		}
+		if got := m.ended(); got != tt.ended {
+			t.Errorf("ended at %v = %v, want %v", tt.at, got, tt.ended)
+		}
+	}
+
+	m.startTrack(m.track)
+	if m.volume() != 1 || m.ended() {
+		t.Errorf("want the track restarted")
+	}
+}
+
+func TestCStrings(t *testing.T) {
+	got := cStrings([]byte("a\x00\x00bc\x00d"))
+	if want := []string{"a", "", "bc", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cStrings() = %q, want %q", got, want)
+	}
+	if got := cStrings([]byte{0}); !reflect.DeepEqual(got, []string{""}) {
+		t.Errorf("cStrings() = %q, want one empty string", got)
+	}
+}
@@ -0,0 +1,372 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	ipsMagic = []byte("PATCH")
+	upsMagic = []byte("UPS1")
+	bpsMagic = []byte("BPS1")
+
+	errPatchEOF    = errors.New("unexpected end of patch")
+	errPatchNumber = errors.New("number too big")
+	errPatchSize   = errors.New("target too big")
+)
+
+const (
+	// maxPatchNumber bounds the numbers read from UPS and BPS patches. It is
+	// well above any size or offset in a rom, and keeps them from overflowing.
+	maxPatchNumber = 1 << 30
+
+	// maxPatchTarget is the size of the biggest rom a patch can make, the
+	// largest PRG and CHR along with the header and a trainer.
+	maxPatchTarget = 16 + trainerLen + 2*maxROMSize
+)
+
+// patchExts are the extensions looked for when auto-detecting a patch next to
+// a rom.
+var patchExts = []string{".ips", ".ups", ".bps"}
+
+// findPatch returns the path of a patch with the same name as the rom, if
+// there is one.
+func findPatch(romPath string) string {
+	base := trimRomExt(romPath)
+	for _, ext := range patchExts {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+
+	return ""
+}
+
+func readPatch(path string, rom []byte) ([]byte, error) {
+	patch, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open patch: %s", err)
+	}
+
+	return applyPatch(rom, patch)
+}
+
+// applyPatch applies an IPS, UPS or BPS patch to rom, detecting the format by
+// its magic. UPS and BPS patches are rejected if the checksums don't match.
+func applyPatch(rom, patch []byte) ([]byte, error) {
+	var (
+		out []byte
+		err error
+	)
+
+	switch {
+	case bytes.HasPrefix(patch, ipsMagic):
+		out, err = applyIPS(rom, patch)
+		if err != nil {
+			return nil, fmt.Errorf("nes: invalid ips patch: %s", err)
+		}
+	case bytes.HasPrefix(patch, upsMagic):
+		out, err = applyUPS(rom, patch)
+		if err != nil {
+			return nil, fmt.Errorf("nes: invalid ups patch: %s", err)
+		}
+	case bytes.HasPrefix(patch, bpsMagic):
+		out, err = applyBPS(rom, patch)
+		if err != nil {
+			return nil, fmt.Errorf("nes: invalid bps patch: %s", err)
+		}
+	default:
+		return nil, errors.New("nes: unknown patch format")
+	}
+
+	return out, nil
+}
+
+// applyIPS applies an IPS patch. After the magic it is a list of records,
+// terminated by "EOF":
+//
+//	offset  3 bytes, big endian
+//	size    2 bytes, big endian
+//	data    size bytes
+//
+// A size of zero means the record is run-length encoded instead, followed by
+// a 2 byte run length and the byte to be repeated. Some patches append a 3
+// byte size to truncate the output to after the terminator.
+func applyIPS(rom, patch []byte) ([]byte, error) {
+	out := append([]byte(nil), rom...)
+	pos := len(ipsMagic)
+
+	read := func(n int) ([]byte, error) {
+		if pos+n > len(patch) {
+			return nil, errPatchEOF
+		}
+		b := patch[pos : pos+n]
+		pos += n
+		return b, nil
+	}
+
+	// grow makes sure out is big enough to hold end bytes
+	grow := func(end int) {
+		if end > len(out) {
+			out = append(out, make([]byte, end-len(out))...)
+		}
+	}
+
+	for {
+		b, err := read(3)
+		if err != nil {
+			return nil, err
+		}
+		if string(b) == "EOF" {
+			break
+		}
+		offset := int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+
+		b, err = read(2)
+		if err != nil {
+			return nil, err
+		}
+		size := int(binary.BigEndian.Uint16(b))
+
+		if size > 0 {
+			data, err := read(size)
+			if err != nil {
+				return nil, err
+			}
+			grow(offset + size)
+			copy(out[offset:], data)
+			continue
+		}
+
+		b, err = read(3)
+		if err != nil {
+			return nil, err
+		}
+		run := int(binary.BigEndian.Uint16(b))
+		grow(offset + run)
+		for i := 0; i < run; i++ {
+			out[offset+i] = b[2]
+		}
+	}
+
+	if b, err := read(3); err == nil {
+		size := int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+		if size < len(out) {
+			out = out[:size]
+		}
+	}
+
+	return out, nil
+}
+
+// beatReader reads the variable length integers used by UPS and BPS.
+type beatReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *beatReader) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errPatchEOF
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *beatReader) number() (int, error) {
+	var n, shift uint64 = 0, 1
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		n += uint64(b&0x7F) * shift
+		if n > maxPatchNumber {
+			return 0, errPatchNumber
+		}
+		if b&0x80 > 0 {
+			return int(n), nil
+		}
+		shift <<= 7
+		n += shift
+	}
+}
+
+// verifyFooter checks the 12 byte footer shared by UPS and BPS, the CRC32 of
+// the source, the target and the patch itself.
+func verifyFooter(patch, source []byte) (targetCRC uint32, err error) {
+	if len(patch) < 12 {
+		return 0, errPatchEOF
+	}
+	footer := patch[len(patch)-12:]
+
+	if got := crc32.ChecksumIEEE(patch[:len(patch)-4]); got != binary.LittleEndian.Uint32(footer[8:]) {
+		return 0, errors.New("patch checksum mismatch")
+	}
+	if got := crc32.ChecksumIEEE(source); got != binary.LittleEndian.Uint32(footer[0:]) {
+		return 0, errors.New("rom checksum mismatch, the patch is for a different rom")
+	}
+
+	return binary.LittleEndian.Uint32(footer[4:]), nil
+}
+
+// applyUPS applies a UPS patch: the source and target sizes followed by hunks
+// of a relative offset and bytes to XOR with the source, up to a zero.
+func applyUPS(rom, patch []byte) ([]byte, error) {
+	targetCRC, err := verifyFooter(patch, rom)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &beatReader{data: patch[:len(patch)-12], pos: len(upsMagic)}
+	if _, err := r.number(); err != nil {
+		return nil, err
+	}
+	targetSize, err := r.number()
+	if err != nil {
+		return nil, err
+	}
+	if targetSize > maxPatchTarget {
+		return nil, errPatchSize
+	}
+
+	out := make([]byte, targetSize)
+	copy(out, rom)
+
+	offset := 0
+	for r.pos < len(r.data) {
+		skip, err := r.number()
+		if err != nil {
+			return nil, err
+		}
+		offset += skip
+
+		for {
+			x, err := r.byte()
+			if err != nil {
+				return nil, err
+			}
+			if offset < len(out) {
+				out[offset] ^= x
+			}
+			offset++
+			if x == 0 {
+				break
+			}
+		}
+	}
+
+	if crc32.ChecksumIEEE(out) != targetCRC {
+		return nil, errors.New("output checksum mismatch")
+	}
+
+	return out, nil
+}
+
+// applyBPS applies a BPS patch: the source, target and metadata sizes, the
+// metadata and a list of actions that build the target by reading from the
+// source, the patch or what was already written.
+func applyBPS(rom, patch []byte) ([]byte, error) {
+	targetCRC, err := verifyFooter(patch, rom)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &beatReader{data: patch[:len(patch)-12], pos: len(bpsMagic)}
+	if _, err := r.number(); err != nil {
+		return nil, err
+	}
+	targetSize, err := r.number()
+	if err != nil {
+		return nil, err
+	}
+	if targetSize > maxPatchTarget {
+		return nil, errPatchSize
+	}
+	metadataSize, err := r.number()
+	if err != nil {
+		return nil, err
+	}
+	if metadataSize > len(r.data)-r.pos {
+		return nil, errPatchEOF
+	}
+	r.pos += metadataSize
+
+	out := make([]byte, targetSize)
+	var outPos, sourceRel, targetRel int
+
+	relative := func(base *int) error {
+		n, err := r.number()
+		if err != nil {
+			return err
+		}
+		if n&1 > 0 {
+			*base -= n >> 1
+		} else {
+			*base += n >> 1
+		}
+		return nil
+	}
+
+	for r.pos < len(r.data) {
+		n, err := r.number()
+		if err != nil {
+			return nil, err
+		}
+		action, length := n&3, n>>2+1
+
+		if length > len(out)-outPos {
+			return nil, errors.New("action writes past the end of the output")
+		}
+
+		switch action {
+		case 0: // source read
+			if outPos+length > len(rom) {
+				return nil, errors.New("source read past the end of the rom")
+			}
+			copy(out[outPos:], rom[outPos:outPos+length])
+			outPos += length
+		case 1: // target read
+			if r.pos+length > len(r.data) {
+				return nil, errPatchEOF
+			}
+			copy(out[outPos:], r.data[r.pos:r.pos+length])
+			r.pos += length
+			outPos += length
+		case 2: // source copy
+			if err := relative(&sourceRel); err != nil {
+				return nil, err
+			}
+			if sourceRel < 0 || sourceRel > len(rom)-length {
+				return nil, errors.New("source copy out of bounds")
+			}
+			copy(out[outPos:], rom[sourceRel:sourceRel+length])
+			sourceRel += length
+			outPos += length
+		case 3: // target copy, byte by byte since the ranges may overlap
+			if err := relative(&targetRel); err != nil {
+				return nil, err
+			}
+			if targetRel < 0 || targetRel >= outPos {
+				return nil, errors.New("target copy out of bounds")
+			}
+			for i := 0; i < length; i++ {
+				out[outPos] = out[targetRel]
+				outPos++
+				targetRel++
+			}
+		}
+	}
+
+	if crc32.ChecksumIEEE(out) != targetCRC {
+		return nil, errors.New("output checksum mismatch")
+	}
+
+	return out, nil
+}
@@ -0,0 +1,187 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func beatNumber(n int) []byte {
+	var out []byte
+	for {
+		x := byte(n & 0x7F)
+		n >>= 7
+		if n == 0 {
+			return append(out, 0x80|x)
+		}
+		out = append(out, x)
+		n--
+	}
+}
+
+func beatFooter(patch, source, target []byte) []byte {
+	crc := make([]byte, 4)
+	binary.LittleEndian.PutUint32(crc, crc32.ChecksumIEEE(source))
+	patch = append(patch, crc...)
+	binary.LittleEndian.PutUint32(crc, crc32.ChecksumIEEE(target))
+	patch = append(patch, crc...)
+	binary.LittleEndian.PutUint32(crc, crc32.ChecksumIEEE(patch))
+	return append(patch, crc...)
+}
+
+func TestApplyPatch(t *testing.T) {
+	source := []byte("the quick brown fox jumps over the lazy dog")
+	target := []byte("the quick RED fox jumps over the lazy dog!!!!")
+
+	ips := []byte("PATCH")
+	ips = append(ips, 0, 0, 10, 0, 3)
+	ips = append(ips, "RED"...)
+	ips = append(ips, 0, 0, 13, 0, 30) // the rest, shifted by the shorter word
+	ips = append(ips, " fox jumps over the lazy dog"...)
+	ips = append(ips, '!', '!')
+	ips = append(ips, 0, 0, 43, 0, 0, 0, 2, '!') // rle
+	ips = append(ips, "EOF"...)
+	ips = append(ips, 0, 0, byte(len(target))) // truncate
+
+	ups := []byte("UPS1")
+	ups = append(ups, beatNumber(len(source))...)
+	ups = append(ups, beatNumber(len(target))...)
+	ups = append(ups, beatNumber(10)...)
+	for i := 10; i < len(target); i++ {
+		var s byte
+		if i < len(source) {
+			s = source[i]
+		}
+		if x := s ^ target[i]; x != 0 {
+			ups = append(ups, x)
+		} else {
+			ups = append(ups, append([]byte{0}, beatNumber(0)...)...)
+		}
+	}
+	ups = append(ups, 0)
+	ups = beatFooter(ups, source, target)
+
+	bps := []byte("BPS1")
+	bps = append(bps, beatNumber(len(source))...)
+	bps = append(bps, beatNumber(len(target))...)
+	bps = append(bps, beatNumber(0)...)
+	bps = append(bps, beatNumber((10-1)<<2|0)...) // source read "the quick "
+	bps = append(bps, beatNumber((3-1)<<2|1)...)  // target read
+	bps = append(bps, "RED"...)
+	bps = append(bps, beatNumber((28-1)<<2|2)...) // source copy " fox ... dog"
+	bps = append(bps, beatNumber(15<<1)...)
+	bps = append(bps, beatNumber((1-1)<<2|1)...) // target read "!"
+	bps = append(bps, '!')
+	bps = append(bps, beatNumber((3-1)<<2|3)...) // target copy "!!!"
+	bps = append(bps, beatNumber((len(target)-4)<<1)...)
+	bps = beatFooter(bps, source, target)
+
+	tests := []struct {
+		name  string
+		patch []byte
+	}{
+		{"ips", ips},
+		{"ups", ups},
+		{"bps", bps},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyPatch(source, tt.patch)
+			if err != nil {
+				t.Fatalf("applyPatch() unexpected error %v", err)
+			}
+			if !bytes.Equal(got, target) {
+				t.Errorf("applyPatch() = %q, want %q", got, target)
+			}
+		})
+	}
+
+	t.Run("wrong rom", func(t *testing.T) {
+		for _, p := range [][]byte{ups, bps} {
+			_, err := applyPatch([]byte("some other rom"), p)
+			if err == nil || !strings.Contains(err.Error(), "checksum") {
+				t.Errorf("applyPatch() error = %v, want a checksum error", err)
+			}
+		}
+	})
+
+	t.Run("corrupt patch", func(t *testing.T) {
+		for _, p := range [][]byte{ups, bps} {
+			corrupt := append([]byte(nil), p...)
+			corrupt[6] ^= 0xFF
+			if _, err := applyPatch(source, corrupt); err == nil {
+				t.Errorf("applyPatch() expected an error for a corrupt patch")
+			}
+		}
+	})
+
+	t.Run("malformed bps", func(t *testing.T) {
+		overflow := []byte{0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x80}
+		cat := func(parts ...[]byte) []byte {
+			return bytes.Join(parts, nil)
+		}
+		size, empty := beatNumber(len(target)), beatNumber(0)
+
+		tests := []struct {
+			name string
+			body []byte // after the source size
+			want error
+		}{
+			{"target size overflow", cat(overflow, empty), errPatchNumber},
+			{"target size too big", cat(beatNumber(maxPatchTarget+1), empty), errPatchSize},
+			{"metadata size overflow", cat(size, overflow), errPatchNumber},
+			{"metadata past the end", cat(size, beatNumber(1<<20)), errPatchEOF},
+			{"length overflow", cat(size, empty, overflow), errPatchNumber},
+			{"source copy offset overflow", cat(size, empty, beatNumber(2), overflow), errPatchNumber},
+		}
+
+		for _, tt := range tests {
+			bps := cat([]byte("BPS1"), beatNumber(len(source)), tt.body)
+			_, err := applyPatch(source, beatFooter(bps, source, target))
+			if err == nil || !strings.HasSuffix(err.Error(), tt.want.Error()) {
+				t.Errorf("%s: applyPatch() error = %v, want %v", tt.name, err, tt.want)
+			}
+		}
+	})
+
+	t.Run("truncated ips", func(t *testing.T) {
+		if _, err := applyPatch(source, ips[:12]); err == nil {
+			t.Errorf("applyPatch() expected an error for a truncated patch")
+		}
+	})
+}
+
+func TestConsole_LoadPathPatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vnes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	romPath := writeTestRom(t, dir, 0)
+
+	// sets the vertical mirroring bit
+	ips := append([]byte("PATCH"), 0, 0, 6, 0, 1, 0x01)
+	ips = append(ips, "EOF"...)
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.ips"), ips, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.LoadPath(romPath); err != nil {
+		t.Fatalf("LoadPath() unexpected error %v", err)
+	}
+	if info, _ := console.CartridgeInfo(); !info.VerticalMirroring {
+		t.Errorf("patch next to the rom was not applied")
+	}
+
+	if err := console.LoadPathWithPatch(romPath, filepath.Join(dir, "missing.ips")); err == nil {
+		t.Errorf("LoadPathWithPatch() expected an error for a missing patch")
+	}
+}
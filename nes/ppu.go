@@ -300,69 +300,56 @@ type ppu struct {
 	lowAttrRegister  uint16
 	highAttrRegister uint16
 
+	spritePatternLo [8]byte
+	spritePatternHi [8]byte
+
 	sprite0Next bool
 	nmiSent     bool
 	suppressNMI bool
 
 	// buffer *image.RGBA
 	buffer []byte
+
+	// colors is the palette of the PPU, the RGB PPUs of the VS System and
+	// the PlayChoice-10 have their own. Some of them also swap PPUCTRL and
+	// PPUMASK and return an ID in the low bits of PPUSTATUS.
+	colors       *[64]color.RGBA
+	swapCtrlMask bool
+	statusID     byte
 }
 
 func newPpu() *ppu {
 	return &ppu{
 		buffer: make([]byte, 256*240*4),
+		colors: &palette,
 	}
 }
 
 func (p *ppu) spritePixel() (pixel, color, priority byte, spriteZero bool) {
-	// TODO: 16px sprites
-	outputX := byte(p.dot - 1)
+	outputX := p.dot - 1
 	if p.mask&showSprites == 0 || (outputX < 8 && p.mask&spriteClipping == 0) {
 		return 0, 0, 0, false
 	}
 
-	spriteHeight := uint16(p.spriteHeight())
-
 	for i := byte(0); i < p.spritesInRange; i++ {
-		y := p.secondaryOAMData[i*4] + 1 //TODO
-		pattern := uint16(p.secondaryOAMData[i*4+1])
 		attr := p.secondaryOAMData[i*4+2]
-		x := p.secondaryOAMData[i*4+3]
+		x := int(p.secondaryOAMData[i*4+3])
 
 		pal := attr & 0x03 << 2
 		priority := attr >> 5 & 0x01
 		flipX := attr>>6&0x01 > 0
-		flipY := attr>>7&0x01 > 0
 
 		if outputX < x || outputX > x+7 {
 			continue
 		}
 
-		patternTable := p.spriteTable(pattern)
-		patternY := uint16(p.scanline - int(y))
-		patternX := outputX - x
-
+		patternX := byte(outputX - x)
 		if !flipX {
 			patternX = 7 - patternX
 		}
 
-		if flipY {
-			patternY = spriteHeight - 1 - patternY
-		}
-
-		if patternY > 7 { // top sprite
-			patternY += 8
-		}
-
-		if spriteHeight == 16 {
-			pattern &= 0xFE
-		}
-
-		patternLo := p.read(patternTable + pattern*0x10 + patternY)
-		patternHi := p.read(patternTable + pattern*0x10 + patternY + 8)
-
-		pixLo := patternLo >> patternX & 0x01
-		pixHi := patternHi >> patternX & 0x01 << 1
+		pixLo := p.spritePatternLo[i] >> patternX & 0x01
+		pixHi := p.spritePatternHi[i] >> patternX & 0x01 << 1
 
 		pixel = pixLo | pixHi
 		color = pixel | 0x10 | pal
@@ -377,6 +364,52 @@ func (p *ppu) spritePixel() (pixel, color, priority byte, spriteZero bool) {
 	return 0, 0, 0, false
 }
 
+// Cycles 257-320: the tile data for the sprites on the next scanline is
+// fetched. Each sprite takes 8 cycles: two garbage nametable fetches followed
+// by the low and high pattern bytes. Unused slots still fetch tile $FF, which
+// is what lets boards like the MMC3 count scanlines by watching A12.
+func (p *ppu) fetchSprites() {
+	i := byte((p.dot - 257) / 8)
+
+	switch (p.dot - 257) % 8 {
+	case 1, 3:
+		// garbage nametable fetch
+		p.read(0x2000 | (p.v & 0x0FFF))
+	case 5:
+		p.spritePatternLo[i] = p.read(p.spritePatternAddress(i))
+	case 7:
+		p.spritePatternHi[i] = p.read(p.spritePatternAddress(i) + 8)
+	}
+}
+
+func (p *ppu) spritePatternAddress(i byte) uint16 {
+	if i >= p.spritesInRange {
+		return p.spriteTable(0xFF) + 0xFF*0x10
+	}
+
+	y := p.secondaryOAMData[i*4]
+	pattern := uint16(p.secondaryOAMData[i*4+1])
+	attr := p.secondaryOAMData[i*4+2]
+
+	spriteHeight := uint16(p.spriteHeight())
+	patternTable := p.spriteTable(pattern)
+	patternY := uint16(p.scanline - int(y))
+
+	if attr>>7&0x01 > 0 { // flip y
+		patternY = spriteHeight - 1 - patternY
+	}
+
+	if spriteHeight == 16 {
+		pattern &= 0xFE
+	}
+
+	if patternY > 7 { // bottom half of 8x16 sprites
+		patternY += 8
+	}
+
+	return patternTable + pattern*0x10 + patternY
+}
+
 func (p *ppu) bgPixel() (pixel, color byte) {
 	x := p.dot - 1
 
@@ -434,7 +467,7 @@ func (p *ppu) render() {
 
 	paletteIdx := p.readPalette(uint16(col))
 	// p.buffer.SetRGBA(p.dot-1, p.scanline, palette[paletteIdx])
-	c := palette[paletteIdx]
+	c := p.colors[paletteIdx]
 	pos := p.scanline*256*4 + (p.dot-1)*4
 	p.buffer[pos+0] = c.R
 	p.buffer[pos+1] = c.G
@@ -451,6 +484,7 @@ func (p *ppu) tick(cpu *cpu) {
 	opFrame := preRender || visibleFrame
 	doOp := renderingEnabled && opFrame
 	fetchDot := visibleDot || invisibleDot
+	spriteFetchDot := p.dot > 256 && p.dot < 321
 	shiftDot := (p.dot > 0 && p.dot < 257) || (p.dot > 320 && p.dot < 337)
 
 	// render
@@ -481,6 +515,14 @@ func (p *ppu) tick(cpu *cpu) {
 			// load attribute address
 			p.addressBus = 0x23C0 | (p.v & 0x0C00) | ((p.v >> 4) & 0x38) | ((p.v >> 2) & 0x07)
 		case 3:
+			if p.dot == 340 {
+				// the last two fetches of a line are both unused nametable
+				// fetches, the MMC5 detects scanlines by seeing the same
+				// address three times in a row
+				p.read(0x2000 | (p.v & 0x0FFF))
+				break
+			}
+
 			// fetch attribute byte
 
 			// The quadrant is composed of GB and can be either 0, 1, 2 or 3.
@@ -518,6 +560,10 @@ func (p *ppu) tick(cpu *cpu) {
 		}
 	}
 
+	if doOp && spriteFetchDot {
+		p.fetchSprites()
+	}
+
 	// update
 	switch {
 	case doOp && p.dot == 256:
@@ -631,6 +677,9 @@ func (p *ppu) readPort(address uint16, c *cpu) byte {
 	switch address {
 	case ppuStatusAddr: // $2002
 		result := p.registerBus&0x1F | byte(p.status)
+		if p.statusID != 0 {
+			result = result&0xC0 | p.statusID
+		}
 		p.status &^= verticalBlank
 
 		if p.scanline == 241 && p.dot <= 2 {
@@ -678,6 +727,9 @@ func (p *ppu) writePort(address uint16, value byte, cpu *cpu) {
 	if address < 0x4000 {
 		address = 0x2000 + address%0x08
 	}
+	if p.swapCtrlMask && (address == ppuCtrlAddr || address == ppuMaskAddr) {
+		address ^= 0x01
+	}
 	p.registerBus = value
 
 	switch address {
@@ -746,6 +798,10 @@ func (p *ppu) writePort(address uint16, value byte, cpu *cpu) {
 			p.t = p.t&0xFF00 | d
 			p.v = p.t
 			p.w = 0
+
+			if p.cartridge != nil {
+				p.cartridge.mapper.ppuAddress(p.v & 0x3FFF)
+			}
 		}
 
 	case ppuDataAddr: // $2007
@@ -763,6 +819,15 @@ func (p *ppu) writePort(address uint16, value byte, cpu *cpu) {
 }
 
 func (p *ppu) read(address uint16) byte {
+	address %= 0x4000
+	p.cartridge.mapper.ppuAddress(address)
+
+	return p.peek(address)
+}
+
+// peek reads from the ppu memory without the cartridge noticing, the debug
+// views use it so they don't disturb boards that watch the address bus.
+func (p *ppu) peek(address uint16) byte {
 	address %= 0x4000
 	switch {
 	case address < 0x2000:
@@ -781,6 +846,8 @@ func (p *ppu) read(address uint16) byte {
 
 func (p *ppu) write(address uint16, value byte) {
 	address %= 0x4000
+	p.cartridge.mapper.ppuAddress(address)
+
 	switch {
 	case address < 0x2000:
 		p.cartridge.write(address, value)
@@ -819,42 +886,48 @@ func (p *ppu) writePalette(address uint16, value byte) {
 }
 
 func (p *ppu) readNametable(addr uint16) byte {
-	switch p.cartridge.mirrorMode {
-	case horizontal:
-		if addr < 0x2800 {
-			return p.nametable0[addr%1024]
-		} else {
-			return p.nametable2[addr%1024]
-		}
-	case vertical:
-		if addr < 0x2400 || (addr >= 0x2800 && addr < 0x2C00) {
-			return p.nametable0[addr%1024]
-		} else {
-			return p.nametable1[addr%1024]
-		}
+	if m := p.cartridge.nametables; m != nil {
+		return m.readNametable(addr, [2]*[1024]byte{&p.nametable0, &p.nametable1})
 	}
 
-	return 0
+	return p.nametable(addr)[addr%1024]
 }
 
 func (p *ppu) writeNametable(addr uint16, val byte) {
-	switch p.cartridge.mirrorMode {
+	if m := p.cartridge.nametables; m != nil {
+		m.writeNametable(addr, val, [2]*[1024]byte{&p.nametable0, &p.nametable1})
+		return
+	}
+
+	p.nametable(addr)[addr%1024] = val
+}
+
+// nametable returns the 1K of VRAM that addr is mapped to. The console only
+// has 2K of it, nametable0 and nametable1, the other two are only used by
+// four-screen boards, which bring their own.
+func (p *ppu) nametable(addr uint16) *[1024]byte {
+	table := (addr - 0x2000) / 1024 % 4
+
+	switch p.cartridge.mapper.mirrorMode() {
 	case horizontal:
-		if addr < 0x2800 {
-			p.nametable0[addr%1024] = val
-			p.nametable1[addr%1024] = val
-		} else {
-			p.nametable2[addr%1024] = val
-			p.nametable3[addr%1024] = val
-		}
+		table /= 2
 	case vertical:
-		if addr < 0x2400 {
-			p.nametable0[addr%1024] = val
-			p.nametable2[addr%1024] = val
-		} else {
-			p.nametable1[addr%1024] = val
-			p.nametable3[addr%1024] = val
-		}
+		table %= 2
+	case singleScreenLow:
+		table = 0
+	case singleScreenHigh:
+		table = 1
+	}
+
+	switch table {
+	case 0:
+		return &p.nametable0
+	case 1:
+		return &p.nametable1
+	case 2:
+		return &p.nametable2
+	default:
+		return &p.nametable3
 	}
 }
 
@@ -974,8 +1047,8 @@ func (p *ppu) drawPatternTables(buf []byte, paletteNum byte) {
 				fineX := tile * 8
 				patternNum := uint16(coarseY*16 + tile)
 
-				patternLo := p.read(table + patternNum*16 + fineY)
-				patternHi := p.read(table + patternNum*16 + fineY + 8)
+				patternLo := p.peek(table + patternNum*16 + fineY)
+				patternHi := p.peek(table + patternNum*16 + fineY + 8)
 
 				for pixel := 0; pixel < 8; pixel++ {
 					pixello := patternLo & 0x80 >> 7
@@ -985,7 +1058,7 @@ func (p *ppu) drawPatternTables(buf []byte, paletteNum byte) {
 					paletteIndex := p.paletteData[attr|pixello|pixelhi]
 					// buf.SetRGBA(xoffset+fineX+pixel, y, palette[paletteIndex])
 					pos := y*128*2*4 + (xoffset+fineX+pixel)*4
-					c := palette[paletteIndex]
+					c := p.colors[paletteIndex]
 					buf[pos+0] = c.R
 					buf[pos+1] = c.G
 					buf[pos+2] = c.B
@@ -1015,12 +1088,12 @@ func (p *ppu) drawNametables(buf []byte) {
 				nametableAddr := tileY*32 + tile
 				tileX := tile * 8
 
-				patternNum := uint16(p.read(nametable + nametableAddr))
+				patternNum := uint16(p.peek(nametable + nametableAddr))
 
-				patternLo := p.read(patternTable + patternNum*16 + patternY)
-				patternHi := p.read(patternTable + patternNum*16 + patternY + 8)
+				patternLo := p.peek(patternTable + patternNum*16 + patternY)
+				patternHi := p.peek(patternTable + patternNum*16 + patternY + 8)
 
-				attribute := p.read(nametable + 960 + (tileY/4)*8 + tile/4)
+				attribute := p.peek(nametable + 960 + (tileY/4)*8 + tile/4)
 
 				top := tileY%4/2 == 0
 				bot := tileY%4/2 == 1
@@ -1045,7 +1118,7 @@ func (p *ppu) drawNametables(buf []byte) {
 					color := p.paletteData[attribute|pixello|pixelhi]
 
 					pos := int(offsetY+y)*256*2*4 + int(offsetX+tileX+pixel)*4
-					c := palette[color]
+					c := p.colors[color]
 					buf[pos+0] = c.R
 					buf[pos+1] = c.G
 					buf[pos+2] = c.B
@@ -1109,8 +1182,8 @@ func (p *ppu) debugDumpSprites() {
 			patternTable = 0x0000
 		}
 
-		patternLo := p.read(patternTable + patternNum*16 + row)
-		patternHi := p.read(patternTable + patternNum*16 + row + 8)
+		patternLo := p.peek(patternTable + patternNum*16 + row)
+		patternHi := p.peek(patternTable + patternNum*16 + row + 8)
 
 		for col := 0; col < 8; col++ {
 			var pixello, pixelhi byte
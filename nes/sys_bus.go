@@ -37,6 +37,7 @@ type sysBus struct {
 	ppu       *ppu
 	ctrl1     *controller
 	ctrl2     *controller
+	vs        *vsSystem // nil unless a VS System game is loaded
 }
 
 func (bus *sysBus) read(address uint16) byte {
@@ -53,10 +54,16 @@ func (bus *sysBus) read(address uint16) byte {
 	}
 
 	if address == 0x4016 {
+		if bus.vs != nil {
+			return bus.vs.read4016(bus.ctrl1, bus.ctrl2)
+		}
 		return byte(bus.ctrl1.read())
 	}
 
 	if address == 0x4017 {
+		if bus.vs != nil {
+			return bus.vs.read4017(bus.ctrl1, bus.ctrl2)
+		}
 		return byte(bus.ctrl2.read())
 	}
 
@@ -68,14 +75,6 @@ func (bus *sysBus) read(address uint16) byte {
 		return 0xFF //TODO io registers
 	}
 
-	if address < 0x6000 {
-		return 0 //TODO exp rom
-	}
-
-	if address < 0x8000 {
-		return 0 //TODO sram
-	}
-
 	if address <= 0xFFFF {
 		return bus.cartridge.read(address)
 	}
@@ -91,6 +90,9 @@ func (bus *sysBus) write(address uint16, v byte) {
 
 	if address < 0x4000 {
 		bus.ppu.writePort(address, v, bus.cpu)
+		if bus.cartridge != nil {
+			bus.cartridge.ppuRegisterWrite(address, v)
+		}
 		return
 	}
 
@@ -107,24 +109,19 @@ func (bus *sysBus) write(address uint16, v byte) {
 	if address == 0x4016 {
 		bus.ctrl1.write(v)
 		bus.ctrl2.write(v)
+		if bus.cartridge != nil {
+			bus.cartridge.controllerPortWrite(v)
+		}
 		return
 	}
 
-	if address < 0x6000 {
-		//TODO: ExpROM
-		return
-	}
-
-	if address < 0x8000 {
-		//TODO: SRAM
+	if address < 0x4020 {
 		return
 	}
 
 	if address <= 0xFFFF {
 		bus.cartridge.write(address, v)
 		return
-		// bus.PrgROM[int(address-0x8000)%len(bus.PrgROM)] = v
-		// return
 	}
 }
 
@@ -0,0 +1,237 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const unifHeaderLen = 32
+
+var (
+	unifMagic = []byte{'U', 'N', 'I', 'F'}
+
+	errUNIFNoBoard = errors.New("nes: unif: missing MAPR chunk")
+	errUNIFNoPRG   = errors.New("nes: unif: missing PRG chunks")
+)
+
+// unifBoard is what a UNIF board name tells about the cartridge, the mapper
+// that implements it and how much PRG-RAM it has, 0 for the default.
+type unifBoard struct {
+	mapper uint16
+	prgRAM int
+}
+
+// unifBoards maps UNIF board names, without the NES-, HVC-, UNL-, BTL- or
+// BMC- prefix, to the board.
+var unifBoards = map[string]unifBoard{
+	"NROM": {0, 0}, "NROM-128": {0, 0}, "NROM-256": {0, 0}, "RROM": {0, 0}, "RROM-128": {0, 0},
+
+	"SAROM": {1, 8192}, "SBROM": {1, 0}, "SCROM": {1, 0}, "SC1ROM": {1, 0}, "SEROM": {1, 0},
+	"SFROM": {1, 0}, "SGROM": {1, 0}, "SHROM": {1, 0}, "SH1ROM": {1, 0}, "SJROM": {1, 8192},
+	"SKROM": {1, 8192}, "SLROM": {1, 0}, "SL1ROM": {1, 0}, "SL2ROM": {1, 0}, "SL3ROM": {1, 0},
+	"SLRROM": {1, 0}, "SNROM": {1, 8192}, "SOROM": {1, 16384}, "SUROM": {1, 8192},
+	"SXROM": {1, 32768},
+
+	"UNROM": {2, 0}, "UOROM": {2, 0},
+
+	"CNROM": {3, 0},
+
+	"TBROM": {4, 0}, "TEROM": {4, 0}, "TFROM": {4, 0}, "TGROM": {4, 0}, "TKROM": {4, 8192},
+	"TK1ROM": {4, 8192}, "TLROM": {4, 0}, "TL1ROM": {4, 0}, "TL2ROM": {4, 0}, "TNROM": {4, 8192},
+	"TR1ROM": {4, 0}, "TSROM": {4, 8192}, "TVROM": {4, 0}, "HKROM": {4, 1024},
+
+	"EKROM": {5, 8192}, "ELROM": {5, 0}, "ETROM": {5, 16384}, "EWROM": {5, 32768},
+
+	"AMROM": {7, 0}, "ANROM": {7, 0}, "AN1ROM": {7, 0}, "AOROM": {7, 0},
+
+	"PNROM": {9, 0}, "PEEOROM": {9, 0},
+
+	"FJROM": {10, 8192}, "FKROM": {10, 8192},
+
+	"BNROM": {34, 0},
+
+	"GNROM": {66, 0}, "MHROM": {66, 0},
+
+	"BTR": {69, 8192}, "JLROM": {69, 0}, "JSROM": {69, 8192},
+}
+
+// unifControllers maps the bits of the CTRL chunk to NES 2.0 expansion
+// devices, the first one set wins.
+var unifControllers = []struct {
+	bit    byte
+	device byte
+}{
+	{0x02, 0x08}, // Zapper
+	{0x04, 0x1F}, // R.O.B.
+	{0x08, 0x0F}, // Arkanoid controller
+	{0x10, 0x0B}, // Power Pad
+	{0x20, 0x02}, // Four Score
+	{0x01, 0x01}, // standard controllers
+}
+
+// parseUNIF reads a UNIF rom, r is positioned right after the magic.
+//
+// The header is followed by chunks of a 4 byte ID, a little endian 32 bit
+// length and the data. The PRG and CHR ROMs are split in up to 16 chunks
+// each, PRG0-PRGF and CHR0-CHRF, that are concatenated in order.
+func parseUNIF(r io.Reader) (*romFile, error) {
+	if _, err := io.CopyN(ioutil.Discard, r, unifHeaderLen-int64(len(unifMagic))); err != nil {
+		return nil, fmt.Errorf("nes: unif: unable to read header: %s", err)
+	}
+
+	var (
+		board      string
+		prgChunks  [16][]byte
+		chrChunks  [16][]byte
+		mirroring  = byte(5)
+		vrorChunk  bool
+		info       = CartridgeInfo{Format: UNIF}
+		chunkID    [4]byte
+		chunkLen   uint32
+		chunkCount int
+	)
+
+	for {
+		if err := binary.Read(r, binary.LittleEndian, &chunkID); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("nes: unif: unable to read chunk %d: %s", chunkCount, err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunkLen); err != nil {
+			return nil, fmt.Errorf("nes: unif: unable to read chunk %s: %s", chunkID[:], err)
+		}
+
+		// don't trust the length for the allocation, corrupt files would
+		// make us allocate up to 4G
+		data, err := ioutil.ReadAll(io.LimitReader(r, int64(chunkLen)))
+		if err == nil && len(data) < int(chunkLen) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("nes: unif: unable to read chunk %s: %s", chunkID[:], err)
+		}
+		chunkCount++
+
+		id := string(chunkID[:])
+		switch {
+		case id == "MAPR":
+			board = cString(data)
+		case id == "NAME":
+			info.Title = cString(data)
+		case id == "MIRR" && len(data) > 0:
+			mirroring = data[0]
+		case id == "BATR":
+			info.Battery = true
+		case id == "VROR":
+			vrorChunk = true
+		case id == "TVCI" && len(data) > 0:
+			switch data[0] {
+			case 1:
+				info.Timing = PAL
+			case 2:
+				info.Timing = MultiRegion
+			}
+		case id == "CTRL" && len(data) > 0:
+			for _, c := range unifControllers {
+				if data[0]&c.bit > 0 {
+					info.ExpansionDevice = c.device
+					break
+				}
+			}
+		case strings.HasPrefix(id, "PRG"):
+			if i, ok := hexDigit(id[3]); ok {
+				prgChunks[i] = data
+			}
+		case strings.HasPrefix(id, "CHR"):
+			if i, ok := hexDigit(id[3]); ok {
+				chrChunks[i] = data
+			}
+		}
+	}
+
+	if board == "" {
+		return nil, errUNIFNoBoard
+	}
+	b, ok := unifBoards[unifBoardName(board)]
+	if !ok {
+		return nil, fmt.Errorf("nes: unif: unsupported board %s", board)
+	}
+	info.Mapper = b.mapper
+	if info.Battery {
+		info.PRGNVRAMSize = b.prgRAM
+	} else {
+		info.PRGRAMSize = b.prgRAM
+	}
+
+	prg := bytes.Join(prgChunks[:], nil)
+	if len(prg) == 0 {
+		return nil, errUNIFNoPRG
+	}
+	chr := bytes.Join(chrChunks[:], nil)
+	info.PRGROMSize = len(prg)
+	info.CHRROMSize = len(chr)
+
+	chrRAM := len(chr) == 0 || vrorChunk
+	if chrRAM {
+		if len(chr) < chrMul {
+			chr = append(chr, make([]byte, chrMul-len(chr))...)
+		}
+		info.CHRROMSize = 0
+		info.CHRRAMSize = len(chr)
+	}
+
+	mirrorMode := horizontal
+	switch mirroring {
+	case 1:
+		info.VerticalMirroring = true
+		mirrorMode = vertical
+	case 2:
+		mirrorMode = singleScreenLow
+	case 3:
+		mirrorMode = singleScreenHigh
+	case 4:
+		info.FourScreen = true
+		mirrorMode = quad
+	}
+
+	return &romFile{
+		info:       info,
+		mirrorMode: mirrorMode,
+		prg:        prg,
+		chr:        chr,
+		chrRAM:     chrRAM,
+	}, nil
+}
+
+// unifBoardName strips the manufacturer prefix of a board name.
+func unifBoardName(board string) string {
+	for _, prefix := range []string{"NES-", "HVC-", "UNL-", "BTL-", "BMC-"} {
+		if strings.HasPrefix(board, prefix) {
+			return board[len(prefix):]
+		}
+	}
+	return board
+}
+
+// cString returns the contents of a NUL terminated string.
+func cString(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
+
+func hexDigit(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10, true
+	}
+	return 0, false
+}
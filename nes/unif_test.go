@@ -0,0 +1,162 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+type unifChunk struct {
+	id   string
+	data []byte
+}
+
+func testUNIF(chunks ...unifChunk) []byte {
+	rom := append([]byte{}, unifMagic...)
+	rom = append(rom, 7, 0, 0, 0) // revision
+	rom = append(rom, make([]byte, unifHeaderLen-len(rom))...)
+
+	for _, c := range chunks {
+		rom = append(rom, c.id...)
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(c.data)))
+		rom = append(rom, length[:]...)
+		rom = append(rom, c.data...)
+	}
+	return rom
+}
+
+func TestLoadUNIF(t *testing.T) {
+	prg0 := bytes.Repeat([]byte{0x01}, prgMul)
+	prg1 := bytes.Repeat([]byte{0x02}, prgMul)
+	chr0 := bytes.Repeat([]byte{0x03}, chrMul)
+
+	rom := testUNIF(
+		unifChunk{"MAPR", []byte("NES-SNROM\x00")},
+		unifChunk{"NAME", []byte("Test\x00")},
+		unifChunk{"PRG1", prg1}, // out of order on purpose
+		unifChunk{"PRG0", prg0},
+		unifChunk{"CHR0", chr0},
+		unifChunk{"MIRR", []byte{1}},
+		unifChunk{"BATR", []byte{1}},
+		unifChunk{"TVCI", []byte{1}},
+		unifChunk{"CTRL", []byte{0x03}},
+		unifChunk{"DINF", make([]byte, 204)}, // ignored
+	)
+
+	c, err := loadRom(bytes.NewReader(rom))
+	if err != nil {
+		t.Fatalf("loadRom() unexpected error %v", err)
+	}
+
+	want := CartridgeInfo{
+		Format:            UNIF,
+		Title:             "Test",
+		Mapper:            1,
+		PRGROMSize:        2 * prgMul,
+		CHRROMSize:        chrMul,
+		VerticalMirroring: true,
+		PRGNVRAMSize:      8192,
+		Battery:           true,
+		Timing:            PAL,
+		ExpansionDevice:   0x08,
+	}
+	if c.info != want {
+		t.Errorf("info = %+v, want %+v", c.info, want)
+	}
+	if c.prg[0] != 0x01 || c.prg[prgMul] != 0x02 {
+		t.Errorf("PRG chunks were not concatenated in order")
+	}
+	if c.chrRAM || c.chr[0] != 0x03 {
+		t.Errorf("chr = CHR-ROM with the CHR0 chunk, got ram %v", c.chrRAM)
+	}
+	if !c.saveRAM || c.mirrorMode != vertical {
+		t.Errorf("saveRAM = %v, mirror = %v", c.saveRAM, c.mirrorMode)
+	}
+	if _, ok := c.mapper.(*mmc1); !ok {
+		t.Errorf("mapper = %T, want *mmc1", c.mapper)
+	}
+}
+
+func TestLoadUNIF_CHRRAM(t *testing.T) {
+	prg := make([]byte, 2*prgMul)
+
+	c, err := loadRom(bytes.NewReader(testUNIF(
+		unifChunk{"MAPR", []byte("UNL-UNROM")},
+		unifChunk{"PRG0", prg},
+		unifChunk{"MIRR", []byte{3}},
+	)))
+	if err != nil {
+		t.Fatalf("loadRom() unexpected error %v", err)
+	}
+	if !c.chrRAM || len(c.chr) != chrMul {
+		t.Errorf("chr: ram %v, %d bytes, want 8K of ram", c.chrRAM, len(c.chr))
+	}
+	if c.mirrorMode != singleScreenHigh {
+		t.Errorf("mirror = %v, want single screen high", c.mirrorMode)
+	}
+
+	// VROR makes the CHR chunks writable
+	c, err = loadRom(bytes.NewReader(testUNIF(
+		unifChunk{"MAPR", []byte("NES-NROM-256")},
+		unifChunk{"PRG0", prg},
+		unifChunk{"CHR0", make([]byte, chrMul)},
+		unifChunk{"VROR", nil},
+	)))
+	if err != nil {
+		t.Fatalf("loadRom() unexpected error %v", err)
+	}
+	c.write(0x0010, 0x42)
+	if got := c.read(0x0010); got != 0x42 {
+		t.Errorf("VROR: chr $0010 = %02X, want 42", got)
+	}
+}
+
+func TestLoadUNIF_PRGRAM(t *testing.T) {
+	tests := []struct {
+		board string
+		want  int
+	}{
+		{"NES-NROM-256", sramSize},
+		{"NES-SOROM", 16 * 1024},
+		{"NES-SXROM", 32 * 1024},
+		{"NES-ETROM", 16 * 1024},
+		{"NES-EWROM", 32 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.board, func(t *testing.T) {
+			c, err := loadRom(bytes.NewReader(testUNIF(
+				unifChunk{"MAPR", []byte(tt.board)},
+				unifChunk{"PRG0", make([]byte, 2*prgMul)},
+			)))
+			if err != nil {
+				t.Fatalf("loadRom() unexpected error %v", err)
+			}
+			if got := len(c.prgRAM); got != tt.want {
+				t.Errorf("PRG-RAM is %d bytes, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadUNIF_Errors(t *testing.T) {
+	prg := unifChunk{"PRG0", make([]byte, prgMul)}
+
+	tests := []struct {
+		name string
+		rom  []byte
+	}{
+		{"no board", testUNIF(prg)},
+		{"unknown board", testUNIF(unifChunk{"MAPR", []byte("UNL-NOPE")}, prg)},
+		{"no prg", testUNIF(unifChunk{"MAPR", []byte("NES-NROM")})},
+		{"truncated header", testUNIF()[:10]},
+		{"truncated chunk", testUNIF(unifChunk{"MAPR", []byte("NES-NROM")}, prg)[:100]},
+	}
+
+	for _, tt := range tests {
+		if _, err := loadRom(bytes.NewReader(tt.rom)); err == nil {
+			t.Errorf("%s: loadRom() expected an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package nes
+
+// VRC2 and VRC4 (mappers 21, 22, 23 and 25) are Konami boards with two
+// switchable 8K PRG banks and eight 1K CHR banks. The chips only look at two
+// address lines to pick a register within each $1000 block, and every board
+// revision wires different ones:
+//
+//	mapper  submapper  board  lines
+//	21      1          VRC4a  A1, A2
+//	21      2          VRC4c  A6, A7
+//	22      0          VRC2a  A1, A0
+//	23      1          VRC4f  A0, A1
+//	23      2          VRC4e  A2, A3
+//	23      3          VRC2b  A0, A1
+//	25      1          VRC4b  A1, A0
+//	25      2          VRC4d  A3, A2
+//	25      3          VRC2c  A1, A0
+//
+// Without a submapper both wirings of the mapper are decoded at once, which
+// works since games only ever write to the addresses of their own.
+//
+// Registers, with the two lines as the low bits of the address:
+//
+//	$8000-$8003 PRG bank at $8000 ($C000 in swap mode)
+//	$9000-$9001 Mirroring (VRC2: 0 vertical, 1 horizontal; VRC4 adds
+//	            2 one-screen low, 3 one-screen high)
+//	$9002-$9003 VRC4 PRG swap mode (bit 1)
+//	$A000-$A003 PRG bank at $A000
+//	$B000-$E003 CHR banks, low and high nibble of each of the eight
+//	$F000-$F003 VRC4 IRQ latch low and high nibble, control and acknowledge
+//
+// The second last bank is fixed at $C000 ($8000 in swap mode), and the last
+// one at $E000. VRC2a ignores the low bit of the CHR banks.
+type vrc24 struct {
+	cart *cartridge
+	vrc2 bool
+
+	a0, a1   uint16 // address lines used as register bits 0 and 1
+	chrShift uint
+
+	prgBanks   [2]byte
+	swapMode   bool
+	chrBanks   [8]int
+	mirroring  byte
+	irqCounter vrcIRQ
+
+	prgOffsets [4]int
+	chrOffsets [8]int
+}
+
+func newVRC24(c *cartridge) Mapper {
+	m := &vrc24{cart: c}
+
+	lines := map[uint16]map[byte][2]uint16{
+		21: {0: {0x42, 0x84}, 1: {0x02, 0x04}, 2: {0x40, 0x80}},
+		22: {0: {0x02, 0x01}},
+		23: {0: {0x05, 0x0A}, 1: {0x01, 0x02}, 2: {0x04, 0x08}, 3: {0x01, 0x02}},
+		25: {0: {0x0A, 0x05}, 1: {0x02, 0x01}, 2: {0x08, 0x04}, 3: {0x02, 0x01}},
+	}[c.mapperNum]
+
+	l, ok := lines[c.info.Submapper]
+	if !ok {
+		l = lines[0]
+	}
+	m.a0, m.a1 = l[0], l[1]
+
+	switch {
+	case c.mapperNum == 22:
+		m.vrc2 = true
+		m.chrShift = 1
+	case (c.mapperNum == 23 || c.mapperNum == 25) && c.info.Submapper == 3:
+		m.vrc2 = true
+	}
+
+	m.updateOffsets()
+	return m
+}
+
+// register translates address to $x000-$x003 as the chip sees it.
+func (m *vrc24) register(address uint16) uint16 {
+	reg := address & 0xF000
+	if address&m.a0 > 0 {
+		reg |= 1
+	}
+	if address&m.a1 > 0 {
+		reg |= 2
+	}
+	return reg
+}
+
+func (m *vrc24) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0x8000:
+		slot := (address - 0x8000) / 0x2000
+		return m.cart.prg[m.prgOffsets[slot]+int(address%0x2000)]
+	case address >= 0x6000:
+		return m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)]
+	}
+
+	return 0
+}
+
+func (m *vrc24) cpuWrite(address uint16, value byte) {
+	switch {
+	case address >= 0x8000:
+		m.writeRegister(m.register(address), value)
+	case address >= 0x6000:
+		m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)] = value
+	}
+}
+
+func (m *vrc24) writeRegister(reg uint16, value byte) {
+	switch {
+	case reg <= 0x8003:
+		m.prgBanks[0] = value & 0x1F
+	case reg <= 0x9001:
+		m.mirroring = value & 0x03
+		if m.vrc2 {
+			m.mirroring &= 0x01
+		}
+	case reg <= 0x9003:
+		if !m.vrc2 {
+			m.swapMode = value&0x02 > 0
+		}
+	case reg <= 0xA003:
+		m.prgBanks[1] = value & 0x1F
+	case reg <= 0xE003:
+		bank := int(reg-0xB000)/0x1000*2 + int(reg&0x03)/2
+		if reg&1 == 0 {
+			m.chrBanks[bank] = m.chrBanks[bank]&0x1F0 | int(value&0x0F)
+		} else {
+			m.chrBanks[bank] = m.chrBanks[bank]&0x00F | int(value&0x1F)<<4
+		}
+	default:
+		if m.vrc2 {
+			return
+		}
+		switch reg & 0x03 {
+		case 0:
+			m.irqCounter.latch = m.irqCounter.latch&0xF0 | value&0x0F
+		case 1:
+			m.irqCounter.latch = m.irqCounter.latch&0x0F | value<<4
+		case 2:
+			m.irqCounter.writeControl(value)
+		case 3:
+			m.irqCounter.acknowledge()
+		}
+	}
+
+	m.updateOffsets()
+}
+
+func (m *vrc24) updateOffsets() {
+	secondLast := bankOffset(m.cart.prg, -2, 0x2000)
+	bank0 := bankOffset(m.cart.prg, int(m.prgBanks[0]), 0x2000)
+
+	if m.swapMode {
+		m.prgOffsets[0] = secondLast
+		m.prgOffsets[2] = bank0
+	} else {
+		m.prgOffsets[0] = bank0
+		m.prgOffsets[2] = secondLast
+	}
+	m.prgOffsets[1] = bankOffset(m.cart.prg, int(m.prgBanks[1]), 0x2000)
+	m.prgOffsets[3] = bankOffset(m.cart.prg, -1, 0x2000)
+
+	for i, bank := range m.chrBanks {
+		m.chrOffsets[i] = bankOffset(m.cart.chr, bank>>m.chrShift, 0x0400)
+	}
+}
+
+func (m *vrc24) ppuRead(address uint16) byte {
+	return m.cart.chr[m.chrOffsets[address/0x0400]+int(address%0x0400)]
+}
+
+func (m *vrc24) ppuWrite(address uint16, value byte) {
+	if m.cart.chrRAM {
+		m.cart.chr[m.chrOffsets[address/0x0400]+int(address%0x0400)] = value
+	}
+}
+
+func (m *vrc24) mirrorMode() mirrorMode {
+	switch m.mirroring {
+	case 0:
+		return vertical
+	case 1:
+		return horizontal
+	case 2:
+		return singleScreenLow
+	default:
+		return singleScreenHigh
+	}
+}
+
+func (m *vrc24) irq() bool                 { return m.irqCounter.pending }
+func (m *vrc24) ppuAddress(address uint16) {}
+func (m *vrc24) clock()                    { m.irqCounter.clock() }
+
+// vrcIRQ is the IRQ counter shared by the VRC4 and the VRC6. It counts up
+// from the latch and fires when it overflows, either every CPU cycle or every
+// scanline, with a prescaler that approximates them as 113.667 CPU cycles.
+//
+// Control
+//
+//	7  bit  0
+//	---- ----
+//	.... .MEA
+//	      |||
+//	      ||+- Enable after acknowledgement
+//	      |+-- Enable
+//	      +--- Mode (0: scanline; 1: CPU cycle)
+type vrcIRQ struct {
+	latch          byte
+	counter        byte
+	prescaler      int
+	enabled        bool
+	enableAfterAck bool
+	cycleMode      bool
+	pending        bool
+}
+
+func (i *vrcIRQ) writeControl(value byte) {
+	i.enableAfterAck = value&0x01 > 0
+	i.enabled = value&0x02 > 0
+	i.cycleMode = value&0x04 > 0
+	i.pending = false
+
+	if i.enabled {
+		i.counter = i.latch
+		i.prescaler = 341
+	}
+}
+
+func (i *vrcIRQ) acknowledge() {
+	i.pending = false
+	i.enabled = i.enableAfterAck
+}
+
+func (i *vrcIRQ) clock() {
+	if !i.enabled {
+		return
+	}
+
+	if !i.cycleMode {
+		// 3 PPU dots per CPU cycle, 341 per scanline
+		i.prescaler -= 3
+		if i.prescaler > 0 {
+			return
+		}
+		i.prescaler += 341
+	}
+
+	if i.counter == 0xFF {
+		i.counter = i.latch
+		i.pending = true
+	} else {
+		i.counter++
+	}
+}
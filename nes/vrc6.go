@@ -0,0 +1,320 @@
+package nes
+
+// VRC6 (mappers 24 and 26) is a Konami board with a 16K and an 8K PRG bank,
+// eight 1K CHR banks, the VRC IRQ and three extra sound channels. Mapper 26
+// (VRC6b) swaps address lines A0 and A1.
+//
+//	$8000-$8003 16K PRG bank at $8000
+//	$9000-$9002 Pulse 1
+//	$9003       Frequency control
+//	$A000-$A002 Pulse 2
+//	$B000-$B002 Sawtooth
+//	$B003       PPU banking style, mirroring and PRG-RAM enable
+//	$C000-$C003 8K PRG bank at $C000
+//	$D000-$E003 CHR banks 0-7
+//	$F000-$F002 IRQ latch, control and acknowledge
+//
+// The last 8K bank is fixed at $E000. Only the banking style used by the
+// released games is supported, where the CHR banks are 1K each and bits 2-3
+// of $B003 pick the mirroring.
+type vrc6 struct {
+	cart    *cartridge
+	swapped bool // VRC6b
+
+	prgBanks   [2]byte
+	chrBanks   [8]byte
+	control    byte // $B003
+	irqCounter vrcIRQ
+
+	audio vrc6Audio
+
+	prgOffsets [4]int
+	chrOffsets [8]int
+}
+
+func newVRC6(c *cartridge) Mapper {
+	m := &vrc6{
+		cart:    c,
+		swapped: c.mapperNum == 26,
+	}
+	m.updateOffsets()
+	return m
+}
+
+func (m *vrc6) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0x8000:
+		slot := (address - 0x8000) / 0x2000
+		return m.cart.prg[m.prgOffsets[slot]+int(address%0x2000)]
+	case address >= 0x6000:
+		if m.control&0x80 > 0 {
+			return m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)]
+		}
+	}
+
+	return 0
+}
+
+func (m *vrc6) cpuWrite(address uint16, value byte) {
+	switch {
+	case address >= 0x8000:
+		reg := address & 0xF003
+		if m.swapped {
+			reg = reg&0xF000 | reg&1<<1 | reg&2>>1
+		}
+		m.writeRegister(reg, value)
+	case address >= 0x6000:
+		if m.control&0x80 > 0 {
+			m.cart.prgRAM[int(address-0x6000)%len(m.cart.prgRAM)] = value
+		}
+	}
+}
+
+func (m *vrc6) writeRegister(reg uint16, value byte) {
+	switch {
+	case reg <= 0x8003:
+		m.prgBanks[0] = value & 0x0F
+	case reg <= 0xB002:
+		m.audio.writeRegister(reg, value)
+	case reg == 0xB003:
+		m.control = value
+	case reg <= 0xC003:
+		m.prgBanks[1] = value & 0x1F
+	case reg <= 0xE003:
+		m.chrBanks[(reg-0xD000)/0x1000*4+reg&0x03] = value
+	case reg == 0xF000:
+		m.irqCounter.latch = value
+	case reg == 0xF001:
+		m.irqCounter.writeControl(value)
+	case reg == 0xF002:
+		m.irqCounter.acknowledge()
+	}
+
+	m.updateOffsets()
+}
+
+func (m *vrc6) updateOffsets() {
+	m.prgOffsets[0] = bankOffset(m.cart.prg, int(m.prgBanks[0])*2, 0x2000)
+	m.prgOffsets[1] = m.prgOffsets[0] + 0x2000
+	m.prgOffsets[2] = bankOffset(m.cart.prg, int(m.prgBanks[1]), 0x2000)
+	m.prgOffsets[3] = bankOffset(m.cart.prg, -1, 0x2000)
+
+	for i, bank := range m.chrBanks {
+		m.chrOffsets[i] = bankOffset(m.cart.chr, int(bank), 0x0400)
+	}
+}
+
+func (m *vrc6) ppuRead(address uint16) byte {
+	return m.cart.chr[m.chrOffsets[address/0x0400]+int(address%0x0400)]
+}
+
+func (m *vrc6) ppuWrite(address uint16, value byte) {
+	if m.cart.chrRAM {
+		m.cart.chr[m.chrOffsets[address/0x0400]+int(address%0x0400)] = value
+	}
+}
+
+func (m *vrc6) mirrorMode() mirrorMode {
+	switch m.control >> 2 & 0x03 {
+	case 0:
+		return vertical
+	case 1:
+		return horizontal
+	case 2:
+		return singleScreenLow
+	default:
+		return singleScreenHigh
+	}
+}
+
+func (m *vrc6) irq() bool                 { return m.irqCounter.pending }
+func (m *vrc6) ppuAddress(address uint16) {}
+
+func (m *vrc6) clock() {
+	m.irqCounter.clock()
+	m.audio.clock()
+}
+
+func (m *vrc6) audioChannels() []string { return vrc6Channels }
+func (m *vrc6) sample(out []float32)    { m.audio.sample(out) }
+
+// vrc6Volume scales the VRC6 output to the APU's. A step of the VRC6 pulses
+// is about as loud as a step of the APU ones, this is the linear
+// approximation of the latter.
+const vrc6Volume = 0.00752
+
+// vrc6Audio is the sound hardware of the VRC6, two pulse channels and a
+// sawtooth.
+//
+// Frequency control ($9003)
+//
+//	7  bit  0
+//	---- ----
+//	.... .ABH
+//	      |||
+//	      ||+- Halt all oscillators
+//	      |+-- 16x frequency (4 bit shift)
+//	      +--- 256x frequency (8 bit shift), takes precedence
+type vrc6Audio struct {
+	pulses [2]vrc6Pulse
+	saw    vrc6Saw
+
+	halt  bool
+	shift uint
+}
+
+func (a *vrc6Audio) writeRegister(reg uint16, value byte) {
+	switch reg & 0xF000 {
+	case 0x9000:
+		if reg == 0x9003 {
+			a.halt = value&0x01 > 0
+			switch {
+			case value&0x04 > 0:
+				a.shift = 8
+			case value&0x02 > 0:
+				a.shift = 4
+			default:
+				a.shift = 0
+			}
+			return
+		}
+		a.pulses[0].writeRegister(reg&0x03, value)
+	case 0xA000:
+		a.pulses[1].writeRegister(reg&0x03, value)
+	case 0xB000:
+		a.saw.writeRegister(reg&0x03, value)
+	}
+}
+
+func (a *vrc6Audio) clock() {
+	if a.halt {
+		return
+	}
+
+	a.pulses[0].clock(a.shift)
+	a.pulses[1].clock(a.shift)
+	a.saw.clock(a.shift)
+}
+
+// vrc6Channels names the VRC6 channels, in the order sample writes them.
+var vrc6Channels = []string{"vrc6_pulse_0", "vrc6_pulse_1", "vrc6_saw"}
+
+func (a *vrc6Audio) sample(out []float32) {
+	out[0] = float32(a.pulses[0].sample()) * vrc6Volume
+	out[1] = float32(a.pulses[1].sample()) * vrc6Volume
+	out[2] = float32(a.saw.sample()) * vrc6Volume
+}
+
+// vrc6Pulse has 16 steps, the first duty+1 of them output the volume.
+//
+//	$x000  MDDD VVVV  mode (1: ignore duty), duty, volume
+//	$x001  FFFF FFFF  period low
+//	$x002  E... FFFF  enable, period high
+type vrc6Pulse struct {
+	mode    bool
+	duty    byte
+	volume  byte
+	period  uint16
+	enabled bool
+
+	timer uint16
+	step  byte
+}
+
+func (p *vrc6Pulse) writeRegister(reg uint16, value byte) {
+	switch reg {
+	case 0:
+		p.mode = value&0x80 > 0
+		p.duty = value >> 4 & 0x07
+		p.volume = value & 0x0F
+	case 1:
+		p.period = p.period&0x0F00 | uint16(value)
+	case 2:
+		p.period = p.period&0x00FF | uint16(value&0x0F)<<8
+		p.enabled = value&0x80 > 0
+		if !p.enabled {
+			p.step = 15
+		}
+	}
+}
+
+func (p *vrc6Pulse) clock(shift uint) {
+	if !p.enabled {
+		return
+	}
+
+	if p.timer > 0 {
+		p.timer--
+		return
+	}
+
+	p.timer = p.period >> shift
+	p.step = (p.step - 1) & 0x0F
+}
+
+func (p *vrc6Pulse) sample() int {
+	if !p.enabled {
+		return 0
+	}
+	if p.mode || p.step <= p.duty {
+		return int(p.volume)
+	}
+	return 0
+}
+
+// vrc6Saw adds the rate to an accumulator every other clock and resets it
+// on the 14th, the output is its top 5 bits.
+//
+//	$B000  ..AA AAAA  accumulator rate
+//	$B001  FFFF FFFF  period low
+//	$B002  E... FFFF  enable, period high
+type vrc6Saw struct {
+	rate    byte
+	period  uint16
+	enabled bool
+
+	timer       uint16
+	step        byte
+	accumulator byte
+}
+
+func (s *vrc6Saw) writeRegister(reg uint16, value byte) {
+	switch reg {
+	case 0:
+		s.rate = value & 0x3F
+	case 1:
+		s.period = s.period&0x0F00 | uint16(value)
+	case 2:
+		s.period = s.period&0x00FF | uint16(value&0x0F)<<8
+		s.enabled = value&0x80 > 0
+		if !s.enabled {
+			s.step = 0
+			s.accumulator = 0
+		}
+	}
+}
+
+func (s *vrc6Saw) clock(shift uint) {
+	if !s.enabled {
+		return
+	}
+
+	if s.timer > 0 {
+		s.timer--
+		return
+	}
+
+	s.timer = s.period >> shift
+	s.step++
+	switch {
+	case s.step == 14:
+		s.step = 0
+		s.accumulator = 0
+	case s.step&1 == 0:
+		s.accumulator += s.rate
+	}
+}
+
+func (s *vrc6Saw) sample() int {
+	return int(s.accumulator >> 3)
+}
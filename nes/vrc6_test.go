@@ -0,0 +1,125 @@
+package nes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVRC6_Banking(t *testing.T) {
+	for _, mapper := range []uint16{24, 26} {
+		c := newTestBoard(mapper, 0)
+
+		// $D001 on VRC6a, $D002 on VRC6b
+		d1 := uint16(0xD001)
+		if mapper == 26 {
+			d1 = 0xD002
+		}
+
+		c.mapper.cpuWrite(0x8000, 2)
+		c.mapper.cpuWrite(0xC000, 9)
+		c.mapper.cpuWrite(d1, 17)
+		c.mapper.cpuWrite(0xE003, 21)
+
+		for slot, want := range [4]byte{4, 5, 9, 31} {
+			addr := 0x8000 + uint16(slot)*0x2000
+			if got := c.mapper.cpuRead(addr); got != want {
+				t.Errorf("mapper %d: $%04X bank = %d, want %d", mapper, addr, got, want)
+			}
+		}
+		if got := c.mapper.ppuRead(0x0400); got != 17 {
+			t.Errorf("mapper %d: $0400 bank = %d, want 17", mapper, got)
+		}
+		if got := c.mapper.ppuRead(0x1C00); got != 21 {
+			t.Errorf("mapper %d: $1C00 bank = %d, want 21", mapper, got)
+		}
+	}
+}
+
+func TestVRC6_Pulse(t *testing.T) {
+	var p vrc6Pulse
+	p.writeRegister(0, 0x3A) // duty 3 (4/16), volume 10
+	p.writeRegister(1, 0x00)
+	p.writeRegister(2, 0x80)
+
+	var high int
+	for i := 0; i < 16; i++ {
+		p.clock(0)
+		if p.sample() == 10 {
+			high++
+		}
+	}
+	if high != 4 {
+		t.Errorf("duty 3: high for %d of 16 steps, want 4", high)
+	}
+
+	p.writeRegister(0, 0x8A) // ignore duty
+	for i := 0; i < 16; i++ {
+		p.clock(0)
+		if got := p.sample(); got != 10 {
+			t.Fatalf("mode 1: step %d = %d, want 10", i, got)
+		}
+	}
+
+	p.writeRegister(2, 0x00)
+	if got := p.sample(); got != 0 {
+		t.Errorf("disabled: %d, want 0", got)
+	}
+}
+
+func TestVRC6_Saw(t *testing.T) {
+	var s vrc6Saw
+	s.writeRegister(0, 42)
+	s.writeRegister(1, 0x00)
+	s.writeRegister(2, 0x80)
+
+	// the accumulator goes 0, 42, 84 ... 252 and back to 0
+	var got []int
+	for i := 0; i < 14; i++ {
+		s.clock(0)
+		got = append(got, s.sample())
+	}
+	want := []int{0, 5, 5, 10, 10, 15, 15, 21, 21, 26, 26, 31, 31, 0}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("saw = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestVRC6_Mixed(t *testing.T) {
+	c := newTestBoard(24, 0)
+	if c.audio != nil {
+		t.Fatalf("audio is only set by loadRom")
+	}
+
+	audio, ok := c.mapper.(audioMapper)
+	if !ok {
+		t.Fatalf("VRC6 doesn't implement audioMapper")
+	}
+
+	if got := audio.audioChannels(); !reflect.DeepEqual(got, vrc6Channels) {
+		t.Errorf("audioChannels() = %v, want %v", got, vrc6Channels)
+	}
+
+	volume := float32(15)
+	want := []float32{volume * vrc6Volume, 0, 0}
+	got := make([]float32, len(vrc6Channels))
+
+	c.mapper.cpuWrite(0x9000, 0x8F)
+	c.mapper.cpuWrite(0x9002, 0x80)
+	c.mapper.clock()
+	if audio.sample(got); !reflect.DeepEqual(got, want) {
+		t.Errorf("sample = %v, want %v", got, want)
+	}
+
+	// halted oscillators keep their output
+	c.mapper.cpuWrite(0x9003, 0x01)
+	c.mapper.cpuWrite(0xB000, 0x20)
+	c.mapper.cpuWrite(0xB002, 0x80)
+	for i := 0; i < 10; i++ {
+		c.mapper.clock()
+	}
+	if audio.sample(got); !reflect.DeepEqual(got, want) {
+		t.Errorf("halted: sample = %v, want %v", got, want)
+	}
+}
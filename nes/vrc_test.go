@@ -0,0 +1,131 @@
+package nes
+
+import "testing"
+
+func TestVRC24_AddressLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		mapper    uint16
+		submapper byte
+		lines     [2]uint16 // A0, A1 as seen by the chip
+	}{
+		{"VRC4a", 21, 1, [2]uint16{0x02, 0x04}},
+		{"VRC4c", 21, 2, [2]uint16{0x40, 0x80}},
+		{"VRC4a/c as VRC4c", 21, 0, [2]uint16{0x40, 0x80}},
+		{"VRC2a", 22, 0, [2]uint16{0x02, 0x01}},
+		{"VRC4f", 23, 1, [2]uint16{0x01, 0x02}},
+		{"VRC4e", 23, 2, [2]uint16{0x04, 0x08}},
+		{"VRC2b", 23, 3, [2]uint16{0x01, 0x02}},
+		{"VRC4b", 25, 1, [2]uint16{0x02, 0x01}},
+		{"VRC4d", 25, 2, [2]uint16{0x08, 0x04}},
+		{"VRC4b/d as VRC4d", 25, 0, [2]uint16{0x08, 0x04}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestBoard(tt.mapper, tt.submapper)
+			a0, a1 := tt.lines[0], tt.lines[1]
+
+			c.mapper.cpuWrite(0x8000, 3)
+			c.mapper.cpuWrite(0xA000|a0|a1, 4)
+
+			// CHR bank 1 is at $B002/$B003, bank 3 at $C002/$C003
+			c.mapper.cpuWrite(0xB000|a1, 0x05)
+			c.mapper.cpuWrite(0xB000|a1|a0, 0x01)
+			c.mapper.cpuWrite(0xC000|a1, 0x07)
+
+			if got := c.mapper.cpuRead(0x8000); got != 3 {
+				t.Errorf("$8000 bank = %d, want 3", got)
+			}
+			if got := c.mapper.cpuRead(0xA000); got != 4 {
+				t.Errorf("$A000 bank = %d, want 4", got)
+			}
+			if got := c.mapper.cpuRead(0xC000); got != 30 {
+				t.Errorf("$C000 bank = %d, want 30", got)
+			}
+
+			want1, want3 := byte(0x15), byte(7)
+			if tt.mapper == 22 {
+				want1, want3 = 0x0A, 3
+			}
+			if got := c.mapper.ppuRead(0x0400); got != want1 {
+				t.Errorf("$0400 bank = %d, want %d", got, want1)
+			}
+			if got := c.mapper.ppuRead(0x0C00); got != want3 {
+				t.Errorf("$0C00 bank = %d, want %d", got, want3)
+			}
+		})
+	}
+}
+
+func TestVRC24_SwapMode(t *testing.T) {
+	c := newTestBoard(21, 1)
+	c.mapper.cpuWrite(0x8000, 3)
+	c.mapper.cpuWrite(0x9004, 0x02)
+
+	want := [4]byte{30, 0, 3, 31}
+	for slot, want := range want {
+		addr := 0x8000 + uint16(slot)*0x2000
+		if got := c.mapper.cpuRead(addr); got != want {
+			t.Errorf("$%04X bank = %d, want %d", addr, got, want)
+		}
+	}
+
+	// the VRC2 doesn't have it
+	c = newTestBoard(22, 0)
+	c.mapper.cpuWrite(0x8000, 3)
+	c.mapper.cpuWrite(0x9002, 0x02)
+	if got := c.mapper.cpuRead(0x8000); got != 3 {
+		t.Errorf("VRC2: $8000 bank = %d, want 3", got)
+	}
+}
+
+func TestVRCIRQ(t *testing.T) {
+	t.Run("cycle mode", func(t *testing.T) {
+		var irq vrcIRQ
+		irq.latch = 0xF0
+		irq.writeControl(0x07)
+
+		for i := 0; i < 15; i++ {
+			irq.clock()
+		}
+		if irq.pending {
+			t.Fatalf("irq fired early")
+		}
+		irq.clock()
+		if !irq.pending {
+			t.Fatalf("irq didn't fire after 16 cycles")
+		}
+		if irq.counter != 0xF0 {
+			t.Errorf("counter = %02X, want the latch", irq.counter)
+		}
+
+		irq.acknowledge()
+		if irq.pending || !irq.enabled {
+			t.Errorf("acknowledge: pending %v, enabled %v", irq.pending, irq.enabled)
+		}
+	})
+
+	t.Run("scanline mode", func(t *testing.T) {
+		var irq vrcIRQ
+		irq.latch = 0xFE
+		irq.writeControl(0x02)
+
+		// two scanlines are 682 dots, 227.3 cpu cycles
+		for i := 0; i < 227; i++ {
+			irq.clock()
+		}
+		if irq.pending {
+			t.Fatalf("irq fired early")
+		}
+		irq.clock()
+		if !irq.pending {
+			t.Fatalf("irq didn't fire after 2 scanlines")
+		}
+
+		irq.acknowledge()
+		if irq.enabled {
+			t.Errorf("acknowledge re-enabled the irq without the A flag")
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package nes
+
+import "image/color"
+
+// The VS System is the arcade version of the NES: the same CPU and PPU, with
+// coin slots and DIP switches wired to the controller ports and an RGB PPU
+// with its own palette. Some of those PPUs scramble the palette, or swap the
+// PPUCTRL and PPUMASK registers, so that the games don't work on a board with
+// a different chip.
+//
+//	$4016 read   bit 0 player 2 joystick, buttons 1 and 3 in place of select
+//	             and start, bit 2 service button, bits 3-4 DIP switches 1-2,
+//	             bits 5-6 coin slots 1-2
+//	$4017 read   bit 0 player 1 joystick, buttons 2 and 4 in place of select
+//	             and start, bits 2-7 DIP switches 3-8
+//	$4016 write  bit 2 goes to the cartridge, mapper 99 switches banks with it
+//
+// The PlayChoice-10 also runs NES games on an RGB PPU, the 2C03, but the rest
+// of it, the Z80 that runs the menu and the hint screen, is not emulated.
+
+// vsCoinFrames is how long a coin takes to go through the slot. Games count
+// coins on the falling edge, so the slot needs to be seen as set for a few
+// frames.
+const vsCoinFrames = 4
+
+// vsSystem is the coin and DIP switch I/O of the VS System.
+type vsSystem struct {
+	dipSwitches byte
+	service     bool
+	coins       [2]int // frames left until the coin is through the slot
+}
+
+func (vs *vsSystem) insertCoin(slot int) {
+	vs.coins[slot] = vsCoinFrames
+}
+
+// endFrame advances the coins going through the slots.
+func (vs *vsSystem) endFrame() {
+	for i := range vs.coins {
+		if vs.coins[i] > 0 {
+			vs.coins[i]--
+		}
+	}
+}
+
+// read4016 reads $4016, ctrl1 and ctrl2 are the first and second player.
+func (vs *vsSystem) read4016(ctrl1, ctrl2 *controller) byte {
+	v := byte(ctrl2.readVS(ctrl1))
+	if vs.service {
+		v |= 0x04
+	}
+	v |= vs.dipSwitches & 0x03 << 3
+	if vs.coins[0] > 0 {
+		v |= 0x20
+	}
+	if vs.coins[1] > 0 {
+		v |= 0x40
+	}
+	return v
+}
+
+// read4017 reads $4017, ctrl1 and ctrl2 are the first and second player.
+func (vs *vsSystem) read4017(ctrl1, ctrl2 *controller) byte {
+	return byte(ctrl1.readVS(ctrl2)) | vs.dipSwitches&0xFC
+}
+
+// rgbPalette expands a palette of 3 bit per channel octal RGB triplets, the
+// way the RGB PPUs are documented, to 8 bit per channel colors.
+func rgbPalette(octal [64]uint16) *[64]color.RGBA {
+	level := func(v uint16) uint8 {
+		return uint8((v & 07) * 0xFF / 07)
+	}
+
+	var p [64]color.RGBA
+	for i, v := range octal {
+		p[i] = color.RGBA{level(v >> 6), level(v >> 3), level(v), 0xFF}
+	}
+	return &p
+}
+
+// palette2C03 is the palette of the RP2C03 and RC2C05 PPUs.
+var palette2C03 = rgbPalette([64]uint16{
+	0333, 0014, 0006, 0326, 0403, 0503, 0510, 0420, 0320, 0120, 0031, 0040, 0022, 0000, 0000, 0000,
+	0555, 0036, 0027, 0407, 0507, 0704, 0700, 0630, 0430, 0140, 0040, 0053, 0044, 0000, 0000, 0000,
+	0777, 0357, 0447, 0637, 0707, 0737, 0740, 0750, 0660, 0360, 0070, 0276, 0077, 0000, 0000, 0000,
+	0777, 0567, 0657, 0757, 0747, 0755, 0764, 0772, 0773, 0572, 0473, 0276, 0467, 0000, 0000, 0000,
+})
+
+// palette2C04v1 to palette2C04v4 are the palettes of the RP2C04-0001 to
+// RP2C04-0004, the same colors in a different order.
+var (
+	palette2C04v1 = rgbPalette([64]uint16{
+		0755, 0637, 0700, 0447, 0044, 0120, 0222, 0704, 0777, 0333, 0750, 0503, 0403, 0660, 0320, 0777,
+		0357, 0653, 0310, 0360, 0467, 0657, 0764, 0027, 0760, 0276, 0000, 0200, 0666, 0444, 0707, 0014,
+		0003, 0567, 0757, 0070, 0077, 0022, 0053, 0507, 0000, 0420, 0747, 0510, 0407, 0006, 0740, 0000,
+		0000, 0140, 0555, 0031, 0572, 0326, 0770, 0630, 0020, 0036, 0040, 0111, 0773, 0737, 0430, 0473,
+	})
+	palette2C04v2 = rgbPalette([64]uint16{
+		0000, 0750, 0430, 0572, 0473, 0737, 0044, 0567, 0700, 0407, 0773, 0747, 0777, 0637, 0467, 0040,
+		0020, 0357, 0510, 0666, 0053, 0360, 0200, 0447, 0222, 0707, 0003, 0276, 0657, 0320, 0000, 0326,
+		0403, 0764, 0740, 0757, 0036, 0310, 0555, 0006, 0507, 0760, 0333, 0120, 0027, 0000, 0660, 0777,
+		0653, 0111, 0070, 0630, 0022, 0014, 0704, 0140, 0000, 0077, 0420, 0770, 0755, 0503, 0031, 0444,
+	})
+	palette2C04v3 = rgbPalette([64]uint16{
+		0507, 0737, 0473, 0555, 0040, 0777, 0567, 0120, 0014, 0000, 0764, 0320, 0704, 0666, 0653, 0467,
+		0447, 0044, 0503, 0027, 0140, 0430, 0630, 0053, 0333, 0326, 0000, 0006, 0700, 0510, 0747, 0755,
+		0637, 0020, 0003, 0770, 0111, 0750, 0740, 0777, 0360, 0403, 0357, 0707, 0036, 0444, 0000, 0310,
+		0077, 0200, 0572, 0757, 0420, 0070, 0660, 0222, 0031, 0000, 0657, 0773, 0407, 0276, 0760, 0022,
+	})
+	palette2C04v4 = rgbPalette([64]uint16{
+		0430, 0326, 0044, 0660, 0000, 0755, 0014, 0630, 0555, 0310, 0070, 0003, 0764, 0770, 0040, 0572,
+		0737, 0200, 0027, 0747, 0000, 0222, 0510, 0740, 0653, 0053, 0447, 0140, 0403, 0000, 0473, 0357,
+		0503, 0031, 0420, 0006, 0407, 0507, 0333, 0704, 0022, 0666, 0036, 0020, 0111, 0773, 0444, 0707,
+		0757, 0777, 0320, 0700, 0760, 0276, 0777, 0467, 0000, 0750, 0637, 0567, 0360, 0657, 0077, 0120,
+	})
+)
+
+// setVariant makes the PPU behave like the one the cartridge was made for.
+// VS System games name it in the NES 2.0 header, older headers get the
+// RP2C03B.
+func (p *ppu) setVariant(info CartridgeInfo) {
+	p.colors = &palette
+	p.swapCtrlMask = false
+	p.statusID = 0
+
+	switch info.ConsoleType {
+	case VSSystem:
+	case PlayChoice10:
+		p.colors = palette2C03
+		return
+	default:
+		return
+	}
+
+	p.colors = palette2C03
+	switch info.VSPPUType {
+	case 0x2: // RP2C04-0001
+		p.colors = palette2C04v1
+	case 0x3: // RP2C04-0002
+		p.colors = palette2C04v2
+	case 0x4: // RP2C04-0003
+		p.colors = palette2C04v3
+	case 0x5: // RP2C04-0004
+		p.colors = palette2C04v4
+	case 0x8: // RC2C05-01
+		p.swapCtrlMask, p.statusID = true, 0x1B
+	case 0x9: // RC2C05-02
+		p.swapCtrlMask, p.statusID = true, 0x3D
+	case 0xA: // RC2C05-03
+		p.swapCtrlMask, p.statusID = true, 0x1C
+	case 0xB: // RC2C05-04
+		p.swapCtrlMask, p.statusID = true, 0x1B
+	case 0xC: // RC2C05-05
+		p.swapCtrlMask = true
+	}
+}
+
+// vsPRGRAMSize is the size of the RAM the VS System has at $6000.
+const vsPRGRAMSize = 0x800
+
+// vsUnisystem is mapper 99, the board most VS System games use. Bit 2 of the
+// writes to $4016 selects the CHR bank, and on 40K games the PRG bank at
+// $8000 too.
+//
+//	$6000-$7FFF 2K of RAM, mirrored
+//	$8000-$9FFF 8K PRG-ROM bank, switchable on 40K games
+//	$A000-$FFFF 24K PRG-ROM, fixed
+//	$0000-$1FFF 8K CHR bank
+type vsUnisystem struct {
+	cart *cartridge
+	bank int
+}
+
+func newVSUnisystem(c *cartridge) Mapper {
+	return &vsUnisystem{cart: c}
+}
+
+func (m *vsUnisystem) controllerPortWrite(value byte) {
+	m.bank = int(value >> 2 & 0x01)
+}
+
+func (m *vsUnisystem) cpuRead(address uint16) byte {
+	switch {
+	case address >= 0xA000:
+		return m.cart.prg[int(address-0x8000)%len(m.cart.prg)]
+	case address >= 0x8000:
+		// the switchable bank is the 5th one, 32K games only have 4
+		return m.cart.prg[bankOffset(m.cart.prg, m.bank*4, 0x2000)+int(address-0x8000)]
+	case address >= 0x6000:
+		return m.cart.prgRAM[int(address-0x6000)%vsPRGRAMSize]
+	}
+
+	return 0
+}
+
+func (m *vsUnisystem) cpuWrite(address uint16, value byte) {
+	if address >= 0x6000 && address < 0x8000 {
+		m.cart.prgRAM[int(address-0x6000)%vsPRGRAMSize] = value
+	}
+}
+
+func (m *vsUnisystem) ppuRead(address uint16) byte {
+	return m.cart.chr[bankOffset(m.cart.chr, m.bank, 0x2000)+int(address)]
+}
+
+func (m *vsUnisystem) ppuWrite(address uint16, value byte) {
+	if m.cart.chrRAM {
+		m.cart.chr[bankOffset(m.cart.chr, m.bank, 0x2000)+int(address)] = value
+	}
+}
+
+func (m *vsUnisystem) mirrorMode() mirrorMode {
+	return m.cart.mirrorMode
+}
+
+func (m *vsUnisystem) irq() bool                 { return false }
+func (m *vsUnisystem) ppuAddress(address uint16) {}
+func (m *vsUnisystem) clock()                    {}
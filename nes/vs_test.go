@@ -0,0 +1,165 @@
+package nes
+
+import (
+	"bytes"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestVSUnisystem(t *testing.T) {
+	c := &cartridge{
+		prg:    make([]byte, 5*0x2000),
+		chr:    make([]byte, 2*chrMul),
+		prgRAM: make([]byte, sramSize),
+	}
+	for i := range c.prg {
+		c.prg[i] = byte(i / 0x2000)
+	}
+	for i := range c.chr {
+		c.chr[i] = byte(i / chrMul)
+	}
+	m := newVSUnisystem(c)
+	c.mapper = m
+
+	check := func(prg [4]byte, chr byte) {
+		t.Helper()
+		for i, want := range prg {
+			if got := m.cpuRead(0x8000 + uint16(i)*0x2000); got != want {
+				t.Errorf("$%04X = bank %d, want %d", 0x8000+i*0x2000, got, want)
+			}
+		}
+		if got := m.ppuRead(0x0000); got != chr {
+			t.Errorf("chr = bank %d, want %d", got, chr)
+		}
+	}
+
+	check([4]byte{0, 1, 2, 3}, 0)
+	c.controllerPortWrite(0x04)
+	check([4]byte{4, 1, 2, 3}, 1)
+	c.controllerPortWrite(0x01)
+	check([4]byte{0, 1, 2, 3}, 0)
+
+	m.cpuWrite(0x6000, 0x42)
+	if got := m.cpuRead(0x6800); got != 0x42 {
+		t.Errorf("$6800 = %02X, want the 2K of RAM mirrored", got)
+	}
+}
+
+func TestVSUnisystem_SmallPRGRAM(t *testing.T) {
+	// NES 2.0 headers can declare less than the 2K the board has
+	info := CartridgeInfo{Format: NES20, Mapper: 99, PRGRAMSize: 128}
+	c := &cartridge{
+		info:   info,
+		prg:    make([]byte, 4*0x2000),
+		chr:    make([]byte, chrMul),
+		prgRAM: make([]byte, prgRAMSize(info)),
+	}
+	m := newVSUnisystem(c)
+
+	m.cpuWrite(0x67FF, 0x42)
+	if got := m.cpuRead(0x7FFF); got != 0x42 {
+		t.Errorf("$7FFF = %02X, want %02X", got, 0x42)
+	}
+}
+
+func TestConsole_VSSystem(t *testing.T) {
+	rom := []byte{'N', 'E', 'S', 0x1A, 2, 1, 0x30, 0x61, 0, 0, 0, 0, 0, 0, 0, 0}
+	rom = append(rom, make([]byte, 2*prgMul+chrMul)...)
+
+	console := NewConsole(44100, 0, nil)
+	if err := console.InsertCoin(0); err == nil {
+		t.Errorf("InsertCoin() expected an error without a VS System game")
+	}
+	if err := console.LoadRom(bytes.NewReader(rom)); err != nil {
+		t.Fatalf("LoadRom() unexpected error %v", err)
+	}
+
+	console.SetDIPSwitches(0xA5)
+	if err := console.InsertCoin(1); err != nil {
+		t.Fatalf("InsertCoin() unexpected error %v", err)
+	}
+	if err := console.InsertCoin(2); err == nil {
+		t.Errorf("InsertCoin() expected an error for a missing slot")
+	}
+	console.Press(0, Start)
+	console.Press(1, A)
+
+	console.Write(0x4016, 1)
+	console.Write(0x4016, 0)
+
+	var port1, port2 [8]byte
+	for i := range port1 {
+		port1[i] = console.Read(0x4016)
+		port2[i] = console.Read(0x4017)
+	}
+
+	// player 2 and button 1, DIP switches 1-2 and the second coin slot
+	if want := [8]byte{0x49, 0x48, 0x49, 0x48, 0x48, 0x48, 0x48, 0x48}; port1 != want {
+		t.Errorf("$4016 = % X, want % X", port1, want)
+	}
+	// player 1, DIP switches 3-8
+	if want := [8]byte{0xA4, 0xA4, 0xA4, 0xA4, 0xA4, 0xA4, 0xA4, 0xA4}; port2 != want {
+		t.Errorf("$4017 = % X, want % X", port2, want)
+	}
+
+	for i := 0; i < vsCoinFrames; i++ {
+		console.StepFrame()
+	}
+	if got := console.Read(0x4016); got&0x60 != 0 {
+		t.Errorf("$4016 = %02X, want the coin through the slot", got)
+	}
+}
+
+func TestPPU_SetVariant(t *testing.T) {
+	p := newPpu()
+	p.setVariant(CartridgeInfo{ConsoleType: VSSystem, VSPPUType: 0x9})
+
+	p.writePort(ppuCtrlAddr, byte(showBackground), nil)
+	if p.mask != showBackground || p.ctrl != 0 {
+		t.Errorf("ctrl %02X, mask %02X, want $2000 to write PPUMASK", p.ctrl, p.mask)
+	}
+	p.status = verticalBlank | spriteOverflow
+	if got := p.readPort(ppuStatusAddr, nil); got != 0xBD {
+		t.Errorf("$2002 = %02X, want the vblank flag and the ID", got)
+	}
+
+	p.setVariant(CartridgeInfo{ConsoleType: VSSystem, VSPPUType: 0x2})
+	if p.colors != palette2C04v1 || p.swapCtrlMask {
+		t.Errorf("RP2C04-0001: wrong palette or registers swapped")
+	}
+	p.setVariant(CartridgeInfo{ConsoleType: VSSystem, VSPPUType: 0x5})
+	if p.colors != palette2C04v4 {
+		t.Errorf("RP2C04-0004: wrong palette")
+	}
+	p.setVariant(CartridgeInfo{ConsoleType: PlayChoice10})
+	if p.colors != palette2C03 {
+		t.Errorf("PlayChoice-10: want the 2C03 palette")
+	}
+	p.setVariant(CartridgeInfo{})
+	if p.colors != &palette || p.statusID != 0 {
+		t.Errorf("NES: want the 2C02 palette and no ID")
+	}
+
+	if got, want := palette2C03[0x20], (color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}); got != want {
+		t.Errorf("$20 = %v, want %v", got, want)
+	}
+}
+
+func TestPalette2C04(t *testing.T) {
+	count := func(p *[64]color.RGBA) map[color.RGBA]int {
+		n := make(map[color.RGBA]int)
+		for _, c := range p {
+			n[c]++
+		}
+		return n
+	}
+
+	// every RP2C04 has the same colors, scrambled
+	want := count(palette2C04v1)
+	for i, p := range []*[64]color.RGBA{palette2C04v2, palette2C04v3, palette2C04v4} {
+		if got := count(p); !reflect.DeepEqual(got, want) {
+			t.Errorf("RP2C04-000%d: colors differ from the RP2C04-0001", i+2)
+		}
+	}
+}